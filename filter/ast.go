@@ -110,6 +110,15 @@ func (a AERC) String() string {
 	return "aerc"
 }
 
+// Tag represents a user-defined deck tag.
+type Tag struct {
+	Value string `@"tag"`
+}
+
+func (t Tag) String() string {
+	return "tag"
+}
+
 // Op represent the operation specified by a constraint.  Currently
 // can only be equals.
 type Op struct {
@@ -117,12 +126,13 @@ type Op struct {
 }
 
 // Value represents the value of a constraint.  Currently could be a
-// range, float, int, or string.
+// range, float, int, or string.  Strings may contain dashes (e.g.,
+// "to-sell").
 type Value struct {
 	Range  []string `@(Float|Int)* @":" @(Float|Int)*`
 	Float  *float64 `| @Float`
 	Int    *int     `| @Int`
-	String *string  `| @Ident`
+	String *string  `| @Ident (@"-" @(Ident|Int))*`
 }
 
 // MinString returns the minimum value for the range, if this value is
@@ -307,6 +317,7 @@ var parser = participle.MustBuild[Statement](
 		AERC{},
 		Expansion{},
 		House{},
+		Tag{},
 	),
 	participle.Union[BooleanOperator](
 		And{},
@@ -73,4 +73,12 @@ func TestAST(t *testing.T) {
 	require.IsType(t, AmberControl{}, n.Right.Constraint.Var)
 	require.Equal(t, "5.0", n.Right.Constraint.Value.MinString())
 	require.Equal(t, "7.0", n.Right.Constraint.Value.MaxString())
+
+	n, err = Parse("tag=to-sell,house=mars")
+	require.NoError(t, err)
+	require.IsType(t, And{}, n.Op)
+	require.IsType(t, Tag{}, n.Left.Constraint.Var)
+	require.Equal(t, "to-sell", *n.Left.Constraint.Value.String)
+	require.IsType(t, House{}, n.Right.Constraint.Var)
+	require.Equal(t, "mars", *n.Right.Constraint.Value.String)
 }
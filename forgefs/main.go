@@ -11,11 +11,14 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 
 	sdDaemon "github.com/coreos/go-systemd/daemon"
 	"github.com/hanwen/go-fuse/v2/fs"
 	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/strib/forgefs"
 	"github.com/strib/forgefs/fsutil"
 	"github.com/strib/forgefs/fusefs"
 	"github.com/strib/forgefs/net"
@@ -26,6 +29,12 @@ import (
 const (
 	defaultDoKAddr  = "https://decksofkeyforge.com"
 	defaultSkyJAddr = "https://tts.skyj.io"
+
+	// Kernel cache timeouts, in seconds.  The file system tells the
+	// kernel when cached data changes, so these can safely be longer.
+	defaultEntryTimeout    = 60
+	defaultAttrTimeout     = 60
+	defaultNegativeTimeout = 10
 )
 
 var defaultMountpoint = filepath.Join(os.Getenv("HOME"), "ffs")
@@ -35,6 +44,22 @@ var defaultDBFile = filepath.Join(
 var defaultImageCacheDir = filepath.Join(
 	os.Getenv("HOME"), ".local", "share", "forgefs", "forgefs_images")
 
+// secondsToDuration converts a config value in seconds to a duration.
+func secondsToDuration(secs float64) *time.Duration {
+	d := time.Duration(secs * float64(time.Second))
+	return &d
+}
+
+// loadConfigFile reads the config file at `path` over the values
+// already in `config`.
+func loadConfigFile(path string, config *fusefs.Config) error {
+	configData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(configData, config)
+}
+
 func sigHandler(signal os.Signal, server *fuse.Server) error {
 	switch signal {
 	case syscall.SIGTERM, syscall.SIGINT:
@@ -44,6 +69,32 @@ func sigHandler(signal os.Signal, server *fuse.Server) error {
 	return nil
 }
 
+// doSearch prints the titles of all the stored cards matching
+// `query`, most relevant first.
+func doSearch(dbFile, query string) (err error) {
+	ctx := context.Background()
+
+	s, err := storage.NewSQLiteStorage(ctx, dbFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		serr := s.Shutdown()
+		if err == nil {
+			err = serr
+		}
+	}()
+
+	titles, err := s.SearchCards(ctx, query)
+	if err != nil {
+		return err
+	}
+	for _, title := range titles {
+		fmt.Println(title)
+	}
+	return nil
+}
+
 func doMain() (err error) {
 	// Start with built-in defaults.
 	config := fusefs.Config{
@@ -53,6 +104,14 @@ func doMain() (err error) {
 		DBFile:        defaultDBFile,
 		Mountpoint:    defaultMountpoint,
 		ImageCacheDir: defaultImageCacheDir,
+
+		ThumbnailSize:       fsutil.DefaultThumbnailSize,
+		ContactSheetColumns: fsutil.DefaultContactSheetColumns,
+		ContactSheetScale:   fsutil.DefaultContactSheetScale,
+
+		EntryTimeout:    defaultEntryTimeout,
+		AttrTimeout:     defaultAttrTimeout,
+		NegativeTimeout: defaultNegativeTimeout,
 	}
 
 	// Load default config file, if it exists, to provide default
@@ -88,6 +147,26 @@ func doMain() (err error) {
 	flag.StringVar(
 		&config.ImageCacheDir, "image-cache-dir", config.ImageCacheDir,
 		"image cache directory")
+	flag.IntVar(
+		&config.ThumbnailSize, "thumbnail-size", config.ThumbnailSize,
+		"Maximum width or height of image thumbnails, in pixels")
+	flag.IntVar(
+		&config.ContactSheetColumns, "contact-sheet-columns",
+		config.ContactSheetColumns,
+		"Number of cards in each row of a deck's cards.jpg")
+	flag.Float64Var(
+		&config.ContactSheetScale, "contact-sheet-scale",
+		config.ContactSheetScale,
+		"Size of each card in a deck's cards.jpg, relative to the full image")
+	flag.Float64Var(
+		&config.EntryTimeout, "entry-timeout", config.EntryTimeout,
+		"Seconds the kernel may cache file names")
+	flag.Float64Var(
+		&config.AttrTimeout, "attr-timeout", config.AttrTimeout,
+		"Seconds the kernel may cache file attributes")
+	flag.Float64Var(
+		&config.NegativeTimeout, "negative-timeout", config.NegativeTimeout,
+		"Seconds the kernel may cache missing file names")
 	var configFile = flag.String(
 		"config-file", "",
 		fmt.Sprintf("Custom config file location (default %s)",
@@ -98,14 +177,16 @@ func doMain() (err error) {
 		"show-mountpoint", false, "Print the mountpoint and exit")
 	var showImageCacheDir = flag.Bool(
 		"show-image-cache-dir", false, "Print the image cache dir and exit")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"Usage: %s [flags]\n       %s [flags] search <query>\n",
+			os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
 	if configFile != nil && *configFile != "" {
-		configData, err := ioutil.ReadFile(defaultConfigFile)
-		if err != nil {
-			return err
-		}
-		err = json.Unmarshal(configData, &config)
+		err = loadConfigFile(*configFile, &config)
 		if err != nil {
 			return err
 		}
@@ -126,6 +207,13 @@ func doMain() (err error) {
 		return nil
 	}
 
+	if flag.Arg(0) == "search" {
+		if flag.NArg() < 2 {
+			return errors.New("No search query given")
+		}
+		return doSearch(config.DBFile, strings.Join(flag.Args()[1:], " "))
+	}
+
 	if config.DoKAPIKey == "" {
 		return errors.New("No API key given")
 	}
@@ -166,6 +254,10 @@ func doMain() (err error) {
 		if err != nil {
 			return err
 		}
+		err = s.SetSyncTime(ctx, forgefs.SyncCards, time.Now())
+		if err != nil {
+			return err
+		}
 	}
 
 	count, err = s.GetDecksCount(ctx)
@@ -184,26 +276,52 @@ func doMain() (err error) {
 		if err != nil {
 			return err
 		}
+		err = s.SetSyncTime(ctx, forgefs.SyncDecks, time.Now())
+		if err != nil {
+			return err
+		}
 	}
 
 	imageCache, err := storage.NewDirImageCache(config.ImageCacheDir)
 	if err != nil {
 		return err
 	}
-	cardFetcher := &net.CardFetcher{}
+	cardFetcher := net.NewCardFetcher()
 	deckFetcher := net.NewSkyJAPI(config.SkyJAddr)
-	im := fsutil.NewImageManager(cardFetcher, deckFetcher, imageCache)
+	im := fsutil.NewImageManager(
+		cardFetcher, deckFetcher, imageCache, config.ImageManagerOptions())
 
 	fmt.Printf("Mounting at %s\n", config.Mountpoint)
 	root := fusefs.NewFSRoot(s, da, im)
+	root.SetConfigLoader(func() (*fusefs.Config, error) {
+		// Start from the current config, so that any values missing
+		// from the file keep their flag or default values.
+		newConfig := config
+		path := defaultConfigFile
+		if configFile != nil && *configFile != "" {
+			path = *configFile
+		}
+		err := loadConfigFile(path, &newConfig)
+		if err != nil {
+			return nil, err
+		}
+		return &newConfig, nil
+	})
 	server, err := fs.Mount(config.Mountpoint, root, &fs.Options{
 		MountOptions: fuse.MountOptions{
 			Debug: config.Debug,
 		},
+		EntryTimeout:    secondsToDuration(config.EntryTimeout),
+		AttrTimeout:     secondsToDuration(config.AttrTimeout),
+		NegativeTimeout: secondsToDuration(config.NegativeTimeout),
 	})
 	if err != nil {
 		return err
 	}
+	// Now that the file system is mounted, it can tell the kernel
+	// about any changes to the stored data.
+	s.SetObserver(root)
+	defer s.SetObserver(nil)
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh)
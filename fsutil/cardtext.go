@@ -0,0 +1,89 @@
+package fsutil
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/strib/forgefs"
+)
+
+type cardRating struct {
+	name       string
+	value, max float64
+}
+
+// FormatCardText returns a human-readable description of the given
+// card, including its rules text and decksofkeyforge ratings.
+func FormatCardText(card *forgefs.Card) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s\n", card.CardTitle)
+
+	var header []string
+	for _, s := range []string{card.House, card.CardType, card.Rarity} {
+		if s != "" {
+			header = append(header, s)
+		}
+	}
+	if len(header) > 0 {
+		fmt.Fprintf(&buf, "%s\n", strings.Join(header, " | "))
+	}
+
+	if strings.Contains(card.CardType, "Creature") || card.Power != 0 {
+		power := card.PowerString
+		if power == "" {
+			power = fmt.Sprintf("%d", card.Power)
+		}
+		armor := card.ArmorString
+		if armor == "" {
+			armor = fmt.Sprintf("%d", card.Armor)
+		}
+		fmt.Fprintf(&buf, "Power: %s | Armor: %s\n", power, armor)
+	}
+	if card.Amber != 0 {
+		fmt.Fprintf(&buf, "Amber: %d\n", card.Amber)
+	}
+	if len(card.Traits) > 0 {
+		fmt.Fprintf(&buf, "Traits: %s\n", strings.Join(card.Traits, ", "))
+	}
+
+	if card.CardText != "" {
+		fmt.Fprintf(&buf, "\n%s\n", card.CardText)
+	}
+	if card.FlavorText != "" {
+		fmt.Fprintf(&buf, "\n\"%s\"\n", card.FlavorText)
+	}
+
+	info := card.ExtraCardInfo
+	ratings := []cardRating{
+		{"AERC", card.AERCScore, card.AERCScoreMax},
+		{"Amber control", info.AmberControl, info.AmberControlMax},
+		{"Expected amber", info.ExpectedAmber, info.ExpectedAmberMax},
+		{"Artifact control", info.ArtifactControl, info.ArtifactControlMax},
+		{"Creature control", info.CreatureControl, info.CreatureControlMax},
+		{"Efficiency", info.Efficiency, info.EfficiencyMax},
+		{"Recursion", info.Recursion, info.RecursionMax},
+		{"Effective power", info.EffectivePower, info.EffectivePowerMax},
+		{"Creature protection", info.CreatureProtection,
+			info.CreatureProtectionMax},
+		{"Disruption", info.Disruption, info.DisruptionMax},
+		{"Other", info.Other, info.OtherMax},
+	}
+	wroteHeader := false
+	for _, r := range ratings {
+		if r.value == 0 && r.max == 0 {
+			continue
+		}
+		if !wroteHeader {
+			buf.WriteString("\nRatings:\n")
+			wroteHeader = true
+		}
+		if r.max > r.value {
+			fmt.Fprintf(&buf, "  %s: %s (max %s)\n",
+				r.name, formatStat(r.value), formatStat(r.max))
+		} else {
+			fmt.Fprintf(&buf, "  %s: %s\n", r.name, formatStat(r.value))
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,44 @@
+package fsutil
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/strib/forgefs"
+)
+
+func TestFormatCardText(t *testing.T) {
+	// Make sure the card text survives a round trip through the DoK
+	// JSON format.
+	var card forgefs.Card
+	err := json.Unmarshal([]byte(`{
+		"cardTitle": "Troll",
+		"house": "Brobnar",
+		"cardType": "Creature",
+		"rarity": "Rare",
+		"power": 8,
+		"traits": ["Giant"],
+		"cardText": "Troll cannot reap.",
+		"flavorText": "Big and green.",
+		"aercScore": 1.5,
+		"aercScoreMax": 2,
+		"extraCardInfo": {"creatureControl": 0.5}
+	}`), &card)
+	require.NoError(t, err)
+	require.Equal(t, "Troll cannot reap.", card.CardText)
+
+	require.Equal(t, `Troll
+Brobnar | Creature | Rare
+Power: 8 | Armor: 0
+Traits: Giant
+
+Troll cannot reap.
+
+"Big and green."
+
+Ratings:
+  AERC: 1.5 (max 2)
+  Creature control: 0.5
+`, string(FormatCardText(&card)))
+}
@@ -0,0 +1,201 @@
+package fsutil
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/strib/forgefs"
+)
+
+// This file draws simple charts as SVG images, which can be viewed in
+// any browser or file manager preview.
+
+func escapeSVGText(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+func startSVG(buf *bytes.Buffer, width, height int, title string) {
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" `+
+		`width="%d" height="%d" viewBox="0 0 %d %d" `+
+		`font-family="sans-serif" font-size="12">`+"\n",
+		width, height, width, height)
+	fmt.Fprintf(buf, "<title>%s</title>\n", escapeSVGText(title))
+	fmt.Fprintf(buf, `<rect width="%d" height="%d" fill="white"/>`+"\n",
+		width, height)
+}
+
+// Layout of deck radar charts.
+const (
+	radarWidth   = 400
+	radarHeight  = 440
+	radarCenterX = 200.0
+	radarCenterY = 220.0
+	radarRadius  = 140.0
+)
+
+type radarAxis struct {
+	name          string
+	value, median float64
+}
+
+func radarPoint(axis, numAxes int, fraction float64) (x, y float64) {
+	angle := -math.Pi/2 + 2*math.Pi*float64(axis)/float64(numAxes)
+	r := radarRadius * fraction
+	return radarCenterX + r*math.Cos(angle), radarCenterY + r*math.Sin(angle)
+}
+
+func radarPolygon(numAxes int, fraction func(i int) float64) string {
+	points := make([]string, numAxes)
+	for i := range points {
+		x, y := radarPoint(i, numAxes, fraction(i))
+		points[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+	}
+	return strings.Join(points, " ")
+}
+
+// FormatDeckRadarSVG returns an SVG radar chart comparing the a, e, r,
+// c, f and d stats of a deck to the collection's medians.  Each axis
+// is scaled so the median sits halfway out, unless the deck's value
+// needs more room.
+func FormatDeckRadarSVG(
+	name string, deck, medians forgefs.StatValues) []byte {
+	axes := []radarAxis{
+		{"A", deck.A, medians.A},
+		{"E", deck.E, medians.E},
+		{"R", deck.R, medians.R},
+		{"C", deck.C, medians.C},
+		{"F", deck.F, medians.F},
+		{"D", deck.D, medians.D},
+	}
+	scales := make([]float64, len(axes))
+	for i, a := range axes {
+		scales[i] = math.Max(math.Max(2*a.median, a.value), 1)
+	}
+
+	var buf bytes.Buffer
+	startSVG(&buf, radarWidth, radarHeight, name)
+	fmt.Fprintf(&buf, `<text x="%d" y="24" text-anchor="middle" `+
+		`font-size="16" font-weight="bold">%s</text>`+"\n",
+		radarWidth/2, escapeSVGText(name))
+
+	// Grid rings and spokes.
+	for _, ring := range []float64{0.25, 0.5, 0.75, 1} {
+		fmt.Fprintf(&buf, `<polygon points="%s" fill="none" `+
+			`stroke="#ddd"/>`+"\n",
+			radarPolygon(len(axes), func(int) float64 { return ring }))
+	}
+	for i, a := range axes {
+		x, y := radarPoint(i, len(axes), 1)
+		fmt.Fprintf(&buf, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" `+
+			`stroke="#ddd"/>`+"\n", radarCenterX, radarCenterY, x, y)
+		lx, ly := radarPoint(i, len(axes), 1.15)
+		fmt.Fprintf(&buf, `<text x="%.1f" y="%.1f" text-anchor="middle" `+
+			`dominant-baseline="middle">%s %s</text>`+"\n",
+			lx, ly, a.name, formatStat(a.value))
+	}
+
+	fmt.Fprintf(&buf, `<polygon points="%s" fill="none" stroke="#888" `+
+		`stroke-width="2" stroke-dasharray="6,4"/>`+"\n",
+		radarPolygon(len(axes), func(i int) float64 {
+			return axes[i].median / scales[i]
+		}))
+	fmt.Fprintf(&buf, `<polygon points="%s" fill="#3478c8" `+
+		`fill-opacity="0.35" stroke="#3478c8" stroke-width="2"/>`+"\n",
+		radarPolygon(len(axes), func(i int) float64 {
+			return axes[i].value / scales[i]
+		}))
+
+	// Legend.
+	legendY := radarHeight - 24
+	fmt.Fprintf(&buf, `<rect x="90" y="%d" width="14" height="14" `+
+		`fill="#3478c8" fill-opacity="0.35" stroke="#3478c8"/>`+"\n",
+		legendY-11)
+	fmt.Fprintf(&buf, `<text x="110" y="%d">This deck</text>`+"\n", legendY)
+	fmt.Fprintf(&buf, `<line x1="200" y1="%d" x2="224" y2="%d" `+
+		`stroke="#888" stroke-width="2" stroke-dasharray="6,4"/>`+"\n",
+		legendY-4, legendY-4)
+	fmt.Fprintf(&buf, `<text x="230" y="%d">Collection median</text>`+"\n",
+		legendY)
+
+	buf.WriteString("</svg>\n")
+	return buf.Bytes()
+}
+
+// Layout of SAS histograms.
+const (
+	histogramWidth  = 640
+	histogramHeight = 320
+	histogramLeft   = 50
+	histogramRight  = 20
+	histogramTop    = 40
+	histogramBottom = 40
+)
+
+// FormatSASHistogramSVG returns an SVG bar chart of the number of
+// decks in each SAS range.
+func FormatSASHistogramSVG(buckets []forgefs.SASBucket) []byte {
+	total, maxDecks := 0, 0
+	for _, b := range buckets {
+		total += b.Decks
+		if b.Decks > maxDecks {
+			maxDecks = b.Decks
+		}
+	}
+
+	var buf bytes.Buffer
+	title := fmt.Sprintf("SAS distribution (%d decks)", total)
+	startSVG(&buf, histogramWidth, histogramHeight, title)
+	fmt.Fprintf(&buf, `<text x="%d" y="24" text-anchor="middle" `+
+		`font-size="16" font-weight="bold">%s</text>`+"\n",
+		histogramWidth/2, escapeSVGText(title))
+
+	plotW := float64(histogramWidth - histogramLeft - histogramRight)
+	plotH := float64(histogramHeight - histogramTop - histogramBottom)
+	bottom := float64(histogramHeight - histogramBottom)
+	fmt.Fprintf(&buf, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" `+
+		`stroke="black"/>`+"\n",
+		histogramLeft, bottom, histogramWidth-histogramRight, bottom)
+	fmt.Fprintf(&buf, `<line x1="%d" y1="%d" x2="%d" y2="%.1f" `+
+		`stroke="black"/>`+"\n",
+		histogramLeft, histogramTop, histogramLeft, bottom)
+	if len(buckets) == 0 || maxDecks == 0 {
+		fmt.Fprintf(&buf, `<text x="%d" y="%d" text-anchor="middle">`+
+			`No decks</text>`+"\n", histogramWidth/2, histogramHeight/2)
+		buf.WriteString("</svg>\n")
+		return buf.Bytes()
+	}
+
+	// Label the y axis with zero and the tallest bar.
+	fmt.Fprintf(&buf, `<text x="%d" y="%.1f" text-anchor="end" `+
+		`dominant-baseline="middle">0</text>`+"\n", histogramLeft-6, bottom)
+	fmt.Fprintf(&buf, `<text x="%d" y="%d" text-anchor="end" `+
+		`dominant-baseline="middle">%d</text>`+"\n",
+		histogramLeft-6, histogramTop, maxDecks)
+
+	barW := plotW / float64(len(buckets))
+	// Keep the x axis labels from overlapping.
+	labelEvery := int(math.Ceil(30 / barW))
+	for i, b := range buckets {
+		x := float64(histogramLeft) + float64(i)*barW
+		h := plotH * float64(b.Decks) / float64(maxDecks)
+		fmt.Fprintf(&buf, `<rect x="%.1f" y="%.1f" width="%.1f" `+
+			`height="%.1f" fill="#3478c8"><title>%d-%d: %d</title>`+
+			`</rect>`+"\n",
+			x+1, bottom-h, math.Max(barW-2, 1), h, b.Min, b.Max, b.Decks)
+		if i%labelEvery == 0 {
+			fmt.Fprintf(&buf, `<text x="%.1f" y="%.1f" `+
+				`text-anchor="middle">%d</text>`+"\n",
+				x+barW/2, bottom+16, b.Min)
+		}
+	}
+	fmt.Fprintf(&buf, `<text x="%d" y="%d" text-anchor="middle">SAS</text>`+
+		"\n", histogramLeft+int(plotW)/2, histogramHeight-6)
+
+	buf.WriteString("</svg>\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,81 @@
+package fsutil
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/strib/forgefs"
+)
+
+// checkSVG makes sure `data` is well-formed XML with an `svg` root, and
+// returns the names of all its elements.
+func checkSVG(t *testing.T, data []byte) []string {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var names []string
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if se, ok := tok.(xml.StartElement); ok {
+			names = append(names, se.Name.Local)
+		}
+	}
+	require.NotEmpty(t, names)
+	require.Equal(t, "svg", names[0])
+	return names
+}
+
+func TestFormatDeckRadarSVG(t *testing.T) {
+	data := FormatDeckRadarSVG("Deck <1>", forgefs.StatValues{
+		A: 10, E: 20, R: 1.5, C: 8, F: 12, D: 3,
+	}, forgefs.StatValues{
+		A: 6, E: 18, R: 1, C: 10, F: 9, D: 0,
+	})
+	names := checkSVG(t, data)
+	// Four grid rings, plus the median and the deck.
+	count := 0
+	for _, name := range names {
+		if name == "polygon" {
+			count++
+		}
+	}
+	require.Equal(t, 6, count)
+	s := string(data)
+	require.Contains(t, s, "Deck &lt;1&gt;")
+	labels := []string{"A 10", "E 20", "R 1.5", "C 8", "F 12", "D 3"}
+	for _, label := range labels {
+		require.Contains(t, s, ">"+label+"<")
+	}
+	require.NotContains(t, s, "NaN")
+	require.NotContains(t, s, "Inf")
+}
+
+func TestFormatSASHistogramSVG(t *testing.T) {
+	data := FormatSASHistogramSVG([]forgefs.SASBucket{
+		{Min: 55, Max: 59, Decks: 1},
+		{Min: 60, Max: 64, Decks: 0},
+		{Min: 65, Max: 69, Decks: 4},
+	})
+	names := checkSVG(t, data)
+	bars := 0
+	for _, name := range names {
+		if name == "rect" {
+			bars++
+		}
+	}
+	// The background, plus one per bucket.
+	require.Equal(t, 4, bars)
+	s := string(data)
+	require.Contains(t, s, "SAS distribution (5 decks)")
+	require.Contains(t, s, "<title>65-69: 4</title>")
+
+	data = FormatSASHistogramSVG(nil)
+	checkSVG(t, data)
+	require.True(t, strings.Contains(string(data), "No decks"))
+}
@@ -3,13 +3,57 @@ package fsutil
 // File and directory names for a file-system representation of
 // Keyforge data.
 const (
-	CardsDir   = "cards"
-	MyDecksDir = "my-decks"
+	CardsDir    = "cards"
+	MyDecksDir  = "my-decks"
+	WishlistDir = "wishlist"
+	FunnyDir    = "funny"
+	SetsDir     = "sets"
+	TagsDir     = "tags"
+	CompareDir  = "compare"
+	SearchDir   = "search"
+	TraitsDir   = "traits"
+	StatsDir    = "stats"
+	ControlDir  = ".forgefs"
 
-	CardImagePrefix  = "image."
-	CardJSONFilename = "card.json"
+	CardImagePrefix       = "image."
+	CardThumbnailFilename = "image.thumb.jpg"
+	CardPNGFilename       = "image.png"
+	CardJSONFilename      = "card.json"
+	CardTextFilename      = "card.txt"
+	CardDecksDir          = "decks"
+	CardDecksFilename     = "decks.txt"
+	CardTraitsDir         = "traits"
+	CardSynergiesDir      = "synergies"
 
-	DeckJSONFilename  = "deck.json"
-	DeckCardsDir      = "cards"
-	DeckImageFilename = "deck.jpg"
+	RandomDeckLink       = ".random"
+	RandomDecksDirPrefix = ".random-"
+
+	TraitProvidersDir = "providers"
+	TraitSynergiesDir = "synergies"
+
+	DeckJSONFilename         = "deck.json"
+	DeckCardsDir             = "cards"
+	DeckImageFilename        = "deck.jpg"
+	DeckThumbnailFilename    = "deck.thumb.jpg"
+	DeckPNGFilename          = "deck.png"
+	DeckTextFilename         = "deck.txt"
+	DeckMarkdownFilename     = "deck.md"
+	DeckCSVFilename          = "deck.csv"
+	DeckNotesFilename        = "notes.md"
+	DeckProxiesFilename      = "proxies.pdf"
+	DeckContactSheetFilename = "cards.jpg"
+	DeckChartFilename        = "chart.svg"
+
+	StatsSummaryFilename      = "summary.json"
+	StatsByHouseFilename      = "by-house.csv"
+	StatsByExpansionFilename  = "by-expansion.csv"
+	StatsSASHistogramFilename = "sas-histogram.csv"
+	StatsSASChartFilename     = "sas.svg"
+
+	StatusFilename     = "status"
+	ControlFilename    = "control"
+	ControlLogFilename = "log"
+
+	DiffTextFilename = "diff.txt"
+	DiffJSONFilename = "diff.json"
 )
@@ -0,0 +1,157 @@
+package fsutil
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+)
+
+// Defaults for the layout of deck contact sheets.
+const (
+	DefaultContactSheetColumns = 6
+	DefaultContactSheetScale   = 0.5
+)
+
+// ContactSheetOptions configures the layout of deck contact sheets.
+type ContactSheetOptions struct {
+	// Columns is the number of cards in each row.
+	Columns int
+	// Scale is the size of each card relative to its full-size image.
+	Scale float64
+}
+
+// withDefaults returns a copy of the options, with any unset values
+// replaced by the defaults.
+func (o ContactSheetOptions) withDefaults() ContactSheetOptions {
+	if o.Columns <= 0 {
+		o.Columns = DefaultContactSheetColumns
+	}
+	if o.Scale <= 0 {
+		o.Scale = DefaultContactSheetScale
+	}
+	return o
+}
+
+// scaleImage returns a copy of `src` resized to `width`x`height`.
+// Each destination pixel is the average of the source pixels it
+// covers, which keeps card text legible when shrinking.
+func scaleImage(src image.Image, width, height int) *image.RGBA {
+	bounds := src.Bounds()
+	rgba, ok := src.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(bounds)
+		draw.Draw(rgba, bounds, src, bounds.Min, draw.Src)
+	}
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * srcH / height
+		y1 := (y + 1) * srcH / height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := x * srcW / width
+			x1 := (x + 1) * srcW / width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				off := rgba.PixOffset(bounds.Min.X+x0, bounds.Min.Y+sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(rgba.Pix[off])
+					g += uint32(rgba.Pix[off+1])
+					b += uint32(rgba.Pix[off+2])
+					a += uint32(rgba.Pix[off+3])
+					n++
+					off += 4
+				}
+			}
+			off := dst.PixOffset(x, y)
+			dst.Pix[off] = uint8(r / n)
+			dst.Pix[off+1] = uint8(g / n)
+			dst.Pix[off+2] = uint8(b / n)
+			dst.Pix[off+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// FormatContactSheetJPEG returns a JPEG showing the given card
+// images, with each house starting on a new row.  `houses` holds the
+// image data of each card, grouped by house.  Every card is drawn at
+// the size of the first image, scaled by `opts.Scale`.
+func FormatContactSheetJPEG(
+	houses [][][]byte, opts ContactSheetOptions) ([]byte, error) {
+	opts = opts.withDefaults()
+
+	var cellW, cellH, rows, columns int
+	decoded := make([][]image.Image, 0, len(houses))
+	for _, house := range houses {
+		if len(house) == 0 {
+			continue
+		}
+		imgs := make([]image.Image, len(house))
+		for j, data := range house {
+			img, _, err := image.Decode(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			if cellW == 0 {
+				cellW = int(float64(img.Bounds().Dx())*opts.Scale + 0.5)
+				cellH = int(float64(img.Bounds().Dy())*opts.Scale + 0.5)
+			}
+			imgs[j] = img
+		}
+		decoded = append(decoded, imgs)
+		rows += (len(house) + opts.Columns - 1) / opts.Columns
+		if len(house) > columns {
+			columns = len(house)
+		}
+	}
+	if cellW <= 0 || cellH <= 0 {
+		return nil, errors.New("No card images for the contact sheet")
+	}
+	if columns > opts.Columns {
+		columns = opts.Columns
+	}
+
+	// Leave a small gap between cards, and a bigger one between
+	// houses.
+	gap := cellW / 20
+	if gap < 1 {
+		gap = 1
+	}
+	houseGap := 4 * gap
+	width := columns*cellW + (columns+1)*gap
+	height := rows*cellH + (rows-len(decoded))*gap +
+		(len(decoded)-1)*houseGap + 2*gap
+	sheet := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(sheet, sheet.Bounds(), image.White, image.Point{}, draw.Src)
+
+	y := gap
+	for _, house := range decoded {
+		for j, img := range house {
+			col := j % opts.Columns
+			if j > 0 && col == 0 {
+				y += cellH + gap
+			}
+			x := gap + col*(cellW+gap)
+			scaled := scaleImage(img, cellW, cellH)
+			draw.Draw(sheet, image.Rect(x, y, x+cellW, y+cellH),
+				scaled, image.Point{}, draw.Over)
+		}
+		y += cellH + houseGap
+	}
+
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, sheet, &jpeg.Options{Quality: jpegQuality})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,60 @@
+package fsutil
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScaleImage(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		src.Set(x, 0, color.RGBA{200, 0, 0, 255})
+		src.Set(x, 1, color.RGBA{0, 0, 100, 255})
+	}
+	dst := scaleImage(src, 2, 1)
+	require.Equal(t, image.Rect(0, 0, 2, 1), dst.Bounds())
+	require.Equal(t, color.RGBA{100, 0, 50, 255}, dst.RGBAAt(0, 0))
+	require.Equal(t, color.RGBA{100, 0, 50, 255}, dst.RGBAAt(1, 0))
+}
+
+func TestFormatContactSheetJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 100, 140)))
+	require.NoError(t, err)
+	card := buf.Bytes()
+
+	houses := make([][][]byte, 3)
+	for i := range houses {
+		for j := 0; j < 12; j++ {
+			houses[i] = append(houses[i], card)
+		}
+	}
+
+	// Each house takes two rows of six cards, each half size.
+	data, err := FormatContactSheetJPEG(houses, ContactSheetOptions{})
+	require.NoError(t, err)
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	gap := 50 / 20
+	require.Equal(t, 6*50+7*gap, img.Bounds().Dx())
+	require.Equal(t, 6*70+3*gap+2*4*gap+2*gap, img.Bounds().Dy())
+
+	// One row per house, at full size.
+	data, err = FormatContactSheetJPEG(
+		houses, ContactSheetOptions{Columns: 12, Scale: 1})
+	require.NoError(t, err)
+	img, err = jpeg.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	gap = 100 / 20
+	require.Equal(t, 12*100+13*gap, img.Bounds().Dx())
+	require.Equal(t, 3*140+2*4*gap+2*gap, img.Bounds().Dy())
+
+	_, err = FormatContactSheetJPEG(nil, ContactSheetOptions{})
+	require.Error(t, err)
+}
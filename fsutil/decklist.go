@@ -0,0 +1,151 @@
+package fsutil
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/strib/forgefs"
+)
+
+// This file formats decks into human-readable decklists, suitable for
+// pasting into chats and spreadsheets.  Cards are listed house by
+// house, in the order they were printed in the deck.  `cards` maps a
+// card title to the full stored card data; cards missing from the map
+// are listed without their type.
+
+func formatStat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func cardAnnotations(c forgefs.CardInDeck) []string {
+	var annotations []string
+	if c.Maverick {
+		annotations = append(annotations, "Maverick")
+	}
+	if c.Legacy {
+		annotations = append(annotations, "Legacy")
+	}
+	if c.Anomaly {
+		annotations = append(annotations, "Anomaly")
+	}
+	return annotations
+}
+
+func cardDetails(
+	c forgefs.CardInDeck, cards map[string]*forgefs.Card) []string {
+	var details []string
+	if card, ok := cards[c.CardTitle]; ok && card.CardType != "" {
+		details = append(details, card.CardType)
+	}
+	if c.Rarity != "" {
+		details = append(details, c.Rarity)
+	}
+	return details
+}
+
+// FormatDeckText returns a plain-text decklist for the given deck.
+func FormatDeckText(
+	deck *forgefs.Deck, cards map[string]*forgefs.Card) []byte {
+	info := deck.DeckInfo
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s\n", info.Name)
+	fmt.Fprintf(&buf, "%s | SAS %d | AERC %d\n",
+		ExpansionShortName(info.Expansion), info.SasRating, info.AercScore)
+	fmt.Fprintf(&buf, "A %s | E %s | R %s | C %s | F %s | D %s\n",
+		formatStat(info.AmberControl), formatStat(info.ExpectedAmber),
+		formatStat(info.ArtifactControl), formatStat(info.CreatureControl),
+		formatStat(info.Efficiency), formatStat(info.Disruption))
+
+	for _, house := range info.Houses {
+		fmt.Fprintf(&buf, "\n%s\n", house.House)
+		for i, c := range house.Cards {
+			fmt.Fprintf(&buf, "%2d. %s", i+1, c.CardTitle)
+			if details := cardDetails(c, cards); len(details) > 0 {
+				fmt.Fprintf(&buf, " (%s)", strings.Join(details, ", "))
+			}
+			if annotations := cardAnnotations(c); len(annotations) > 0 {
+				fmt.Fprintf(&buf, " [%s]", strings.Join(annotations, ", "))
+			}
+			buf.WriteString("\n")
+		}
+	}
+	return buf.Bytes()
+}
+
+// FormatDeckMarkdown returns a Markdown decklist for the given deck.
+func FormatDeckMarkdown(
+	deck *forgefs.Deck, cards map[string]*forgefs.Card) []byte {
+	info := deck.DeckInfo
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# %s\n\n", info.Name)
+	fmt.Fprintf(&buf, "**%s** · SAS %d · AERC %d\n\n",
+		ExpansionShortName(info.Expansion), info.SasRating, info.AercScore)
+	buf.WriteString("| A | E | R | C | F | D |\n")
+	buf.WriteString("|---|---|---|---|---|---|\n")
+	fmt.Fprintf(&buf, "| %s | %s | %s | %s | %s | %s |\n",
+		formatStat(info.AmberControl), formatStat(info.ExpectedAmber),
+		formatStat(info.ArtifactControl), formatStat(info.CreatureControl),
+		formatStat(info.Efficiency), formatStat(info.Disruption))
+
+	for _, house := range info.Houses {
+		fmt.Fprintf(&buf, "\n## %s\n\n", house.House)
+		for i, c := range house.Cards {
+			fmt.Fprintf(&buf, "%d. %s", i+1, c.CardTitle)
+			if details := cardDetails(c, cards); len(details) > 0 {
+				fmt.Fprintf(&buf, " — %s", strings.Join(details, ", "))
+			}
+			if annotations := cardAnnotations(c); len(annotations) > 0 {
+				fmt.Fprintf(&buf, " *(%s)*", strings.Join(annotations, ", "))
+			}
+			buf.WriteString("\n")
+		}
+	}
+	return buf.Bytes()
+}
+
+// FormatDeckCSV returns a CSV decklist for the given deck.  The first
+// two rows hold the deck's name and stats, followed by an empty row
+// and then one row per card.
+func FormatDeckCSV(
+	deck *forgefs.Deck, cards map[string]*forgefs.Card) ([]byte, error) {
+	info := deck.DeckInfo
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	records := [][]string{
+		{"name", "expansion", "sas", "aerc", "a", "e", "r", "c", "f", "d"},
+		{
+			info.Name, ExpansionShortName(info.Expansion),
+			strconv.Itoa(info.SasRating), strconv.Itoa(info.AercScore),
+			formatStat(info.AmberControl), formatStat(info.ExpectedAmber),
+			formatStat(info.ArtifactControl),
+			formatStat(info.CreatureControl),
+			formatStat(info.Efficiency), formatStat(info.Disruption),
+		},
+		{},
+		{
+			"house", "position", "title", "type", "rarity", "maverick",
+			"legacy", "anomaly",
+		},
+	}
+	for _, house := range info.Houses {
+		for i, c := range house.Cards {
+			var cardType string
+			if card, ok := cards[c.CardTitle]; ok {
+				cardType = card.CardType
+			}
+			records = append(records, []string{
+				house.House, strconv.Itoa(i + 1), c.CardTitle, cardType,
+				c.Rarity, strconv.FormatBool(c.Maverick),
+				strconv.FormatBool(c.Legacy), strconv.FormatBool(c.Anomaly),
+			})
+		}
+	}
+	err := w.WriteAll(records)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,70 @@
+package fsutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/strib/forgefs"
+)
+
+func TestFormatDeck(t *testing.T) {
+	deck := &forgefs.Deck{
+		DeckInfo: forgefs.DeckInfo{
+			Name:            "Test Deck",
+			Expansion:       "MASS_MUTATION",
+			SasRating:       70,
+			AercScore:       65,
+			AmberControl:    8.5,
+			ExpectedAmber:   20,
+			ArtifactControl: 1.2,
+			CreatureControl: 9,
+			Efficiency:      11.25,
+			Disruption:      3,
+			Houses: []forgefs.HouseInDeck{
+				{
+					House: "Logos",
+					Cards: []forgefs.CardInDeck{
+						{CardTitle: "Library Access", Rarity: "Uncommon"},
+						{CardTitle: "Anger", Rarity: "Common", Maverick: true},
+					},
+				},
+			},
+		},
+	}
+	cards := map[string]*forgefs.Card{
+		"Library Access": {CardTitle: "Library Access", CardType: "Action"},
+	}
+
+	require.Equal(t, `Test Deck
+MM | SAS 70 | AERC 65
+A 8.5 | E 20 | R 1.2 | C 9 | F 11.25 | D 3
+
+Logos
+ 1. Library Access (Action, Uncommon)
+ 2. Anger (Common) [Maverick]
+`, string(FormatDeckText(deck, cards)))
+
+	require.Equal(t, `# Test Deck
+
+**MM** · SAS 70 · AERC 65
+
+| A | E | R | C | F | D |
+|---|---|---|---|---|---|
+| 8.5 | 20 | 1.2 | 9 | 11.25 | 3 |
+
+## Logos
+
+1. Library Access — Action, Uncommon
+2. Anger — Common *(Maverick)*
+`, string(FormatDeckMarkdown(deck, cards)))
+
+	csv, err := FormatDeckCSV(deck, cards)
+	require.NoError(t, err)
+	require.Equal(t, `name,expansion,sas,aerc,a,e,r,c,f,d
+Test Deck,MM,70,65,8.5,20,1.2,9,11.25,3
+
+house,position,title,type,rarity,maverick,legacy,anomaly
+Logos,1,Library Access,Action,Uncommon,false,false,false
+Logos,2,Anger,,Common,true,false,false
+`, string(csv))
+}
@@ -0,0 +1,79 @@
+package fsutil
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+)
+
+// DefaultThumbnailSize is the default maximum width or height of
+// image thumbnails, in pixels.
+const DefaultThumbnailSize = 256
+
+// ImageVariant is a kind of image derived from an original card or
+// deck image.
+type ImageVariant int
+
+const (
+	// ImageVariantThumbnail is a small JPEG version of the image.
+	ImageVariantThumbnail ImageVariant = iota
+	// ImageVariantPNG is the full-size image, converted to PNG.
+	ImageVariantPNG
+)
+
+// FormatThumbnailJPEG returns a JPEG version of the given image,
+// shrunk so that neither dimension is bigger than `maxSize`.  Images
+// that are already small enough keep their size.  Transparent areas
+// become white.
+func FormatThumbnailJPEG(data []byte, maxSize int) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	if width > maxSize || height > maxSize {
+		if width >= height {
+			height = height * maxSize / width
+			width = maxSize
+		} else {
+			width = width * maxSize / height
+			height = maxSize
+		}
+		if width < 1 {
+			width = 1
+		}
+		if height < 1 {
+			height = 1
+		}
+		img = scaleImage(img, width, height)
+	}
+
+	bounds := image.Rect(0, 0, width, height)
+	thumb := image.NewRGBA(bounds)
+	draw.Draw(thumb, bounds, image.White, image.Point{}, draw.Src)
+	draw.Draw(thumb, bounds, img, img.Bounds().Min, draw.Over)
+
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: jpegQuality})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// FormatPNG returns a PNG version of the given image.
+func FormatPNG(data []byte) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
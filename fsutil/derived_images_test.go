@@ -0,0 +1,45 @@
+package fsutil
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDerivedImages(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 300, 420))
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	require.NoError(t, err)
+
+	thumb, err := FormatThumbnailJPEG(buf.Bytes(), 100)
+	require.NoError(t, err)
+	config, format, err := image.DecodeConfig(bytes.NewReader(thumb))
+	require.NoError(t, err)
+	require.Equal(t, "jpeg", format)
+	require.Equal(t, 71, config.Width)
+	require.Equal(t, 100, config.Height)
+
+	// Small images aren't scaled up.
+	thumb, err = FormatThumbnailJPEG(buf.Bytes(), 1000)
+	require.NoError(t, err)
+	config, _, err = image.DecodeConfig(bytes.NewReader(thumb))
+	require.NoError(t, err)
+	require.Equal(t, 300, config.Width)
+	require.Equal(t, 420, config.Height)
+
+	pngData, err := FormatPNG(thumb)
+	require.NoError(t, err)
+	config, format, err = image.DecodeConfig(bytes.NewReader(pngData))
+	require.NoError(t, err)
+	require.Equal(t, "png", format)
+	require.Equal(t, 300, config.Width)
+
+	_, err = FormatPNG([]byte{1, 2, 3})
+	require.Error(t, err)
+}
@@ -0,0 +1,224 @@
+package fsutil
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/strib/forgefs"
+)
+
+// DeckDiffDeck identifies one side of a deck comparison.
+type DeckDiffDeck struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// StatDiff compares one stat between two decks.  `Delta` is the
+// second deck's value minus the first deck's value.
+type StatDiff struct {
+	Name  string  `json:"name"`
+	A     float64 `json:"a"`
+	B     float64 `json:"b"`
+	Delta float64 `json:"delta"`
+}
+
+// HouseDiff splits the houses of two decks into the ones they share
+// and the ones unique to each deck.
+type HouseDiff struct {
+	Shared []string `json:"shared"`
+	OnlyA  []string `json:"onlyA"`
+	OnlyB  []string `json:"onlyB"`
+}
+
+// CardCount is a card title and how many copies of it are counted.
+type CardCount struct {
+	Title string `json:"title"`
+	Count int    `json:"count"`
+}
+
+// CardDiff splits the cards of two decks into the copies they share
+// and the copies unique to each deck.
+type CardDiff struct {
+	Shared []CardCount `json:"shared"`
+	OnlyA  []CardCount `json:"onlyA"`
+	OnlyB  []CardCount `json:"onlyB"`
+}
+
+// DeckDiff is a comparison between two decks.
+type DeckDiff struct {
+	DeckA  DeckDiffDeck `json:"deckA"`
+	DeckB  DeckDiffDeck `json:"deckB"`
+	Stats  []StatDiff   `json:"stats"`
+	Houses HouseDiff    `json:"houses"`
+	Cards  CardDiff     `json:"cards"`
+}
+
+func deckStats(info forgefs.DeckInfo) []StatDiff {
+	return []StatDiff{
+		{Name: "sas", A: float64(info.SasRating)},
+		{Name: "aerc", A: float64(info.AercScore)},
+		{Name: "a", A: info.AmberControl},
+		{Name: "e", A: info.ExpectedAmber},
+		{Name: "r", A: info.ArtifactControl},
+		{Name: "c", A: info.CreatureControl},
+		{Name: "f", A: info.Efficiency},
+		{Name: "d", A: info.Disruption},
+	}
+}
+
+func deckCardCounts(info forgefs.DeckInfo) map[string]int {
+	counts := make(map[string]int)
+	for _, house := range info.Houses {
+		for _, c := range house.Cards {
+			counts[c.CardTitle]++
+		}
+	}
+	return counts
+}
+
+func sortedCardCounts(counts map[string]int) []CardCount {
+	ccs := make([]CardCount, 0, len(counts))
+	for title, count := range counts {
+		ccs = append(ccs, CardCount{Title: title, Count: count})
+	}
+	sort.Slice(ccs, func(i, j int) bool {
+		return ccs[i].Title < ccs[j].Title
+	})
+	return ccs
+}
+
+// CompareDecks compares deck `a` with deck `b`.
+func CompareDecks(a, b *forgefs.Deck) *DeckDiff {
+	diff := &DeckDiff{
+		DeckA: DeckDiffDeck{ID: a.DeckInfo.KeyforgeID, Name: a.DeckInfo.Name},
+		DeckB: DeckDiffDeck{ID: b.DeckInfo.KeyforgeID, Name: b.DeckInfo.Name},
+		Stats: deckStats(a.DeckInfo),
+		Houses: HouseDiff{
+			Shared: []string{},
+			OnlyA:  []string{},
+			OnlyB:  []string{},
+		},
+	}
+	for i, s := range deckStats(b.DeckInfo) {
+		diff.Stats[i].B = s.A
+		diff.Stats[i].Delta = s.A - diff.Stats[i].A
+	}
+
+	bHouses := make(map[string]bool, len(b.DeckInfo.Houses))
+	for _, h := range b.DeckInfo.Houses {
+		bHouses[h.House] = true
+	}
+	aHouses := make(map[string]bool, len(a.DeckInfo.Houses))
+	for _, h := range a.DeckInfo.Houses {
+		aHouses[h.House] = true
+		if bHouses[h.House] {
+			diff.Houses.Shared = append(diff.Houses.Shared, h.House)
+		} else {
+			diff.Houses.OnlyA = append(diff.Houses.OnlyA, h.House)
+		}
+	}
+	for _, h := range b.DeckInfo.Houses {
+		if !aHouses[h.House] {
+			diff.Houses.OnlyB = append(diff.Houses.OnlyB, h.House)
+		}
+	}
+
+	aCards := deckCardCounts(a.DeckInfo)
+	bCards := deckCardCounts(b.DeckInfo)
+	shared := make(map[string]int)
+	onlyA := make(map[string]int)
+	for title, aCount := range aCards {
+		bCount := bCards[title]
+		switch {
+		case aCount > bCount:
+			onlyA[title] = aCount - bCount
+			if bCount > 0 {
+				shared[title] = bCount
+			}
+		default:
+			shared[title] = aCount
+		}
+	}
+	onlyB := make(map[string]int)
+	for title, bCount := range bCards {
+		if bCount > aCards[title] {
+			onlyB[title] = bCount - aCards[title]
+		}
+	}
+	diff.Cards = CardDiff{
+		Shared: sortedCardCounts(shared),
+		OnlyA:  sortedCardCounts(onlyA),
+		OnlyB:  sortedCardCounts(onlyB),
+	}
+	return diff
+}
+
+var statLabels = map[string]string{
+	"sas":  "SAS",
+	"aerc": "AERC",
+	"a":    "Amber control",
+	"e":    "Expected amber",
+	"r":    "Artifact control",
+	"c":    "Creature control",
+	"f":    "Efficiency",
+	"d":    "Disruption",
+}
+
+func formatDelta(f float64) string {
+	if f > 0 {
+		return "+" + formatStat(f)
+	}
+	return formatStat(f)
+}
+
+func formatCardCounts(buf *bytes.Buffer, header string, ccs []CardCount) {
+	fmt.Fprintf(buf, "  %s:", header)
+	if len(ccs) == 0 {
+		buf.WriteString(" none\n")
+		return
+	}
+	buf.WriteString("\n")
+	for _, cc := range ccs {
+		fmt.Fprintf(buf, "    %dx %s\n", cc.Count, cc.Title)
+	}
+}
+
+func formatHouses(houses []string) string {
+	if len(houses) == 0 {
+		return "none"
+	}
+	return strings.Join(houses, ", ")
+}
+
+// FormatDeckDiffText returns a human-readable version of the given
+// deck comparison.
+func FormatDeckDiffText(diff *DeckDiff) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "A: %s\n", diff.DeckA.Name)
+	fmt.Fprintf(&buf, "B: %s\n\n", diff.DeckB.Name)
+
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Stat\tA\tB\tDelta\n")
+	for _, s := range diff.Stats {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", statLabels[s.Name],
+			formatStat(s.A), formatStat(s.B), formatDelta(s.Delta))
+	}
+	// Writing to a buffer can't fail.
+	_ = w.Flush()
+
+	buf.WriteString("\nHouses\n")
+	fmt.Fprintf(&buf, "  Shared: %s\n", formatHouses(diff.Houses.Shared))
+	fmt.Fprintf(&buf, "  Only in %s: %s\n",
+		diff.DeckA.Name, formatHouses(diff.Houses.OnlyA))
+	fmt.Fprintf(&buf, "  Only in %s: %s\n",
+		diff.DeckB.Name, formatHouses(diff.Houses.OnlyB))
+
+	buf.WriteString("\nCards\n")
+	formatCardCounts(&buf, "Shared", diff.Cards.Shared)
+	formatCardCounts(&buf, "Only in "+diff.DeckA.Name, diff.Cards.OnlyA)
+	formatCardCounts(&buf, "Only in "+diff.DeckB.Name, diff.Cards.OnlyB)
+	return buf.Bytes()
+}
@@ -0,0 +1,111 @@
+package fsutil
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/strib/forgefs"
+)
+
+func TestCompareDecks(t *testing.T) {
+	a := &forgefs.Deck{
+		DeckInfo: forgefs.DeckInfo{
+			KeyforgeID:    "1",
+			Name:          "A",
+			SasRating:     70,
+			AercScore:     65,
+			AmberControl:  8.5,
+			ExpectedAmber: 20,
+			Houses: []forgefs.HouseInDeck{
+				{
+					House: "Logos",
+					Cards: []forgefs.CardInDeck{
+						{CardTitle: "Anger"},
+						{CardTitle: "Anger"},
+						{CardTitle: "Library Access"},
+					},
+				},
+				{
+					House: "Mars",
+					Cards: []forgefs.CardInDeck{{CardTitle: "Ammonia Clouds"}},
+				},
+			},
+		},
+	}
+	b := &forgefs.Deck{
+		DeckInfo: forgefs.DeckInfo{
+			KeyforgeID:    "2",
+			Name:          "B",
+			SasRating:     75,
+			AercScore:     60,
+			AmberControl:  8.5,
+			ExpectedAmber: 18.5,
+			Houses: []forgefs.HouseInDeck{
+				{
+					House: "Logos",
+					Cards: []forgefs.CardInDeck{
+						{CardTitle: "Anger"},
+						{CardTitle: "Dextre"},
+					},
+				},
+				{
+					House: "Dis",
+					Cards: []forgefs.CardInDeck{{CardTitle: "Gateway to Dis"}},
+				},
+			},
+		},
+	}
+
+	diff := CompareDecks(a, b)
+	require.Equal(t, StatDiff{"sas", 70, 75, 5}, diff.Stats[0])
+	require.Equal(t, StatDiff{"aerc", 65, 60, -5}, diff.Stats[1])
+	require.Equal(t, StatDiff{"e", 20, 18.5, -1.5}, diff.Stats[3])
+	require.Equal(t, []string{"Logos"}, diff.Houses.Shared)
+	require.Equal(t, []string{"Mars"}, diff.Houses.OnlyA)
+	require.Equal(t, []string{"Dis"}, diff.Houses.OnlyB)
+	require.Equal(t, []CardCount{{"Anger", 1}}, diff.Cards.Shared)
+	require.Equal(t, []CardCount{
+		{"Ammonia Clouds", 1}, {"Anger", 1}, {"Library Access", 1},
+	}, diff.Cards.OnlyA)
+	require.Equal(t, []CardCount{
+		{"Dextre", 1}, {"Gateway to Dis", 1},
+	}, diff.Cards.OnlyB)
+
+	require.Equal(t, `A: A
+B: B
+
+Stat              A    B     Delta
+SAS               70   75    +5
+AERC              65   60    -5
+Amber control     8.5  8.5   0
+Expected amber    20   18.5  -1.5
+Artifact control  0    0     0
+Creature control  0    0     0
+Efficiency        0    0     0
+Disruption        0    0     0
+
+Houses
+  Shared: Logos
+  Only in A: Mars
+  Only in B: Dis
+
+Cards
+  Shared:
+    1x Anger
+  Only in A:
+    1x Ammonia Clouds
+    1x Anger
+    1x Library Access
+  Only in B:
+    1x Dextre
+    1x Gateway to Dis
+`, string(FormatDeckDiffText(diff)))
+
+	j, err := json.Marshal(diff)
+	require.NoError(t, err)
+	var roundTrip DeckDiff
+	err = json.Unmarshal(j, &roundTrip)
+	require.NoError(t, err)
+	require.Equal(t, *diff, roundTrip)
+}
@@ -0,0 +1,20 @@
+package fsutil
+
+// ExpansionShortName returns the commonly-used acronym for the given
+// expansion enum name (e.g., "MM" for "MASS_MUTATION").  Unrecognized
+// expansions are returned unchanged.
+func ExpansionShortName(expansion string) string {
+	switch expansion {
+	case "CALL_OF_THE_ARCHONS":
+		return "CotA"
+	case "AGE_OF_ASCENSION":
+		return "AoA"
+	case "WORLDS_COLLIDE":
+		return "WC"
+	case "MASS_MUTATION":
+		return "MM"
+	case "DARK_TIDINGS":
+		return "DT"
+	}
+	return expansion
+}
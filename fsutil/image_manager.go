@@ -1,10 +1,15 @@
 package fsutil
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/strib/forgefs"
+	"github.com/strib/forgefs/util"
 )
 
 // ImageManager provides images to a file system, either from a local
@@ -13,20 +18,119 @@ type ImageManager struct {
 	cardFetcher forgefs.CardImageFetcher
 	deckFetcher forgefs.DeckImageFetcher
 	cache       forgefs.ImageCache
+
+	optsLock      sync.RWMutex
+	thumbnailSize int
+	contactSheet  ContactSheetOptions
+
+	// Counts of image lookups served from the cache, and of those
+	// that had to fetch or build the image.  Updated atomically.
+	cacheHits   int64
+	cacheMisses int64
+	// errs holds failures to build derived images; fetch failures
+	// are kept by the fetchers themselves.
+	errs util.ErrorLog
 }
 
-// NewImageManager creates a new ImageManager instance.
+// ImageManagerOptions configures the images an ImageManager derives
+// from the original card and deck images.
+type ImageManagerOptions struct {
+	// ThumbnailSize is the maximum width or height of thumbnails.
+	ThumbnailSize int
+	// ContactSheet is the layout of deck contact sheets.
+	ContactSheet ContactSheetOptions
+}
+
+// NewImageManager creates a new ImageManager instance.  Any unset
+// options use the defaults.
 func NewImageManager(
 	cardFetcher forgefs.CardImageFetcher, deckFetcher forgefs.DeckImageFetcher,
-	cache forgefs.ImageCache) *ImageManager {
-	return &ImageManager{
+	cache forgefs.ImageCache, opts ImageManagerOptions) *ImageManager {
+	im := &ImageManager{
 		cardFetcher: cardFetcher,
 		deckFetcher: deckFetcher,
 		cache:       cache,
 	}
+	im.SetOptions(opts)
+	return im
+}
+
+// SetOptions changes how images are derived from now on.  Images
+// derived with the old options stay cached, but aren't used.  Any
+// unset options use the defaults.
+func (im *ImageManager) SetOptions(opts ImageManagerOptions) {
+	thumbnailSize := opts.ThumbnailSize
+	if thumbnailSize <= 0 {
+		thumbnailSize = DefaultThumbnailSize
+	}
+	im.optsLock.Lock()
+	defer im.optsLock.Unlock()
+	im.thumbnailSize = thumbnailSize
+	im.contactSheet = opts.ContactSheet.withDefaults()
+}
+
+func (im *ImageManager) options() (
+	thumbnailSize int, contactSheet ContactSheetOptions) {
+	im.optsLock.RLock()
+	defer im.optsLock.RUnlock()
+	return im.thumbnailSize, im.contactSheet
+}
+
+// DropCache deletes every cached image, so that they're fetched or
+// derived again the next time they're needed.
+func (im *ImageManager) DropCache(ctx context.Context) error {
+	return im.cache.Clear(ctx)
+}
+
+func (im *ImageManager) countLookup(hit bool) {
+	if hit {
+		atomic.AddInt64(&im.cacheHits, 1)
+	} else {
+		atomic.AddInt64(&im.cacheMisses, 1)
+	}
+}
+
+// CacheStats returns the number of image lookups served from the
+// cache, and the number that had to fetch or build the image.
+func (im *ImageManager) CacheStats() (hits, misses int64) {
+	return atomic.LoadInt64(&im.cacheHits), atomic.LoadInt64(&im.cacheMisses)
+}
+
+func (im *ImageManager) fetcherReporters() []forgefs.StatsReporter {
+	var reporters []forgefs.StatsReporter
+	if sr, ok := im.cardFetcher.(forgefs.StatsReporter); ok {
+		reporters = append(reporters, sr)
+	}
+	if sr, ok := im.deckFetcher.(forgefs.StatsReporter); ok {
+		reporters = append(reporters, sr)
+	}
+	return reporters
+}
+
+// ClientStats returns the activity of the image fetchers, for those
+// that keep track of it.
+func (im *ImageManager) ClientStats() []forgefs.ClientStats {
+	reporters := im.fetcherReporters()
+	stats := make([]forgefs.ClientStats, 0, len(reporters))
+	for _, sr := range reporters {
+		stats = append(stats, sr.ClientStats())
+	}
+	return stats
+}
+
+// RecentErrors returns the most recent errors from building images
+// and from the image fetchers.
+func (im *ImageManager) RecentErrors() []forgefs.ErrorRecord {
+	errs := im.errs.Recent()
+	for _, sr := range im.fetcherReporters() {
+		errs = append(errs, sr.RecentErrors()...)
+	}
+	return errs
 }
 
-func getImageURLSuffix(imageURL string) string {
+// ImageURLSuffix returns the file suffix of the given image URL,
+// without the leading ".".
+func ImageURLSuffix(imageURL string) string {
 	split := strings.Split(imageURL, ".")
 	suffix := ""
 	if len(split) > 1 {
@@ -35,24 +139,50 @@ func getImageURLSuffix(imageURL string) string {
 	return suffix
 }
 
-// GetCardImage gets the image data for the given card.
+// GetCardImage gets the image data for the given card, as printed in
+// the given expansion.  An empty `expansion` refers to the card's
+// default image.
 func (im *ImageManager) GetCardImage(
-	ctx context.Context, cardID, imageURL string) ([]byte, error) {
-	suffix := getImageURLSuffix(imageURL)
-	data, ok, err := im.cache.GetCardImage(ctx, cardID, suffix)
+	ctx context.Context, cardID, expansion, imageURL string) (
+	[]byte, error) {
+	suffix := ImageURLSuffix(imageURL)
+	data, ok, err := im.cache.GetCardImage(ctx, cardID, expansion, suffix)
 	if err != nil {
 		return nil, err
 	}
+	im.countLookup(ok)
 	if ok {
 		return data, nil
 	}
+	return im.fetchCardImage(ctx, cardID, expansion, imageURL)
+}
 
-	data, err = im.cardFetcher.GetCardImage(ctx, imageURL)
+// getCardImage is like GetCardImage, but leaves the lookup out of the
+// stats, for callers that already counted their own.
+func (im *ImageManager) getCardImage(
+	ctx context.Context, cardID, expansion, imageURL string) (
+	[]byte, error) {
+	data, ok, err := im.cache.GetCardImage(
+		ctx, cardID, expansion, ImageURLSuffix(imageURL))
 	if err != nil {
 		return nil, err
 	}
+	if ok {
+		return data, nil
+	}
+	return im.fetchCardImage(ctx, cardID, expansion, imageURL)
+}
 
-	err = im.cache.StoreCardImage(ctx, cardID, suffix, data)
+func (im *ImageManager) fetchCardImage(
+	ctx context.Context, cardID, expansion, imageURL string) (
+	[]byte, error) {
+	data, err := im.cardFetcher.GetCardImage(ctx, imageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	err = im.cache.StoreCardImage(
+		ctx, cardID, expansion, ImageURLSuffix(imageURL), data)
 	if err != nil {
 		return nil, err
 	}
@@ -60,6 +190,21 @@ func (im *ImageManager) GetCardImage(
 	return data, nil
 }
 
+// GetCardImageSize returns the size of the image data for the given
+// card and expansion, and `true`, if it is available without fetching
+// the image.
+func (im *ImageManager) GetCardImageSize(
+	ctx context.Context, cardID, expansion, imageURL string) (
+	uint64, bool, error) {
+	suffix := ImageURLSuffix(imageURL)
+	size, ok, err := im.cache.GetCardImageSize(
+		ctx, cardID, expansion, suffix)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	return uint64(size), true, nil
+}
+
 // GetDeckImage gets the image data for the given deck.
 func (im *ImageManager) GetDeckImage(
 	ctx context.Context, deckID string) ([]byte, error) {
@@ -68,19 +213,381 @@ func (im *ImageManager) GetDeckImage(
 	if err != nil {
 		return nil, err
 	}
+	im.countLookup(ok)
+	if ok {
+		return data, nil
+	}
+	return im.fetchDeckImage(ctx, deckID)
+}
+
+// getDeckImage is like GetDeckImage, but leaves the lookup out of the
+// stats, for callers that already counted their own.
+func (im *ImageManager) getDeckImage(
+	ctx context.Context, deckID string) ([]byte, error) {
+	data, ok, err := im.cache.GetDeckImage(
+		ctx, deckID, im.deckFetcher.GetDeckImageSuffix())
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return data, nil
+	}
+	return im.fetchDeckImage(ctx, deckID)
+}
+
+func (im *ImageManager) fetchDeckImage(
+	ctx context.Context, deckID string) ([]byte, error) {
+	data, err := im.deckFetcher.GetDeckImage(ctx, deckID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = im.cache.StoreDeckImage(
+		ctx, deckID, im.deckFetcher.GetDeckImageSuffix(), data)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// GetDeckImageSize returns the size of the image data for the given
+// deck, and `true`, if it is available without fetching the image.
+func (im *ImageManager) GetDeckImageSize(
+	ctx context.Context, deckID string) (uint64, bool, error) {
+	suffix := im.deckFetcher.GetDeckImageSuffix()
+	size, ok, err := im.cache.GetDeckImageSize(ctx, deckID, suffix)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	return uint64(size), true, nil
+}
+
+// variantFileType returns the file type a derived image is cached
+// under.  The thumbnail size is part of it, so that changing the
+// config regenerates thumbnails.
+func (im *ImageManager) variantFileType(variant ImageVariant) string {
+	switch variant {
+	case ImageVariantThumbnail:
+		thumbnailSize, _ := im.options()
+		return fmt.Sprintf("thumb%d.jpg", thumbnailSize)
+	default:
+		return "png"
+	}
+}
+
+func (im *ImageManager) formatVariant(
+	variant ImageVariant, data []byte) ([]byte, error) {
+	switch variant {
+	case ImageVariantThumbnail:
+		thumbnailSize, _ := im.options()
+		return FormatThumbnailJPEG(data, thumbnailSize)
+	default:
+		return FormatPNG(data)
+	}
+}
+
+// GetCardImageVariant gets the given variant of the default image for
+// the given card, deriving it from the original image if it isn't
+// cached yet.
+func (im *ImageManager) GetCardImageVariant(
+	ctx context.Context, cardID, imageURL string, variant ImageVariant) (
+	[]byte, error) {
+	fileType := im.variantFileType(variant)
+	data, ok, err := im.cache.GetCardImage(ctx, cardID, "", fileType)
+	if err != nil {
+		return nil, err
+	}
+	im.countLookup(ok)
+	if ok {
+		return data, nil
+	}
+
+	orig, err := im.getCardImage(ctx, cardID, "", imageURL)
+	if err != nil {
+		return nil, err
+	}
+	data, err = im.formatVariant(variant, orig)
+	if err != nil {
+		im.errs.Add("images "+cardID+" "+fileType, err)
+		return nil, err
+	}
+
+	err = im.cache.StoreCardImage(ctx, cardID, "", fileType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// GetCardImageVariantSize returns the size of the given variant of
+// the given card's image, and `true`, if it is available without
+// deriving it.
+func (im *ImageManager) GetCardImageVariantSize(
+	ctx context.Context, cardID string, variant ImageVariant) (
+	uint64, bool, error) {
+	size, ok, err := im.cache.GetCardImageSize(
+		ctx, cardID, "", im.variantFileType(variant))
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	return uint64(size), true, nil
+}
+
+// GetDeckImageVariant gets the given variant of the image for the
+// given deck, deriving it from the original image if it isn't cached
+// yet.
+func (im *ImageManager) GetDeckImageVariant(
+	ctx context.Context, deckID string, variant ImageVariant) (
+	[]byte, error) {
+	return im.getDerivedDeckImage(
+		ctx, deckID, im.variantFileType(variant), func() ([]byte, error) {
+			orig, err := im.getDeckImage(ctx, deckID)
+			if err != nil {
+				return nil, err
+			}
+			return im.formatVariant(variant, orig)
+		})
+}
+
+// GetDeckImageVariantSize returns the size of the given variant of
+// the given deck's image, and `true`, if it is available without
+// deriving it.
+func (im *ImageManager) GetDeckImageVariantSize(
+	ctx context.Context, deckID string, variant ImageVariant) (
+	uint64, bool, error) {
+	return im.getDerivedDeckImageSize(ctx, deckID, im.variantFileType(variant))
+}
+
+// getDerivedDeckImage returns the cached file of the given type for a
+// deck, first building it with `build` if it isn't cached yet.
+func (im *ImageManager) getDerivedDeckImage(
+	ctx context.Context, deckID, fileType string,
+	build func() ([]byte, error)) ([]byte, error) {
+	data, ok, err := im.cache.GetDeckImage(ctx, deckID, fileType)
+	if err != nil {
+		return nil, err
+	}
+	im.countLookup(ok)
 	if ok {
 		return data, nil
 	}
 
-	data, err = im.deckFetcher.GetDeckImage(ctx, deckID)
+	data, err = build()
 	if err != nil {
+		im.errs.Add("images "+deckID+" "+fileType, err)
 		return nil, err
 	}
 
-	err = im.cache.StoreDeckImage(ctx, deckID, suffix, data)
+	err = im.cache.StoreDeckImage(ctx, deckID, fileType, data)
 	if err != nil {
 		return nil, err
 	}
 
 	return data, nil
 }
+
+func (im *ImageManager) getDerivedDeckImageSize(
+	ctx context.Context, deckID, fileType string) (uint64, bool, error) {
+	size, ok, err := im.cache.GetDeckImageSize(ctx, deckID, fileType)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	return uint64(size), true, nil
+}
+
+func proxySheetFileType(sasVersion int) string {
+	return fmt.Sprintf("proxies.%d.pdf", sasVersion)
+}
+
+// GetDeckProxySheet gets a printable PDF of the card images in the
+// given deck.  It's cached alongside the deck image, and regenerated
+// from the images returned by `getImages` whenever the deck's SAS
+// version changes.
+func (im *ImageManager) GetDeckProxySheet(
+	ctx context.Context, deckID string, sasVersion int,
+	getImages func(context.Context) ([][]byte, error)) ([]byte, error) {
+	return im.getDerivedDeckImage(
+		ctx, deckID, proxySheetFileType(sasVersion), func() ([]byte, error) {
+			images, err := getImages(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return FormatProxySheetPDF(images)
+		})
+}
+
+// GetDeckProxySheetSize returns the size of the proxy sheet for the
+// given deck, and `true`, if it is available without generating it.
+func (im *ImageManager) GetDeckProxySheetSize(
+	ctx context.Context, deckID string, sasVersion int) (
+	uint64, bool, error) {
+	return im.getDerivedDeckImageSize(
+		ctx, deckID, proxySheetFileType(sasVersion))
+}
+
+// The layout is part of the cache key, so that changing the config
+// regenerates the sheet.
+func contactSheetFileType(
+	sasVersion int, layout ContactSheetOptions) string {
+	return fmt.Sprintf("cards.%d.%dx%g.jpg",
+		sasVersion, layout.Columns, layout.Scale)
+}
+
+// GetDeckContactSheet gets a JPEG showing the card images in the
+// given deck, grouped by house.  Like proxy sheets, it's cached
+// alongside the deck image, and regenerated from the images returned
+// by `getImages` whenever the deck's SAS version changes.
+func (im *ImageManager) GetDeckContactSheet(
+	ctx context.Context, deckID string, sasVersion int,
+	getImages func(context.Context) ([][][]byte, error)) ([]byte, error) {
+	_, layout := im.options()
+	return im.getDerivedDeckImage(
+		ctx, deckID, contactSheetFileType(sasVersion, layout),
+		func() ([]byte, error) {
+			houses, err := getImages(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return FormatContactSheetJPEG(houses, layout)
+		})
+}
+
+// GetDeckContactSheetSize returns the size of the contact sheet for
+// the given deck, and `true`, if it is available without generating
+// it.
+func (im *ImageManager) GetDeckContactSheetSize(
+	ctx context.Context, deckID string, sasVersion int) (
+	uint64, bool, error) {
+	_, layout := im.options()
+	return im.getDerivedDeckImageSize(
+		ctx, deckID, contactSheetFileType(sasVersion, layout))
+}
+
+// bytesImageFile serves an in-memory image as an ImageFile.
+type bytesImageFile struct {
+	*bytes.Reader
+}
+
+func (bif bytesImageFile) Close() error {
+	return nil
+}
+
+// openCached opens a cached file with `open`, first caching it with
+// `get` if needed.  If the cache didn't keep the data, it's served
+// from memory instead.
+func (im *ImageManager) openCached(
+	open func() (forgefs.ImageFile, int64, bool, error),
+	get func() ([]byte, error)) (forgefs.ImageFile, uint64, error) {
+	f, size, ok, err := open()
+	if err != nil {
+		return nil, 0, err
+	}
+	if ok {
+		// Misses are counted by `get`.
+		im.countLookup(true)
+		return f, uint64(size), nil
+	}
+
+	data, err := get()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	f, size, ok, err = open()
+	if err != nil {
+		return nil, 0, err
+	}
+	if ok {
+		return f, uint64(size), nil
+	}
+	return bytesImageFile{bytes.NewReader(data)}, uint64(len(data)), nil
+}
+
+// OpenCardImage opens the image for the given card and expansion for
+// streaming reads, fetching it first if it isn't cached.
+func (im *ImageManager) OpenCardImage(
+	ctx context.Context, cardID, expansion, imageURL string) (
+	forgefs.ImageFile, uint64, error) {
+	return im.openCached(
+		func() (forgefs.ImageFile, int64, bool, error) {
+			return im.cache.OpenCardImage(
+				ctx, cardID, expansion, ImageURLSuffix(imageURL))
+		},
+		func() ([]byte, error) {
+			return im.GetCardImage(ctx, cardID, expansion, imageURL)
+		})
+}
+
+// OpenCardImageVariant opens the given variant of the given card's
+// image for streaming reads, deriving it first if it isn't cached.
+func (im *ImageManager) OpenCardImageVariant(
+	ctx context.Context, cardID, imageURL string, variant ImageVariant) (
+	forgefs.ImageFile, uint64, error) {
+	return im.openCached(
+		func() (forgefs.ImageFile, int64, bool, error) {
+			return im.cache.OpenCardImage(
+				ctx, cardID, "", im.variantFileType(variant))
+		},
+		func() ([]byte, error) {
+			return im.GetCardImageVariant(ctx, cardID, imageURL, variant)
+		})
+}
+
+func (im *ImageManager) openDeckFile(
+	ctx context.Context, deckID, fileType string,
+	get func() ([]byte, error)) (forgefs.ImageFile, uint64, error) {
+	return im.openCached(
+		func() (forgefs.ImageFile, int64, bool, error) {
+			return im.cache.OpenDeckImage(ctx, deckID, fileType)
+		}, get)
+}
+
+// OpenDeckImage opens the image for the given deck for streaming
+// reads, fetching it first if it isn't cached.
+func (im *ImageManager) OpenDeckImage(
+	ctx context.Context, deckID string) (forgefs.ImageFile, uint64, error) {
+	return im.openDeckFile(
+		ctx, deckID, im.deckFetcher.GetDeckImageSuffix(),
+		func() ([]byte, error) {
+			return im.GetDeckImage(ctx, deckID)
+		})
+}
+
+// OpenDeckImageVariant opens the given variant of the given deck's
+// image for streaming reads, deriving it first if it isn't cached.
+func (im *ImageManager) OpenDeckImageVariant(
+	ctx context.Context, deckID string, variant ImageVariant) (
+	forgefs.ImageFile, uint64, error) {
+	return im.openDeckFile(
+		ctx, deckID, im.variantFileType(variant), func() ([]byte, error) {
+			return im.GetDeckImageVariant(ctx, deckID, variant)
+		})
+}
+
+// OpenDeckProxySheet opens the proxy sheet for the given deck for
+// streaming reads, generating it first if it isn't cached.
+func (im *ImageManager) OpenDeckProxySheet(
+	ctx context.Context, deckID string, sasVersion int,
+	getImages func(context.Context) ([][]byte, error)) (
+	forgefs.ImageFile, uint64, error) {
+	return im.openDeckFile(
+		ctx, deckID, proxySheetFileType(sasVersion), func() ([]byte, error) {
+			return im.GetDeckProxySheet(ctx, deckID, sasVersion, getImages)
+		})
+}
+
+// OpenDeckContactSheet opens the contact sheet for the given deck for
+// streaming reads, generating it first if it isn't cached.
+func (im *ImageManager) OpenDeckContactSheet(
+	ctx context.Context, deckID string, sasVersion int,
+	getImages func(context.Context) ([][][]byte, error)) (
+	forgefs.ImageFile, uint64, error) {
+	_, layout := im.options()
+	return im.openDeckFile(
+		ctx, deckID, contactSheetFileType(sasVersion, layout),
+		func() ([]byte, error) {
+			return im.GetDeckContactSheet(ctx, deckID, sasVersion, getImages)
+		})
+}
@@ -0,0 +1,182 @@
+package fsutil
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+
+	// Register the formats card images come in.
+	_ "image/png"
+)
+
+// Proxy sheets are US Letter pages, with cards at their real size of
+// 63x88mm.  All sizes are in PDF points.
+const (
+	proxyPageWidth  = 612.0
+	proxyPageHeight = 792.0
+	proxyCardWidth  = 63 / 25.4 * 72
+	proxyCardHeight = 88 / 25.4 * 72
+	proxyColumns    = 3
+	proxyRows       = 3
+)
+
+// jpegQuality is used for any images re-encoded as JPEGs.
+const jpegQuality = 90
+
+// pdfImage is an image ready to be embedded into a PDF as a
+// DCT-encoded (JPEG) stream.
+type pdfImage struct {
+	width, height int
+	colorSpace    string
+	data          []byte
+}
+
+// toPDFImage converts image data into something a PDF can embed.
+// JPEGs are embedded as-is when possible, and everything else is
+// re-encoded as a JPEG over a white background, since PDFs can't use
+// PNG data directly.
+func toPDFImage(data []byte) (*pdfImage, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if format == "jpeg" {
+		switch config.ColorModel {
+		case color.YCbCrModel:
+			return &pdfImage{
+				config.Width, config.Height, "/DeviceRGB", data,
+			}, nil
+		case color.GrayModel:
+			return &pdfImage{
+				config.Width, config.Height, "/DeviceGray", data,
+			}, nil
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(bounds)
+	draw.Draw(rgba, bounds, image.White, image.Point{}, draw.Src)
+	draw.Draw(rgba, bounds, img, bounds.Min, draw.Over)
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, rgba, &jpeg.Options{Quality: jpegQuality})
+	if err != nil {
+		return nil, err
+	}
+	return &pdfImage{
+		bounds.Dx(), bounds.Dy(), "/DeviceRGB", buf.Bytes(),
+	}, nil
+}
+
+// pdfWriter writes numbered PDF objects, keeping track of their
+// offsets for the cross-reference table.
+type pdfWriter struct {
+	buf     bytes.Buffer
+	offsets []int
+}
+
+func (w *pdfWriter) startObj() {
+	w.offsets = append(w.offsets, w.buf.Len())
+	fmt.Fprintf(&w.buf, "%d 0 obj\n", len(w.offsets))
+}
+
+func (w *pdfWriter) writeObj(format string, args ...interface{}) {
+	w.startObj()
+	fmt.Fprintf(&w.buf, format, args...)
+	w.buf.WriteString("\nendobj\n")
+}
+
+func (w *pdfWriter) writeStreamObj(dict string, data []byte) {
+	w.startObj()
+	fmt.Fprintf(&w.buf, "<< %s /Length %d >>\nstream\n", dict, len(data))
+	w.buf.Write(data)
+	w.buf.WriteString("\nendstream\nendobj\n")
+}
+
+func (w *pdfWriter) finish(rootObj int) []byte {
+	xref := w.buf.Len()
+	fmt.Fprintf(&w.buf, "xref\n0 %d\n", len(w.offsets)+1)
+	w.buf.WriteString("0000000000 65535 f \n")
+	for _, off := range w.offsets {
+		fmt.Fprintf(&w.buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&w.buf, "trailer\n<< /Size %d /Root %d 0 R >>\n",
+		len(w.offsets)+1, rootObj)
+	fmt.Fprintf(&w.buf, "startxref\n%d\n%%%%EOF\n", xref)
+	return w.buf.Bytes()
+}
+
+// FormatProxySheetPDF returns a printable PDF of the given card
+// images, laid out in a 3x3 grid on each page at real card size.
+// Each image must be a JPEG or PNG.
+func FormatProxySheetPDF(images [][]byte) ([]byte, error) {
+	pdfImages := make([]*pdfImage, len(images))
+	for i, data := range images {
+		pi, err := toPDFImage(data)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't convert image %d: %w", i, err)
+		}
+		pdfImages[i] = pi
+	}
+
+	perPage := proxyColumns * proxyRows
+	numPages := (len(images) + perPage - 1) / perPage
+	if numPages == 0 {
+		numPages = 1
+	}
+
+	// Objects are numbered as: the catalog, the page tree, every
+	// image, and then each page followed by its contents.
+	const catalogObj, pagesObj, firstImageObj = 1, 2, 3
+	firstPageObj := firstImageObj + len(images)
+	pageObj := func(page int) int { return firstPageObj + 2*page }
+
+	w := &pdfWriter{}
+	w.buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	w.writeObj("<< /Type /Catalog /Pages %d 0 R >>", pagesObj)
+	var kids bytes.Buffer
+	for page := 0; page < numPages; page++ {
+		fmt.Fprintf(&kids, " %d 0 R", pageObj(page))
+	}
+	w.writeObj("<< /Type /Pages /Kids [%s ] /Count %d >>",
+		kids.String(), numPages)
+	for _, pi := range pdfImages {
+		w.writeStreamObj(fmt.Sprintf(
+			"/Type /XObject /Subtype /Image /Width %d /Height %d "+
+				"/ColorSpace %s /BitsPerComponent 8 /Filter /DCTDecode",
+			pi.width, pi.height, pi.colorSpace), pi.data)
+	}
+
+	marginX := (proxyPageWidth - proxyColumns*proxyCardWidth) / 2
+	marginY := (proxyPageHeight - proxyRows*proxyCardHeight) / 2
+	for page := 0; page < numPages; page++ {
+		var resources, contents bytes.Buffer
+		for slot := 0; slot < perPage; slot++ {
+			i := page*perPage + slot
+			if i >= len(images) {
+				break
+			}
+			col := slot % proxyColumns
+			row := slot / proxyColumns
+			x := marginX + float64(col)*proxyCardWidth
+			y := proxyPageHeight - marginY - float64(row+1)*proxyCardHeight
+			fmt.Fprintf(&resources, " /Im%d %d 0 R", i, firstImageObj+i)
+			fmt.Fprintf(&contents, "q %.2f 0 0 %.2f %.2f %.2f cm /Im%d Do Q\n",
+				proxyCardWidth, proxyCardHeight, x, y, i)
+		}
+		w.writeObj("<< /Type /Page /Parent %d 0 R "+
+			"/MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /XObject <<%s >> >> /Contents %d 0 R >>",
+			pagesObj, proxyPageWidth, proxyPageHeight, resources.String(),
+			pageObj(page)+1)
+		w.writeStreamObj("", contents.Bytes())
+	}
+
+	return w.finish(catalogObj), nil
+}
@@ -0,0 +1,66 @@
+package fsutil
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatProxySheetPDF(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 30, 42))
+	img.Set(1, 1, color.RGBA{255, 0, 0, 255})
+	var pngBuf, jpegBuf bytes.Buffer
+	err := png.Encode(&pngBuf, img)
+	require.NoError(t, err)
+	err = jpeg.Encode(&jpegBuf, img, nil)
+	require.NoError(t, err)
+
+	images := make([][]byte, 0, 10)
+	for i := 0; i < 5; i++ {
+		images = append(images, pngBuf.Bytes(), jpegBuf.Bytes())
+	}
+	pdf, err := FormatProxySheetPDF(images)
+	require.NoError(t, err)
+
+	require.True(t, bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")))
+	require.True(t, bytes.HasSuffix(pdf, []byte("%%EOF\n")))
+	require.Contains(t, string(pdf), "/Count 2")
+	require.Equal(t, 10, bytes.Count(pdf, []byte("/Subtype /Image")))
+	// JPEGs are embedded unchanged.
+	require.True(t, bytes.Contains(pdf, jpegBuf.Bytes()))
+	// The first page is full, and the second has the last card.
+	require.Equal(t, 10, bytes.Count(pdf, []byte(" Do Q\n")))
+
+	// Every cross-reference entry must point at its object.
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	require.NotNil(t, m)
+	xref, err := strconv.Atoi(string(m[1]))
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(pdf[xref:], []byte("xref\n")))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(
+		pdf[xref:], -1)
+	// Catalog, page tree, 10 images, and 2 pages with contents.
+	require.Len(t, entries, 16)
+	for i, e := range entries {
+		off, err := strconv.Atoi(string(e[1]))
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(
+			pdf[off:], []byte(fmt.Sprintf("%d 0 obj\n", i+1))))
+	}
+
+	// An empty deck still gets a blank page.
+	pdf, err = FormatProxySheetPDF(nil)
+	require.NoError(t, err)
+	require.Contains(t, string(pdf), "/Count 1")
+
+	_, err = FormatProxySheetPDF([][]byte{{1, 2, 3}})
+	require.Error(t, err)
+}
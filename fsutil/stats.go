@@ -0,0 +1,81 @@
+package fsutil
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strconv"
+
+	"github.com/strib/forgefs"
+)
+
+// This file formats the stats of the user's whole collection, for
+// browsing or loading into a spreadsheet.
+
+// FormatCollectionStatsJSON returns the given collection stats as
+// indented JSON.
+func FormatCollectionStatsJSON(stats *forgefs.CollectionStats) (
+	[]byte, error) {
+	data, err := json.MarshalIndent(stats, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func formatGroupStatsCSV(
+	column string, groups []forgefs.GroupStats,
+	formatName func(string) string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	records := [][]string{{
+		column, "decks", "avg_sas", "avg_aerc", "avg_a", "avg_e", "avg_r",
+		"avg_c", "avg_f", "avg_d", "top_deck", "top_deck_sas",
+	}}
+	for _, g := range groups {
+		avgs := g.Averages
+		records = append(records, []string{
+			formatName(g.Name), strconv.Itoa(g.Decks),
+			formatStat(avgs.SAS), formatStat(avgs.AERC),
+			formatStat(avgs.A), formatStat(avgs.E), formatStat(avgs.R),
+			formatStat(avgs.C), formatStat(avgs.F), formatStat(avgs.D),
+			g.TopDeck.Name, strconv.Itoa(g.TopDeck.SAS),
+		})
+	}
+	err := w.WriteAll(records)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// FormatHouseStatsCSV returns a CSV file with one row of counts,
+// averages and the top deck for each house.
+func FormatHouseStatsCSV(groups []forgefs.GroupStats) ([]byte, error) {
+	return formatGroupStatsCSV(
+		"house", groups, func(name string) string { return name })
+}
+
+// FormatExpansionStatsCSV returns a CSV file with one row of counts,
+// averages and the top deck for each expansion.
+func FormatExpansionStatsCSV(groups []forgefs.GroupStats) ([]byte, error) {
+	return formatGroupStatsCSV("expansion", groups, ExpansionShortName)
+}
+
+// FormatSASHistogramCSV returns a CSV file with the number of decks in
+// each SAS range.
+func FormatSASHistogramCSV(buckets []forgefs.SASBucket) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	records := [][]string{{"sas_min", "sas_max", "decks"}}
+	for _, b := range buckets {
+		records = append(records, []string{
+			strconv.Itoa(b.Min), strconv.Itoa(b.Max), strconv.Itoa(b.Decks),
+		})
+	}
+	err := w.WriteAll(records)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
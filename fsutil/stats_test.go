@@ -0,0 +1,42 @@
+package fsutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/strib/forgefs"
+)
+
+func TestFormatStatsCSV(t *testing.T) {
+	groups := []forgefs.GroupStats{
+		{
+			Name:  "MASS_MUTATION",
+			Decks: 2,
+			Averages: forgefs.StatValues{
+				SAS: 65.5, AERC: 60, A: 7.25, E: 20, R: 1.5, C: 10, F: 9.75,
+				D: 2,
+			},
+			TopDeck: forgefs.DeckScore{ID: "1", Name: "Deck, One", SAS: 72},
+		},
+	}
+	data, err := FormatExpansionStatsCSV(groups)
+	require.NoError(t, err)
+	require.Equal(t,
+		"expansion,decks,avg_sas,avg_aerc,avg_a,avg_e,avg_r,avg_c,avg_f,"+
+			"avg_d,top_deck,top_deck_sas\n"+
+			"MM,2,65.5,60,7.25,20,1.5,10,9.75,2,\"Deck, One\",72\n",
+		string(data))
+
+	groups[0].Name = "Dis"
+	data, err = FormatHouseStatsCSV(groups)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "house,decks,")
+	require.Contains(t, string(data), "\nDis,2,")
+
+	data, err = FormatSASHistogramCSV([]forgefs.SASBucket{
+		{Min: 55, Max: 59, Decks: 1},
+		{Min: 60, Max: 64, Decks: 0},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "sas_min,sas_max,decks\n55,59,1\n60,64,0\n", string(data))
+}
@@ -0,0 +1,35 @@
+package fsutil
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/strib/forgefs"
+)
+
+// CacheStats counts image lookups served from the local cache, and
+// those that had to fetch or build the image.
+type CacheStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+// Status describes what a running forgefs instance is doing.
+type Status struct {
+	Time time.Time `json:"time"`
+	// LastSync maps each kind of sync (e.g., `forgefs.SyncCards`) to
+	// the time it last finished.
+	LastSync     map[string]time.Time  `json:"lastSync"`
+	Clients      []forgefs.ClientStats `json:"clients"`
+	ImageCache   CacheStats            `json:"imageCache"`
+	RecentErrors []forgefs.ErrorRecord `json:"recentErrors"`
+}
+
+// FormatStatusJSON returns the given status as indented JSON.
+func FormatStatusJSON(status *Status) ([]byte, error) {
+	data, err := json.MarshalIndent(status, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,141 @@
+package fusefs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/strib/forgefs"
+	"github.com/strib/forgefs/fsutil"
+)
+
+// FSCardDecksDir represents a directory containing symlinks to every
+// deck owned by the user that contains a card.  Each link is named
+// with the number of copies in the deck, like `2x My Deck`, and a
+// summary file also notes any decks whose card lists haven't been
+// fetched yet.
+type FSCardDecksDir struct {
+	fs.Inode
+	s     forgefs.Storage
+	title string
+}
+
+var _ fs.InodeEmbedder = (*FSCardDecksDir)(nil)
+var _ fs.NodeLookuper = (*FSCardDecksDir)(nil)
+var _ fs.NodeReaddirer = (*FSCardDecksDir)(nil)
+
+func cardDeckEntryName(dcc forgefs.DeckCardCount) string {
+	return fmt.Sprintf("%dx %s", dcc.Count, dcc.Name)
+}
+
+func (cdd *FSCardDecksDir) getDecks(ctx context.Context) (
+	[]forgefs.DeckCardCount, error) {
+	decks, err := cdd.s.GetDecksWithCard(ctx, cdd.title)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(decks, func(i, j int) bool {
+		if decks[i].Count != decks[j].Count {
+			return decks[i].Count > decks[j].Count
+		}
+		return decks[i].Name < decks[j].Name
+	})
+	return decks, nil
+}
+
+func (cdd *FSCardDecksDir) getSummary(ctx context.Context) ([]byte, error) {
+	decks, err := cdd.getDecks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	unfetched, err := cdd.s.GetUnfetchedDeckCount(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	total := 0
+	for _, dcc := range decks {
+		fmt.Fprintf(&buf, "%dx %s\n", dcc.Count, dcc.Name)
+		total += dcc.Count
+	}
+	fmt.Fprintf(&buf, "\n%d copies in %d decks\n", total, len(decks))
+	if unfetched > 0 {
+		fmt.Fprintf(&buf,
+			"%d decks haven't had their card lists fetched yet, and "+
+				"aren't included\n", unfetched)
+	}
+	return buf.Bytes(), nil
+}
+
+// Lookup implements the fs.NodeLookuper interface.
+func (cdd *FSCardDecksDir) Lookup(
+	ctx context.Context, name string, out *fuse.EntryOut) (
+	*fs.Inode, syscall.Errno) {
+	n := cdd.GetChild(name)
+	if n != nil {
+		return n, fillEntryAttr(ctx, n, out)
+	}
+
+	if name == fsutil.CardDecksFilename {
+		n = cdd.NewInode(ctx, &FSFile{
+			getData: cdd.getSummary,
+		}, fs.StableAttr{})
+		errno := fillEntryAttr(ctx, n, out)
+		if errno != 0 {
+			return nil, errno
+		}
+	} else {
+		decks, err := cdd.getDecks(ctx)
+		if err != nil {
+			return nil, fs.ToErrno(err)
+		}
+		var deckName string
+		for _, dcc := range decks {
+			if cardDeckEntryName(dcc) == name {
+				deckName = dcc.Name
+				break
+			}
+		}
+		if deckName == "" {
+			return nil, syscall.ENOENT
+		}
+
+		n = cdd.NewInode(ctx, &fs.MemSymlink{
+			Data: []byte("../../../" + fsutil.MyDecksDir + "/" + deckName),
+		}, fs.StableAttr{
+			Mode: syscall.S_IFLNK,
+		})
+	}
+
+	ok := cdd.AddChild(name, n, false)
+	if !ok {
+		return nil, syscall.EIO
+	}
+	return n, 0
+}
+
+// Readdir implements the fs.NodeReaddirer interface.
+func (cdd *FSCardDecksDir) Readdir(ctx context.Context) (
+	fs.DirStream, syscall.Errno) {
+	decks, err := cdd.getDecks(ctx)
+	if err != nil {
+		return nil, fs.ToErrno(err)
+	}
+	entries := make([]fuse.DirEntry, 0, len(decks)+1)
+	entries = append(entries, fuse.DirEntry{
+		Name: fsutil.CardDecksFilename,
+	})
+	for _, dcc := range decks {
+		entries = append(entries, fuse.DirEntry{
+			Mode: syscall.S_IFLNK,
+			Name: cardDeckEntryName(dcc),
+		})
+	}
+
+	return fs.NewListDirStream(entries), 0
+}
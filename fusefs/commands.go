@@ -0,0 +1,229 @@
+package fusefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/strib/forgefs"
+)
+
+// This file runs the commands written to the control file.
+
+// Commands understood by the control file.
+const (
+	cmdSyncDecks      = "sync decks"
+	cmdSyncCards      = "sync cards"
+	cmdRefresh        = "refresh"
+	cmdPrefetchImages = "prefetch images"
+	cmdDropCache      = "drop-cache"
+	cmdReloadConfig   = "reload-config"
+)
+
+// controlCommand is a parsed line from the control file.
+type controlCommand struct {
+	name string
+	arg  string
+}
+
+// parseCommand parses a line written to the control file.  Extra
+// whitespace between words is ignored.
+func parseCommand(line string) (controlCommand, error) {
+	fields := strings.Fields(line)
+	joined := strings.Join(fields, " ")
+	switch joined {
+	case cmdSyncDecks, cmdSyncCards, cmdPrefetchImages, cmdDropCache,
+		cmdReloadConfig:
+		return controlCommand{name: joined}, nil
+	}
+	if len(fields) == 2 && fields[0] == cmdRefresh {
+		return controlCommand{name: cmdRefresh, arg: fields[1]}, nil
+	}
+	return controlCommand{}, fmt.Errorf("Unknown command: %q", joined)
+}
+
+func (cc controlCommand) String() string {
+	if cc.arg == "" {
+		return cc.name
+	}
+	return cc.name + " " + cc.arg
+}
+
+// runCommand runs the given command, and returns a short description
+// of what it did.
+func (cd *FSControlDir) runCommand(
+	ctx context.Context, cmd controlCommand) (string, error) {
+	switch cmd.name {
+	case cmdSyncDecks:
+		return cd.syncDecks(ctx)
+	case cmdSyncCards:
+		return cd.syncCards(ctx)
+	case cmdRefresh:
+		return cd.refreshDeck(ctx, cmd.arg)
+	case cmdPrefetchImages:
+		return cd.prefetchImages(ctx)
+	case cmdDropCache:
+		err := cd.im.DropCache(ctx)
+		if err != nil {
+			return "", err
+		}
+		return "dropped all cached images", nil
+	case cmdReloadConfig:
+		return cd.reloadConfig()
+	}
+	return "", fmt.Errorf("Unknown command: %q", cmd.name)
+}
+
+func (cd *FSControlDir) syncCards(ctx context.Context) (string, error) {
+	cards, err := cd.da.GetCards(ctx)
+	if err != nil {
+		return "", err
+	}
+	err = cd.s.StoreCards(ctx, cards)
+	if err != nil {
+		return "", err
+	}
+	err = cd.s.SetSyncTime(ctx, forgefs.SyncCards, time.Now())
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("stored %d cards", len(cards)), nil
+}
+
+// syncDecks fetches the user's deck lists.  The lists don't include
+// each deck's cards, so any already-fetched cards are kept rather
+// than fetching every deck again.
+func (cd *FSControlDir) syncDecks(ctx context.Context) (string, error) {
+	decks, err := cd.da.GetMyDecks(ctx)
+	if err != nil {
+		return "", err
+	}
+	for i, d := range decks {
+		if !deckNeedsFetch(&d) {
+			continue
+		}
+		stored, err := cd.s.GetDeck(ctx, d.DeckInfo.KeyforgeID)
+		switch {
+		case err == nil:
+		case errors.Is(err, forgefs.ErrNotFound):
+			continue
+		default:
+			return "", err
+		}
+		if len(d.DeckInfo.Houses) == 0 {
+			decks[i].DeckInfo.Houses = stored.DeckInfo.Houses
+		}
+		if d.SASVersion == 0 {
+			decks[i].SASVersion = stored.SASVersion
+		}
+	}
+	err = cd.s.StoreDecks(ctx, decks)
+	if err != nil {
+		return "", err
+	}
+	err = cd.s.SetSyncTime(ctx, forgefs.SyncDecks, time.Now())
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("stored %d decks", len(decks)), nil
+}
+
+func (cd *FSControlDir) refreshDeck(
+	ctx context.Context, id string) (string, error) {
+	deck, err := cd.s.GetDeck(ctx, id)
+	switch {
+	case err == nil:
+	case errors.Is(err, forgefs.ErrNotFound):
+		return "", fmt.Errorf("No stored deck with ID %s", id)
+	default:
+		return "", err
+	}
+	newDeck, err := cd.da.GetDeck(ctx, id, deck)
+	if err != nil {
+		return "", err
+	}
+	err = cd.s.StoreDecks(ctx, []forgefs.Deck{newDeck})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("refreshed %s", newDeck.DeckInfo.Name), nil
+}
+
+// prefetchImages fetches the default image of every card, and the
+// image of every deck in the user's lists, so they can be browsed
+// quickly later.  Failures are skipped, and show up in the fetchers'
+// errors.
+func (cd *FSControlDir) prefetchImages(ctx context.Context) (string, error) {
+	titles, err := cd.s.GetCardTitles(ctx)
+	if err != nil {
+		return "", err
+	}
+	deckIDs := make(map[string]bool)
+	for _, list := range []forgefs.DeckList{
+		forgefs.DeckListMine, forgefs.DeckListWishlist,
+		forgefs.DeckListFunny,
+	} {
+		mds, err := cd.s.GetDeckMetadata(ctx, list)
+		if err != nil {
+			return "", err
+		}
+		for id := range mds {
+			deckIDs[id] = true
+		}
+	}
+
+	var fetched, failed int
+	var firstErr error
+	count := func(err error) {
+		if err == nil {
+			fetched++
+			return
+		}
+		failed++
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	for id := range titles {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		url, err := cd.s.GetCardImageURL(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		if url == "" {
+			continue
+		}
+		_, err = cd.im.GetCardImage(ctx, id, "", url)
+		count(err)
+	}
+	for id := range deckIDs {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		_, err := cd.im.GetDeckImage(ctx, id)
+		count(err)
+	}
+
+	if failed > 0 {
+		return "", fmt.Errorf(
+			"cached %d images, but %d failed; first error: %w",
+			fetched, failed, firstErr)
+	}
+	return fmt.Sprintf("cached %d images", fetched), nil
+}
+
+func (cd *FSControlDir) reloadConfig() (string, error) {
+	if cd.loadConfig == nil {
+		return "", errors.New("No config file to reload")
+	}
+	config, err := cd.loadConfig()
+	if err != nil {
+		return "", err
+	}
+	cd.im.SetOptions(config.ImageManagerOptions())
+	return "applied image settings; other settings need a restart", nil
+}
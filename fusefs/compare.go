@@ -0,0 +1,245 @@
+package fusefs
+
+import (
+	"context"
+	"encoding/json"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/strib/forgefs"
+	"github.com/strib/forgefs/fsutil"
+)
+
+// findDeckID returns the ID of the deck with the given name, from any
+// of the user's deck lists.
+func findDeckID(ctx context.Context, s forgefs.Storage, name string) (
+	string, syscall.Errno) {
+	for _, list := range []forgefs.DeckList{
+		forgefs.DeckListMine, forgefs.DeckListWishlist, forgefs.DeckListFunny,
+	} {
+		mds, err := s.GetDeckMetadata(ctx, list)
+		if err != nil {
+			return "", fs.ToErrno(err)
+		}
+		for _, md := range mds {
+			if md.Name == name {
+				return md.ID, 0
+			}
+		}
+	}
+	return "", syscall.ENOENT
+}
+
+// FSDeckDiff represents a directory comparing two decks.
+type FSDeckDiff struct {
+	fs.Inode
+	s        forgefs.Storage
+	da       forgefs.DataFetcher
+	aID, bID string
+}
+
+var _ fs.InodeEmbedder = (*FSDeckDiff)(nil)
+var _ fs.NodeLookuper = (*FSDeckDiff)(nil)
+var _ fs.NodeReaddirer = (*FSDeckDiff)(nil)
+
+func formatDiffText(diff *fsutil.DeckDiff) ([]byte, error) {
+	return fsutil.FormatDeckDiffText(diff), nil
+}
+
+func formatDiffJSON(diff *fsutil.DeckDiff) ([]byte, error) {
+	diffJSON, err := json.MarshalIndent(diff, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(diffJSON, '\n'), nil
+}
+
+// newDiffFile returns a file whose contents are generated by `format`
+// from the comparison of the two decks.  Like deck files, its size is
+// only known before it's read if neither deck needs fetching.
+func (dd *FSDeckDiff) newDiffFile(
+	format func(*fsutil.DeckDiff) ([]byte, error)) *FSFile {
+	return &FSFile{
+		getSize: func(ctx context.Context) (uint64, bool, error) {
+			a, err := dd.s.GetDeck(ctx, dd.aID)
+			if err != nil {
+				return 0, false, err
+			}
+			b, err := dd.s.GetDeck(ctx, dd.bID)
+			if err != nil {
+				return 0, false, err
+			}
+			if deckNeedsFetch(a) || deckNeedsFetch(b) {
+				return 0, false, nil
+			}
+			data, err := format(fsutil.CompareDecks(a, b))
+			if err != nil {
+				return 0, false, err
+			}
+			return uint64(len(data)), true, nil
+		},
+		getData: func(ctx context.Context) ([]byte, error) {
+			a, err := getFullDeck(ctx, dd.s, dd.da, dd.aID)
+			if err != nil {
+				return nil, err
+			}
+			b, err := getFullDeck(ctx, dd.s, dd.da, dd.bID)
+			if err != nil {
+				return nil, err
+			}
+			return format(fsutil.CompareDecks(a, b))
+		},
+	}
+}
+
+// Lookup implements the fs.NodeLookuper interface.
+func (dd *FSDeckDiff) Lookup(
+	ctx context.Context, name string, out *fuse.EntryOut) (
+	*fs.Inode, syscall.Errno) {
+	n := dd.GetChild(name)
+	if n != nil {
+		return n, fillEntryAttr(ctx, n, out)
+	}
+
+	switch name {
+	case fsutil.DiffTextFilename:
+		n = dd.NewInode(ctx, dd.newDiffFile(formatDiffText), fs.StableAttr{})
+	case fsutil.DiffJSONFilename:
+		n = dd.NewInode(ctx, dd.newDiffFile(formatDiffJSON), fs.StableAttr{})
+	default:
+		return nil, syscall.ENOENT
+	}
+
+	errno := fillEntryAttr(ctx, n, out)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	ok := dd.AddChild(name, n, false)
+	if !ok {
+		return nil, syscall.EIO
+	}
+	return n, 0
+}
+
+// Readdir implements the fs.NodeReaddirer interface.
+func (dd *FSDeckDiff) Readdir(ctx context.Context) (
+	fs.DirStream, syscall.Errno) {
+	entries := []fuse.DirEntry{
+		{
+			Name: fsutil.DiffTextFilename,
+		},
+		{
+			Name: fsutil.DiffJSONFilename,
+		},
+	}
+	return fs.NewListDirStream(entries), 0
+}
+
+// FSCompareDeckDir is a virtual directory for comparing one deck with
+// any other deck, looked up by name.
+type FSCompareDeckDir struct {
+	fs.Inode
+	s   forgefs.Storage
+	da  forgefs.DataFetcher
+	aID string
+}
+
+var _ fs.InodeEmbedder = (*FSCompareDeckDir)(nil)
+var _ fs.NodeLookuper = (*FSCompareDeckDir)(nil)
+var _ fs.NodeReaddirer = (*FSCompareDeckDir)(nil)
+
+// Lookup implements the fs.NodeLookuper interface.
+func (cdd *FSCompareDeckDir) Lookup(
+	ctx context.Context, name string, out *fuse.EntryOut) (
+	*fs.Inode, syscall.Errno) {
+	n := cdd.GetChild(name)
+	if n != nil {
+		return n, 0
+	}
+
+	bID, errno := findDeckID(ctx, cdd.s, name)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	n = cdd.NewInode(ctx, &FSDeckDiff{
+		s:   cdd.s,
+		da:  cdd.da,
+		aID: cdd.aID,
+		bID: bID,
+	}, fs.StableAttr{
+		Mode: syscall.S_IFDIR,
+	})
+
+	ok := cdd.AddChild(name, n, false)
+	if !ok {
+		return nil, syscall.EIO
+	}
+	return n, 0
+}
+
+// Readdir implements the fs.NodeReaddirer interface.  The directory
+// is virtual, so it doesn't list the decks that could be compared.
+func (cdd *FSCompareDeckDir) Readdir(ctx context.Context) (
+	fs.DirStream, syscall.Errno) {
+	return fs.NewListDirStream(nil), 0
+}
+
+// FSCompareDir is a virtual directory for comparing pairs of decks, as
+// `<deckA>/<deckB>`.
+type FSCompareDir struct {
+	fs.Inode
+	s  forgefs.Storage
+	da forgefs.DataFetcher
+}
+
+// NewFSCompareDir creates a new FSCompareDir instance.
+func NewFSCompareDir(
+	s forgefs.Storage, da forgefs.DataFetcher) *FSCompareDir {
+	return &FSCompareDir{
+		s:  s,
+		da: da,
+	}
+}
+
+var _ fs.InodeEmbedder = (*FSCompareDir)(nil)
+var _ fs.NodeLookuper = (*FSCompareDir)(nil)
+var _ fs.NodeReaddirer = (*FSCompareDir)(nil)
+
+// Lookup implements the fs.NodeLookuper interface.
+func (cd *FSCompareDir) Lookup(
+	ctx context.Context, name string, out *fuse.EntryOut) (
+	*fs.Inode, syscall.Errno) {
+	n := cd.GetChild(name)
+	if n != nil {
+		return n, 0
+	}
+
+	aID, errno := findDeckID(ctx, cd.s, name)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	n = cd.NewInode(ctx, &FSCompareDeckDir{
+		s:   cd.s,
+		da:  cd.da,
+		aID: aID,
+	}, fs.StableAttr{
+		Mode: syscall.S_IFDIR,
+	})
+
+	ok := cd.AddChild(name, n, false)
+	if !ok {
+		return nil, syscall.EIO
+	}
+	return n, 0
+}
+
+// Readdir implements the fs.NodeReaddirer interface.  The directory
+// is virtual, so it doesn't list the decks that could be compared.
+func (cd *FSCompareDir) Readdir(ctx context.Context) (
+	fs.DirStream, syscall.Errno) {
+	return fs.NewListDirStream(nil), 0
+}
@@ -1,12 +1,31 @@
 package fusefs
 
+import "github.com/strib/forgefs/fsutil"
+
 // Config represents the config file for a FUSE-based file system.
 type Config struct {
-	Debug         bool   `json:"debug,omitempty"`
-	DoKAPIKey     string `json:"dok_api_key,omitempty"`
-	DoKAddr       string `json:"dok_addr,omitempty"`
-	SkyJAddr      string `json:"skyj_addr,omitempty"`
-	DBFile        string `json:"db_file,omitempty"`
-	Mountpoint    string `json:"mountpoint,omitempty"`
-	ImageCacheDir string `json:"image_cache_dir,omitempty"`
+	Debug               bool    `json:"debug,omitempty"`
+	DoKAPIKey           string  `json:"dok_api_key,omitempty"`
+	DoKAddr             string  `json:"dok_addr,omitempty"`
+	SkyJAddr            string  `json:"skyj_addr,omitempty"`
+	DBFile              string  `json:"db_file,omitempty"`
+	Mountpoint          string  `json:"mountpoint,omitempty"`
+	ImageCacheDir       string  `json:"image_cache_dir,omitempty"`
+	ThumbnailSize       int     `json:"thumbnail_size,omitempty"`
+	ContactSheetColumns int     `json:"contact_sheet_columns,omitempty"`
+	ContactSheetScale   float64 `json:"contact_sheet_scale,omitempty"`
+	EntryTimeout        float64 `json:"entry_timeout,omitempty"`
+	AttrTimeout         float64 `json:"attr_timeout,omitempty"`
+	NegativeTimeout     float64 `json:"negative_timeout,omitempty"`
+}
+
+// ImageManagerOptions returns the image settings from the config.
+func (c *Config) ImageManagerOptions() fsutil.ImageManagerOptions {
+	return fsutil.ImageManagerOptions{
+		ThumbnailSize: c.ThumbnailSize,
+		ContactSheet: fsutil.ContactSheetOptions{
+			Columns: c.ContactSheetColumns,
+			Scale:   c.ContactSheetScale,
+		},
+	}
 }
@@ -0,0 +1,308 @@
+package fusefs
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/strib/forgefs"
+	"github.com/strib/forgefs/fsutil"
+	"github.com/strib/forgefs/util"
+)
+
+// controlLogLines is the number of lines kept in the control log.
+const controlLogLines = 1000
+
+// FSControlDir represents a hidden directory for inspecting and
+// controlling the running file system.  Its status file is
+// regenerated every time it's opened.  Commands written to its
+// control file run in the background, one at a time, and their
+// results are appended to its log file.
+type FSControlDir struct {
+	fs.Inode
+	s          forgefs.Storage
+	da         forgefs.DataFetcher
+	im         *fsutil.ImageManager
+	loadConfig func() (*Config, error)
+
+	// errs holds failed commands, for the status file.
+	errs util.ErrorLog
+
+	logLock sync.Mutex
+	log     []string
+
+	queueLock sync.Mutex
+	queue     []controlCommand
+	running   bool
+}
+
+// NewFSControlDir creates a new FSControlDir instance.  If
+// `loadConfig` is not nil, it's used to reload the config file.
+func NewFSControlDir(
+	s forgefs.Storage, da forgefs.DataFetcher, im *fsutil.ImageManager,
+	loadConfig func() (*Config, error)) *FSControlDir {
+	return &FSControlDir{
+		s:          s,
+		da:         da,
+		im:         im,
+		loadConfig: loadConfig,
+	}
+}
+
+var _ fs.InodeEmbedder = (*FSControlDir)(nil)
+var _ fs.NodeLookuper = (*FSControlDir)(nil)
+var _ fs.NodeReaddirer = (*FSControlDir)(nil)
+
+func (cd *FSControlDir) appendLog(line string, err error) {
+	if err != nil {
+		cd.errs.Add("control "+line, err)
+		line += ": error: " + err.Error()
+	}
+	cd.logLock.Lock()
+	defer cd.logLock.Unlock()
+	cd.log = append(cd.log, time.Now().Format(time.RFC3339)+" "+line+"\n")
+	if len(cd.log) > controlLogLines {
+		cd.log = cd.log[len(cd.log)-controlLogLines:]
+	}
+}
+
+func (cd *FSControlDir) getLog() []byte {
+	cd.logLock.Lock()
+	defer cd.logLock.Unlock()
+	return []byte(strings.Join(cd.log, ""))
+}
+
+// enqueue schedules the given commands to run after any that are
+// already waiting.
+func (cd *FSControlDir) enqueue(cmds []controlCommand) {
+	cd.queueLock.Lock()
+	defer cd.queueLock.Unlock()
+	cd.queue = append(cd.queue, cmds...)
+	if !cd.running && len(cd.queue) > 0 {
+		cd.running = true
+		go cd.runQueue(context.Background())
+	}
+}
+
+func (cd *FSControlDir) runQueue(ctx context.Context) {
+	for {
+		cd.queueLock.Lock()
+		if len(cd.queue) == 0 {
+			cd.running = false
+			cd.queueLock.Unlock()
+			return
+		}
+		cmd := cd.queue[0]
+		cd.queue = cd.queue[1:]
+		cd.queueLock.Unlock()
+
+		result, err := cd.runCommand(ctx, cmd)
+		if err == nil {
+			cd.appendLog(cmd.String()+": "+result, nil)
+		} else {
+			cd.appendLog(cmd.String(), err)
+		}
+	}
+}
+
+func (cd *FSControlDir) getStatus(ctx context.Context) (
+	*fsutil.Status, error) {
+	times, err := cd.s.GetSyncTimes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &fsutil.Status{
+		Time:     time.Now(),
+		LastSync: times,
+		Clients:  []forgefs.ClientStats{},
+	}
+	errs := []forgefs.ErrorRecord{}
+	if sr, ok := cd.da.(forgefs.StatsReporter); ok {
+		status.Clients = append(status.Clients, sr.ClientStats())
+		errs = append(errs, sr.RecentErrors()...)
+	}
+	status.Clients = append(status.Clients, cd.im.ClientStats()...)
+	errs = append(errs, cd.im.RecentErrors()...)
+	errs = append(errs, cd.errs.Recent()...)
+	status.ImageCache.Hits, status.ImageCache.Misses = cd.im.CacheStats()
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Time.Before(errs[j].Time)
+	})
+	if len(errs) > util.ErrorLogSize {
+		errs = errs[len(errs)-util.ErrorLogSize:]
+	}
+	status.RecentErrors = errs
+	return status, nil
+}
+
+// Lookup implements the fs.NodeLookuper interface.
+func (cd *FSControlDir) Lookup(
+	ctx context.Context, name string, out *fuse.EntryOut) (
+	*fs.Inode, syscall.Errno) {
+	n := cd.GetChild(name)
+	if n != nil {
+		return n, fillEntryAttr(ctx, n, out)
+	}
+
+	switch name {
+	case fsutil.StatusFilename:
+		n = cd.NewInode(ctx, &FSFile{
+			getData: func(ctx context.Context) ([]byte, error) {
+				status, err := cd.getStatus(ctx)
+				if err != nil {
+					return nil, err
+				}
+				return fsutil.FormatStatusJSON(status)
+			},
+		}, fs.StableAttr{})
+	case fsutil.ControlFilename:
+		n = cd.NewInode(ctx, &FSControlFile{cd: cd}, fs.StableAttr{})
+	case fsutil.ControlLogFilename:
+		n = cd.NewInode(ctx, &FSFile{
+			getData: func(ctx context.Context) ([]byte, error) {
+				return cd.getLog(), nil
+			},
+		}, fs.StableAttr{})
+	default:
+		return nil, syscall.ENOENT
+	}
+
+	ok := cd.AddChild(name, n, false)
+	if !ok {
+		return nil, syscall.EIO
+	}
+	return n, fillEntryAttr(ctx, n, out)
+}
+
+// Readdir implements the fs.NodeReaddirer interface.
+func (cd *FSControlDir) Readdir(ctx context.Context) (
+	fs.DirStream, syscall.Errno) {
+	names := []string{
+		fsutil.StatusFilename,
+		fsutil.ControlFilename,
+		fsutil.ControlLogFilename,
+	}
+	entries := make([]fuse.DirEntry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, fuse.DirEntry{
+			Mode: syscall.S_IFREG,
+			Name: name,
+		})
+	}
+	return fs.NewListDirStream(entries), 0
+}
+
+// FSControlFile is a write-only file that accepts one command per
+// line.  Commands are checked as they're written, and queued to run
+// when the file is flushed (e.g., closed).
+type FSControlFile struct {
+	fs.Inode
+	cd *FSControlDir
+}
+
+var _ fs.InodeEmbedder = (*FSControlFile)(nil)
+var _ fs.NodeGetattrer = (*FSControlFile)(nil)
+var _ fs.NodeSetattrer = (*FSControlFile)(nil)
+var _ fs.NodeOpener = (*FSControlFile)(nil)
+var _ fs.NodeWriter = (*FSControlFile)(nil)
+var _ fs.NodeFlusher = (*FSControlFile)(nil)
+
+// controlHandle buffers the commands written by one opening of the
+// control file.
+type controlHandle struct {
+	mu      sync.Mutex
+	partial []byte
+	cmds    []controlCommand
+}
+
+// Getattr implements the fs.NodeGetattrer interface.
+func (cf *FSControlFile) Getattr(
+	ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Mode = 0200
+	out.Size = 0
+	return 0
+}
+
+// Setattr implements the fs.NodeSetattrer interface.  The control
+// file is always empty, so truncating it (e.g., for `echo cmd >
+// control`) does nothing.
+func (cf *FSControlFile) Setattr(
+	ctx context.Context, fh fs.FileHandle, in *fuse.SetAttrIn,
+	out *fuse.AttrOut) syscall.Errno {
+	return cf.Getattr(ctx, fh, out)
+}
+
+// Open implements the fs.NodeOpener interface.
+func (cf *FSControlFile) Open(ctx context.Context, flags uint32) (
+	fs.FileHandle, uint32, syscall.Errno) {
+	if flags&syscall.O_ACCMODE != syscall.O_WRONLY {
+		return nil, 0, syscall.EACCES
+	}
+	return &controlHandle{}, fuse.FOPEN_DIRECT_IO, 0
+}
+
+// Write implements the fs.NodeWriter interface.  Each complete line
+// is parsed right away, so unknown commands fail the write.  The
+// offset is ignored, since commands are only ever appended.
+func (cf *FSControlFile) Write(
+	ctx context.Context, fh fs.FileHandle, data []byte, off int64) (
+	uint32, syscall.Errno) {
+	ch, ok := fh.(*controlHandle)
+	if !ok {
+		return 0, syscall.EBADF
+	}
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.partial = append(ch.partial, data...)
+	for {
+		i := bytes.IndexByte(ch.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(ch.partial[:i])
+		ch.partial = ch.partial[i+1:]
+		errno := cf.addLine(ch, line)
+		if errno != 0 {
+			return 0, errno
+		}
+	}
+	return uint32(len(data)), 0
+}
+
+func (cf *FSControlFile) addLine(ch *controlHandle, line string) syscall.Errno {
+	if strings.TrimSpace(line) == "" {
+		return 0
+	}
+	cmd, err := parseCommand(line)
+	if err != nil {
+		cf.cd.appendLog(strings.TrimSpace(line), err)
+		return syscall.EINVAL
+	}
+	ch.cmds = append(ch.cmds, cmd)
+	return 0
+}
+
+// Flush implements the fs.NodeFlusher interface.  Any unterminated
+// last line is treated as a complete command.
+func (cf *FSControlFile) Flush(ctx context.Context, fh fs.FileHandle) syscall.Errno {
+	ch, ok := fh.(*controlHandle)
+	if !ok {
+		return 0
+	}
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	line := string(ch.partial)
+	ch.partial = nil
+	errno := cf.addLine(ch, line)
+	cf.cd.enqueue(ch.cmds)
+	ch.cmds = nil
+	return errno
+}
@@ -0,0 +1,203 @@
+package fusefs
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/strib/forgefs"
+)
+
+// FSFile is a read-only file whose contents are only generated (and
+// possibly fetched from the network) when the file is opened.  Until
+// then, its size comes from `getSize`, which should only consult
+// locally-stored data.  Files backed by the image cache set `open`
+// instead of `getData`, so their contents are streamed from disk and
+// left to the kernel's page cache rather than held in memory.
+type FSFile struct {
+	fs.Inode
+
+	mtime time.Time
+	// getSize returns the size of the file, and `true`, if it can be
+	// determined without fetching anything remotely.  If `getSize`
+	// is nil, `getData` is assumed to be cheap and is used instead.
+	getSize func(ctx context.Context) (uint64, bool, error)
+	// getData returns the full contents of the file.
+	getData func(ctx context.Context) ([]byte, error)
+	// open, if set, is used instead of `getData` to open the file
+	// for streaming reads, returning its size.
+	open func(ctx context.Context) (forgefs.ImageFile, uint64, error)
+
+	mu       sync.Mutex
+	size     uint64 // size of the most recently-read contents
+	haveSize bool
+	reported uint64 // size most recently reported to the kernel
+}
+
+var _ fs.InodeEmbedder = (*FSFile)(nil)
+var _ fs.NodeGetattrer = (*FSFile)(nil)
+var _ fs.NodeOpener = (*FSFile)(nil)
+
+func (f *FSFile) currentSize(ctx context.Context) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.haveSize {
+		return f.size, nil
+	}
+
+	if f.getSize == nil {
+		if f.open != nil {
+			return 0, nil
+		}
+		data, err := f.getData(ctx)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(len(data)), nil
+	}
+
+	size, ok, err := f.getSize(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		// Unknown until the contents are read.
+		return 0, nil
+	}
+	return size, nil
+}
+
+// invalidate forgets the size of the most recently-read contents,
+// and tells the kernel to drop any cached attributes and data.
+func (f *FSFile) invalidate() {
+	f.mu.Lock()
+	f.haveSize = false
+	f.mu.Unlock()
+	_ = f.NotifyContent(0, 0)
+}
+
+// Getattr implements the fs.NodeGetattrer interface.
+func (f *FSFile) Getattr(
+	ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	size, err := f.currentSize(ctx)
+	if err != nil {
+		return fs.ToErrno(err)
+	}
+
+	f.mu.Lock()
+	f.reported = size
+	f.mu.Unlock()
+
+	out.Mode = 0444
+	out.Size = size
+	out.SetTimes(&f.mtime, &f.mtime, &f.mtime)
+	return 0
+}
+
+// Open implements the fs.NodeOpener interface.
+func (f *FSFile) Open(ctx context.Context, flags uint32) (
+	fs.FileHandle, uint32, syscall.Errno) {
+	if flags&syscall.O_ACCMODE != syscall.O_RDONLY {
+		return nil, 0, syscall.EACCES
+	}
+
+	var fh fs.FileHandle
+	var size uint64
+	if f.open != nil {
+		file, fileSize, err := f.open(ctx)
+		if err != nil {
+			return nil, 0, fs.ToErrno(err)
+		}
+		fh, size = &streamHandle{f: file}, fileSize
+	} else {
+		data, err := f.getData(ctx)
+		if err != nil {
+			return nil, 0, fs.ToErrno(err)
+		}
+		fh, size = &fileHandle{data: data}, uint64(len(data))
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.size = size
+	f.haveSize = true
+
+	var fuseFlags uint32
+	if f.size != f.reported {
+		// The kernel still thinks the file has the old size, and
+		// would truncate any reads through the page cache to that
+		// size.
+		fuseFlags |= fuse.FOPEN_DIRECT_IO
+	}
+	return fh, fuseFlags, 0
+}
+
+// fileHandle serves reads for one opening of an FSFile.
+type fileHandle struct {
+	data []byte
+}
+
+var _ fs.FileReader = (*fileHandle)(nil)
+
+// Read implements the fs.FileReader interface.
+func (fh *fileHandle) Read(
+	ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	if off >= int64(len(fh.data)) {
+		return fuse.ReadResultData(nil), 0
+	}
+	end := off + int64(len(dest))
+	if end > int64(len(fh.data)) {
+		end = int64(len(fh.data))
+	}
+	return fuse.ReadResultData(fh.data[off:end]), 0
+}
+
+// streamHandle serves reads for one opening of an FSFile by reading
+// directly from an open file.
+type streamHandle struct {
+	f forgefs.ImageFile
+}
+
+var _ fs.FileReader = (*streamHandle)(nil)
+var _ fs.FileReleaser = (*streamHandle)(nil)
+
+// Read implements the fs.FileReader interface.
+func (sh *streamHandle) Read(
+	ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	if osFile, ok := sh.f.(*os.File); ok {
+		// Let the FUSE library splice straight from the file.
+		return fuse.ReadResultFd(osFile.Fd(), off, len(dest)), 0
+	}
+	n, err := sh.f.ReadAt(dest, off)
+	if err != nil && err != io.EOF {
+		return nil, fs.ToErrno(err)
+	}
+	return fuse.ReadResultData(dest[:n]), 0
+}
+
+// Release implements the fs.FileReleaser interface.
+func (sh *streamHandle) Release(ctx context.Context) syscall.Errno {
+	return fs.ToErrno(sh.f.Close())
+}
+
+// fillEntryAttr fills in the attributes of `n` for a lookup reply, so
+// the kernel learns about file sizes without a separate getattr.
+func fillEntryAttr(
+	ctx context.Context, n *fs.Inode, out *fuse.EntryOut) syscall.Errno {
+	ga, ok := n.Operations().(fs.NodeGetattrer)
+	if !ok {
+		return 0
+	}
+	var a fuse.AttrOut
+	errno := ga.Getattr(ctx, nil, &a)
+	if errno != 0 {
+		return errno
+	}
+	out.Attr = a.Attr
+	return 0
+}
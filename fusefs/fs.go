@@ -3,9 +3,11 @@ package fusefs
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -23,55 +25,182 @@ const (
 // FSCard is a fuse inode representing a card's directory.
 type FSCard struct {
 	fs.Inode
-	s  forgefs.Storage
-	id string
-	im *fsutil.ImageManager
+	s     forgefs.Storage
+	id    string
+	title string
+	im    *fsutil.ImageManager
 }
 
 var _ fs.InodeEmbedder = (*FSCard)(nil)
 var _ fs.NodeLookuper = (*FSCard)(nil)
 var _ fs.NodeReaddirer = (*FSCard)(nil)
 
+func (c *FSCard) getCardJSON(ctx context.Context) ([]byte, error) {
+	card, err := c.s.GetCard(ctx, c.id)
+	if err != nil {
+		return nil, err
+	}
+	cardJSON, err := json.MarshalIndent(card, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(cardJSON, '\n'), nil
+}
+
+func (c *FSCard) getCardText(ctx context.Context) ([]byte, error) {
+	card, err := c.s.GetCard(ctx, c.id)
+	if err != nil {
+		return nil, err
+	}
+	return fsutil.FormatCardText(card), nil
+}
+
+func (c *FSCard) getImageSize(ctx context.Context) (uint64, bool, error) {
+	imageURL, err := c.s.GetCardImageURL(ctx, c.id)
+	if err != nil {
+		return 0, false, err
+	}
+	return c.im.GetCardImageSize(ctx, c.id, "", imageURL)
+}
+
+func (c *FSCard) openImage(ctx context.Context) (
+	forgefs.ImageFile, uint64, error) {
+	imageURL, err := c.s.GetCardImageURL(ctx, c.id)
+	if err != nil {
+		return nil, 0, err
+	}
+	return c.im.OpenCardImage(ctx, c.id, "", imageURL)
+}
+
+func (c *FSCard) newImageFile() *FSFile {
+	return &FSFile{
+		getSize: c.getImageSize,
+		open:    c.openImage,
+	}
+}
+
+// newImageVariantFile returns a file with an image derived from the
+// card's default image.
+func (c *FSCard) newImageVariantFile(variant fsutil.ImageVariant) *FSFile {
+	return &FSFile{
+		getSize: func(ctx context.Context) (uint64, bool, error) {
+			return c.im.GetCardImageVariantSize(ctx, c.id, variant)
+		},
+		open: func(ctx context.Context) (forgefs.ImageFile, uint64, error) {
+			imageURL, err := c.s.GetCardImageURL(ctx, c.id)
+			if err != nil {
+				return nil, 0, err
+			}
+			return c.im.OpenCardImageVariant(ctx, c.id, imageURL, variant)
+		},
+	}
+}
+
+// getExpansionImageURL returns the full expansion name and image URL
+// of the printing of this card from the expansion with the given
+// short name, or an empty expansion if there isn't one.
+func (c *FSCard) getExpansionImageURL(ctx context.Context, short string) (
+	expansion, imageURL string, err error) {
+	urls, err := c.s.GetCardImageURLs(ctx, c.title)
+	if err != nil {
+		return "", "", err
+	}
+	for expansion, imageURL := range urls {
+		if fsutil.ExpansionShortName(expansion) == short {
+			return expansion, imageURL, nil
+		}
+	}
+	return "", "", nil
+}
+
+func (c *FSCard) newExpansionImageFile(expansion, imageURL string) *FSFile {
+	return &FSFile{
+		getSize: func(ctx context.Context) (uint64, bool, error) {
+			return c.im.GetCardImageSize(ctx, c.id, expansion, imageURL)
+		},
+		open: func(ctx context.Context) (forgefs.ImageFile, uint64, error) {
+			return c.im.OpenCardImage(ctx, c.id, expansion, imageURL)
+		},
+	}
+}
+
 // Lookup implements the fs.NodeLookuper interface.
 func (c *FSCard) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (
 	*fs.Inode, syscall.Errno) {
 	n := c.GetChild(name)
 	if n != nil {
-		return n, 0
+		return n, fillEntryAttr(ctx, n, out)
 	}
 
 	switch name {
 	case fsutil.CardJSONFilename:
-		card, err := c.s.GetCard(ctx, c.id)
-		if err != nil {
-			return nil, fs.ToErrno(err)
-		}
-		cardJSON, err := json.MarshalIndent(card, "", "\t")
-		if err != nil {
-			return nil, fs.ToErrno(err)
-		}
-		cardJSON = append(cardJSON, '\n')
-
-		out.Size = uint64(len(cardJSON))
-		n = c.NewInode(ctx, &fs.MemRegularFile{
-			Data: cardJSON,
+		n = c.NewInode(ctx, &FSFile{
+			getData: c.getCardJSON,
 		}, fs.StableAttr{})
-	default:
+	case fsutil.CardTextFilename:
+		n = c.NewInode(ctx, &FSFile{
+			getData: c.getCardText,
+		}, fs.StableAttr{})
+	case fsutil.CardDecksDir:
+		n = c.NewInode(ctx, &FSCardDecksDir{
+			s:     c.s,
+			title: c.title,
+		}, fs.StableAttr{
+			Mode: syscall.S_IFDIR,
+		})
+	case fsutil.CardTraitsDir, fsutil.CardSynergiesDir:
+		n = c.NewInode(ctx, &FSCardTraitsDir{
+			s:         c.s,
+			id:        c.id,
+			synergies: name == fsutil.CardSynergiesDir,
+		}, fs.StableAttr{
+			Mode: syscall.S_IFDIR,
+		})
+	case fsutil.CardThumbnailFilename:
+		n = c.NewInode(
+			ctx, c.newImageVariantFile(fsutil.ImageVariantThumbnail),
+			fs.StableAttr{})
+	case fsutil.CardPNGFilename:
+		// Only convert the image if it isn't a PNG already.
 		imageURL, err := c.s.GetCardImageURL(ctx, c.id)
 		if err != nil {
 			return nil, fs.ToErrno(err)
 		}
+		if fsutil.ImageURLSuffix(imageURL) == "png" {
+			n = c.NewInode(ctx, c.newImageFile(), fs.StableAttr{})
+			break
+		}
+		n = c.NewInode(
+			ctx, c.newImageVariantFile(fsutil.ImageVariantPNG),
+			fs.StableAttr{})
+	default:
 		if !strings.HasPrefix(name, fsutil.CardImagePrefix) {
 			return nil, syscall.ENOENT
 		}
-		data, err := c.im.GetCardImage(ctx, c.id, imageURL)
-		if err != nil {
-			return nil, fs.ToErrno(err)
+		// Images from a specific expansion are named like
+		// `image.MM.png`.
+		rest := strings.TrimPrefix(name, fsutil.CardImagePrefix)
+		if i := strings.LastIndex(rest, "."); i >= 0 {
+			expansion, imageURL, err := c.getExpansionImageURL(ctx, rest[:i])
+			if err != nil {
+				return nil, fs.ToErrno(err)
+			}
+			// Only the name listed by Readdir is valid.
+			if expansion == "" ||
+				rest[i+1:] != fsutil.ImageURLSuffix(imageURL) {
+				return nil, syscall.ENOENT
+			}
+			n = c.NewInode(
+				ctx, c.newExpansionImageFile(expansion, imageURL),
+				fs.StableAttr{})
+			break
 		}
-		out.Size = uint64(len(data))
-		n = c.NewInode(ctx, &fs.MemRegularFile{
-			Data: data,
-		}, fs.StableAttr{})
+		n = c.NewInode(ctx, c.newImageFile(), fs.StableAttr{})
+	}
+
+	errno := fillEntryAttr(ctx, n, out)
+	if errno != 0 {
+		return nil, errno
 	}
 
 	ok := c.AddChild(name, n, false)
@@ -87,19 +216,49 @@ func (c *FSCard) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
 	if err != nil {
 		return nil, fs.ToErrno(err)
 	}
-	split := strings.Split(imageURL, ".")
-	suffix := ""
-	if len(split) > 1 {
-		suffix = split[len(split)-1]
+	suffix := fsutil.ImageURLSuffix(imageURL)
+	urls, err := c.s.GetCardImageURLs(ctx, c.title)
+	if err != nil {
+		return nil, fs.ToErrno(err)
 	}
 
 	entries := []fuse.DirEntry{
 		{
 			Name: fsutil.CardJSONFilename,
 		},
+		{
+			Name: fsutil.CardTextFilename,
+		},
 		{
 			Name: fsutil.CardImagePrefix + suffix,
 		},
+		{
+			Name: fsutil.CardThumbnailFilename,
+		},
+		{
+			Name: fsutil.CardDecksDir,
+			Mode: syscall.S_IFDIR,
+		},
+		{
+			Name: fsutil.CardTraitsDir,
+			Mode: syscall.S_IFDIR,
+		},
+		{
+			Name: fsutil.CardSynergiesDir,
+			Mode: syscall.S_IFDIR,
+		},
+	}
+	if suffix != "png" {
+		entries = append(entries, fuse.DirEntry{
+			Name: fsutil.CardPNGFilename,
+		})
+	}
+	for expansion, expansionURL := range urls {
+		entries = append(entries, fuse.DirEntry{
+			Name: fsutil.CardImagePrefix +
+				fsutil.ExpansionShortName(expansion) + "." +
+				fsutil.ImageURLSuffix(expansionURL),
+		})
 	}
 	return fs.NewListDirStream(entries), 0
 }
@@ -111,6 +270,7 @@ type FSCardsDir struct {
 	s  forgefs.Storage
 	im *fsutil.ImageManager
 
+	mu    sync.Mutex
 	cards map[string]string
 }
 
@@ -137,6 +297,35 @@ var _ fs.InodeEmbedder = (*FSCardsDir)(nil)
 var _ fs.NodeLookuper = (*FSCardsDir)(nil)
 var _ fs.NodeReaddirer = (*FSCardsDir)(nil)
 
+// refresh reloads the card titles from storage, and returns the
+// titles that were added and removed.
+func (cd *FSCardsDir) refresh(ctx context.Context) (
+	added, removed []string, err error) {
+	titles, err := cd.s.GetCardTitles(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	cards := make(map[string]string, len(titles))
+	for id, title := range titles {
+		cards[title] = id
+	}
+
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+	for name := range cards {
+		if _, ok := cd.cards[name]; !ok {
+			added = append(added, name)
+		}
+	}
+	for name := range cd.cards {
+		if _, ok := cards[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	cd.cards = cards
+	return added, removed, nil
+}
+
 // Lookup implements the fs.NodeLookuper interface.
 func (cd *FSCardsDir) Lookup(
 	ctx context.Context, name string, out *fuse.EntryOut) (
@@ -146,15 +335,18 @@ func (cd *FSCardsDir) Lookup(
 		return n, 0
 	}
 
+	cd.mu.Lock()
 	id, ok := cd.cards[name]
+	cd.mu.Unlock()
 	if !ok {
 		return nil, syscall.ENOENT
 	}
 
 	n = cd.NewInode(ctx, &FSCard{
-		s:  cd.s,
-		id: id,
-		im: cd.im,
+		s:     cd.s,
+		id:    id,
+		title: name,
+		im:    cd.im,
 	}, fs.StableAttr{
 		Mode: syscall.S_IFDIR,
 	})
@@ -169,6 +361,8 @@ func (cd *FSCardsDir) Lookup(
 // Readdir implements the fs.NodeReaddirer interface.
 func (cd *FSCardsDir) Readdir(ctx context.Context) (
 	fs.DirStream, syscall.Errno) {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
 	entries := make([]fuse.DirEntry, 0, len(cd.cards))
 	for title := range cd.cards {
 		entries = append(entries, fuse.DirEntry{
@@ -312,6 +506,7 @@ type FSDeck struct {
 	s         forgefs.Storage
 	da        forgefs.DataFetcher
 	im        *fsutil.ImageManager
+	medians   *collectionMedians
 	id        string
 	dateAdded time.Time
 }
@@ -328,20 +523,30 @@ func (d *FSDeck) Getattr(
 	return 0
 }
 
-func (d *FSDeck) getDeck(ctx context.Context) (*forgefs.Deck, error) {
-	deck, err := d.s.GetDeck(ctx, d.id)
+// deckNeedsFetch returns true if the given stored deck is missing
+// details that must be fetched remotely.
+func deckNeedsFetch(deck *forgefs.Deck) bool {
+	return len(deck.DeckInfo.Houses) == 0 || deck.SASVersion == 0
+}
+
+// getFullDeck returns the stored deck with the given ID, first
+// fetching and storing any missing details.
+func getFullDeck(
+	ctx context.Context, s forgefs.Storage, da forgefs.DataFetcher,
+	id string) (*forgefs.Deck, error) {
+	deck, err := s.GetDeck(ctx, id)
 	if err != nil {
 		return nil, fs.ToErrno(err)
 	}
 
 	// Lookup the houses if we don't have them yet, and cache that
 	// in the DB.
-	if len(deck.DeckInfo.Houses) == 0 || deck.SASVersion == 0 {
-		newDeck, err := d.da.GetDeck(ctx, d.id, deck)
+	if deckNeedsFetch(deck) {
+		newDeck, err := da.GetDeck(ctx, id, deck)
 		if err != nil {
 			return nil, fs.ToErrno(err)
 		}
-		err = d.s.StoreDecks(ctx, []forgefs.Deck{newDeck})
+		err = s.StoreDecks(ctx, []forgefs.Deck{newDeck})
 		if err != nil {
 			return nil, fs.ToErrno(err)
 		}
@@ -351,40 +556,282 @@ func (d *FSDeck) getDeck(ctx context.Context) (*forgefs.Deck, error) {
 	return deck, nil
 }
 
+func (d *FSDeck) getDeck(ctx context.Context) (*forgefs.Deck, error) {
+	return getFullDeck(ctx, d.s, d.da, d.id)
+}
+
+// getDeckCards returns the stored card data for every card in the
+// given deck, keyed by card title.  Cards that aren't stored are
+// skipped.
+func (d *FSDeck) getDeckCards(
+	ctx context.Context, deck *forgefs.Deck) (
+	map[string]*forgefs.Card, error) {
+	cards := make(map[string]*forgefs.Card)
+	for _, house := range deck.DeckInfo.Houses {
+		for _, c := range house.Cards {
+			if _, ok := cards[c.CardTitle]; ok {
+				continue
+			}
+			card, err := d.s.GetCardByTitle(ctx, c.CardTitle)
+			switch {
+			case err == nil:
+				cards[c.CardTitle] = card
+			case errors.Is(err, forgefs.ErrNotFound):
+			default:
+				return nil, err
+			}
+		}
+	}
+	return cards, nil
+}
+
+// getHouseImages returns the image of every card in the given deck,
+// grouped by house, in deck order and including duplicates.
+func (d *FSDeck) getHouseImages(
+	ctx context.Context, deck *forgefs.Deck) ([][][]byte, error) {
+	cards, err := d.getDeckCards(ctx, deck)
+	if err != nil {
+		return nil, err
+	}
+	houses := make([][][]byte, 0, len(deck.DeckInfo.Houses))
+	for _, house := range deck.DeckInfo.Houses {
+		var images [][]byte
+		for _, c := range house.Cards {
+			card, ok := cards[c.CardTitle]
+			if !ok {
+				continue
+			}
+			data, err := d.im.GetCardImage(ctx, card.ID, "", card.FrontImage)
+			if err != nil {
+				return nil, err
+			}
+			images = append(images, data)
+		}
+		houses = append(houses, images)
+	}
+	return houses, nil
+}
+
+// getProxyImages returns the image of every card in the given deck,
+// in deck order and including duplicates.
+func (d *FSDeck) getProxyImages(
+	ctx context.Context, deck *forgefs.Deck) ([][]byte, error) {
+	houses, err := d.getHouseImages(ctx, deck)
+	if err != nil {
+		return nil, err
+	}
+	var images [][]byte
+	for _, house := range houses {
+		images = append(images, house...)
+	}
+	return images, nil
+}
+
+func (d *FSDeck) getProxySheetSize(ctx context.Context) (
+	uint64, bool, error) {
+	deck, err := d.s.GetDeck(ctx, d.id)
+	if err != nil {
+		return 0, false, err
+	}
+	if deckNeedsFetch(deck) {
+		return 0, false, nil
+	}
+	return d.im.GetDeckProxySheetSize(ctx, d.id, deck.SASVersion)
+}
+
+func (d *FSDeck) openProxySheet(ctx context.Context) (
+	forgefs.ImageFile, uint64, error) {
+	deck, err := d.getDeck(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return d.im.OpenDeckProxySheet(
+		ctx, d.id, deck.SASVersion,
+		func(ctx context.Context) ([][]byte, error) {
+			return d.getProxyImages(ctx, deck)
+		})
+}
+
+// newImageVariantFile returns a file with an image derived from the
+// deck image.
+func (d *FSDeck) newImageVariantFile(variant fsutil.ImageVariant) *FSFile {
+	return &FSFile{
+		mtime: d.dateAdded,
+		getSize: func(ctx context.Context) (uint64, bool, error) {
+			return d.im.GetDeckImageVariantSize(ctx, d.id, variant)
+		},
+		open: func(ctx context.Context) (forgefs.ImageFile, uint64, error) {
+			return d.im.OpenDeckImageVariant(ctx, d.id, variant)
+		},
+	}
+}
+
+func (d *FSDeck) getContactSheetSize(ctx context.Context) (
+	uint64, bool, error) {
+	deck, err := d.s.GetDeck(ctx, d.id)
+	if err != nil {
+		return 0, false, err
+	}
+	if deckNeedsFetch(deck) {
+		return 0, false, nil
+	}
+	return d.im.GetDeckContactSheetSize(ctx, d.id, deck.SASVersion)
+}
+
+func (d *FSDeck) openContactSheet(ctx context.Context) (
+	forgefs.ImageFile, uint64, error) {
+	deck, err := d.getDeck(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return d.im.OpenDeckContactSheet(
+		ctx, d.id, deck.SASVersion,
+		func(ctx context.Context) ([][][]byte, error) {
+			return d.getHouseImages(ctx, deck)
+		})
+}
+
+// getChart returns a radar chart of the deck's stats.  It only needs
+// the stored stats, so nothing is fetched.
+func (d *FSDeck) getChart(ctx context.Context) ([]byte, error) {
+	deck, err := d.s.GetDeck(ctx, d.id)
+	if err != nil {
+		return nil, err
+	}
+	medians, err := d.medians.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	info := deck.DeckInfo
+	return fsutil.FormatDeckRadarSVG(info.Name, forgefs.StatValues{
+		SAS:  float64(info.SasRating),
+		AERC: float64(info.AercScore),
+		A:    info.AmberControl,
+		E:    info.ExpectedAmber,
+		R:    info.ArtifactControl,
+		C:    info.CreatureControl,
+		F:    info.Efficiency,
+		D:    info.Disruption,
+	}, *medians), nil
+}
+
+func formatDeckJSON(
+	_ context.Context, deck *forgefs.Deck) ([]byte, error) {
+	deckJSON, err := json.MarshalIndent(deck, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(deckJSON, '\n'), nil
+}
+
+func (d *FSDeck) deckListFormatter(name string) func(
+	context.Context, *forgefs.Deck) ([]byte, error) {
+	return func(ctx context.Context, deck *forgefs.Deck) ([]byte, error) {
+		cards, err := d.getDeckCards(ctx, deck)
+		if err != nil {
+			return nil, err
+		}
+
+		switch name {
+		case fsutil.DeckTextFilename:
+			return fsutil.FormatDeckText(deck, cards), nil
+		case fsutil.DeckMarkdownFilename:
+			return fsutil.FormatDeckMarkdown(deck, cards), nil
+		case fsutil.DeckCSVFilename:
+			return fsutil.FormatDeckCSV(deck, cards)
+		default:
+			return nil, syscall.ENOENT
+		}
+	}
+}
+
+// newDeckFile returns a file whose contents are generated by `format`
+// from the full deck.  Its size is only known before the file is read
+// if the stored deck doesn't need any more details fetched.
+func (d *FSDeck) newDeckFile(
+	format func(context.Context, *forgefs.Deck) ([]byte, error)) *FSFile {
+	return &FSFile{
+		mtime: d.dateAdded,
+		getSize: func(ctx context.Context) (uint64, bool, error) {
+			deck, err := d.s.GetDeck(ctx, d.id)
+			if err != nil {
+				return 0, false, err
+			}
+			if deckNeedsFetch(deck) {
+				return 0, false, nil
+			}
+			data, err := format(ctx, deck)
+			if err != nil {
+				return 0, false, err
+			}
+			return uint64(len(data)), true, nil
+		},
+		getData: func(ctx context.Context) ([]byte, error) {
+			deck, err := d.getDeck(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return format(ctx, deck)
+		},
+	}
+}
+
 // Lookup implements the fs.NodeLookuper interface.
 func (d *FSDeck) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (
 	*fs.Inode, syscall.Errno) {
 	n := d.GetChild(name)
 	if n != nil {
-		return n, 0
+		return n, fillEntryAttr(ctx, n, out)
 	}
 
 	switch name {
 	case fsutil.DeckJSONFilename:
-		deck, err := d.getDeck(ctx)
-		if err != nil {
-			return nil, fs.ToErrno(err)
-		}
-
-		deckJSON, err := json.MarshalIndent(deck, "", "\t")
-		if err != nil {
-			return nil, fs.ToErrno(err)
-		}
-		deckJSON = append(deckJSON, '\n')
-
-		out.Size = uint64(len(deckJSON))
-		n = d.NewInode(ctx, &fs.MemRegularFile{
-			Data: deckJSON,
-		}, fs.StableAttr{})
+		n = d.NewInode(ctx, d.newDeckFile(formatDeckJSON), fs.StableAttr{})
 	case fsutil.DeckImageFilename:
-		deckImage, err := d.im.GetDeckImage(ctx, d.id)
-		if err != nil {
-			return nil, fs.ToErrno(err)
-		}
-
-		out.Size = uint64(len(deckImage))
-		n = d.NewInode(ctx, &fs.MemRegularFile{
-			Data: deckImage,
+		n = d.NewInode(ctx, &FSFile{
+			mtime: d.dateAdded,
+			getSize: func(ctx context.Context) (uint64, bool, error) {
+				return d.im.GetDeckImageSize(ctx, d.id)
+			},
+			open: func(ctx context.Context) (
+				forgefs.ImageFile, uint64, error) {
+				return d.im.OpenDeckImage(ctx, d.id)
+			},
+		}, fs.StableAttr{})
+	case fsutil.DeckThumbnailFilename:
+		n = d.NewInode(
+			ctx, d.newImageVariantFile(fsutil.ImageVariantThumbnail),
+			fs.StableAttr{})
+	case fsutil.DeckPNGFilename:
+		n = d.NewInode(
+			ctx, d.newImageVariantFile(fsutil.ImageVariantPNG),
+			fs.StableAttr{})
+	case fsutil.DeckTextFilename, fsutil.DeckMarkdownFilename,
+		fsutil.DeckCSVFilename:
+		n = d.NewInode(
+			ctx, d.newDeckFile(d.deckListFormatter(name)), fs.StableAttr{})
+	case fsutil.DeckProxiesFilename:
+		n = d.NewInode(ctx, &FSFile{
+			mtime:   d.dateAdded,
+			getSize: d.getProxySheetSize,
+			open:    d.openProxySheet,
+		}, fs.StableAttr{})
+	case fsutil.DeckContactSheetFilename:
+		n = d.NewInode(ctx, &FSFile{
+			mtime:   d.dateAdded,
+			getSize: d.getContactSheetSize,
+			open:    d.openContactSheet,
+		}, fs.StableAttr{})
+	case fsutil.DeckChartFilename:
+		n = d.NewInode(ctx, &FSFile{
+			mtime:   d.dateAdded,
+			getData: d.getChart,
+		}, fs.StableAttr{})
+	case fsutil.DeckNotesFilename:
+		n = d.NewInode(ctx, &FSDeckNotes{
+			s:     d.s,
+			id:    d.id,
+			mtime: d.dateAdded,
 		}, fs.StableAttr{})
 	case fsutil.DeckCardsDir:
 		deck, err := d.getDeck(ctx)
@@ -401,6 +848,11 @@ func (d *FSDeck) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (
 		return nil, syscall.ENOENT
 	}
 
+	errno := fillEntryAttr(ctx, n, out)
+	if errno != 0 {
+		return nil, errno
+	}
+
 	ok := d.AddChild(name, n, false)
 	if !ok {
 		return nil, syscall.EIO
@@ -417,6 +869,33 @@ func (d *FSDeck) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
 		{
 			Name: fsutil.DeckImageFilename,
 		},
+		{
+			Name: fsutil.DeckThumbnailFilename,
+		},
+		{
+			Name: fsutil.DeckPNGFilename,
+		},
+		{
+			Name: fsutil.DeckTextFilename,
+		},
+		{
+			Name: fsutil.DeckMarkdownFilename,
+		},
+		{
+			Name: fsutil.DeckCSVFilename,
+		},
+		{
+			Name: fsutil.DeckNotesFilename,
+		},
+		{
+			Name: fsutil.DeckProxiesFilename,
+		},
+		{
+			Name: fsutil.DeckContactSheetFilename,
+		},
+		{
+			Name: fsutil.DeckChartFilename,
+		},
 		{
 			Name: fsutil.DeckCardsDir,
 			Mode: syscall.S_IFDIR,
@@ -426,29 +905,37 @@ func (d *FSDeck) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
 }
 
 // FSMyDecksDir represents a directory containing subdirectory for
-// each deck of the user running the program, optionally filtered with
-// constraints.
+// each deck in one of the lists of the user running the program,
+// optionally filtered with constraints.
 type FSMyDecksDir struct {
 	fs.Inode
-	s  forgefs.Storage
-	da forgefs.DataFetcher
-	im *fsutil.ImageManager
+	s       forgefs.Storage
+	da      forgefs.DataFetcher
+	im      *fsutil.ImageManager
+	medians *collectionMedians
 
-	decks      map[string]forgefs.DeckMetadata
+	list       forgefs.DeckList
 	filterRoot *filter.Node
+
+	mu    sync.Mutex
+	decks map[string]forgefs.DeckMetadata
 }
 
-// NewFSMyDecksDir creates a new unfiltered FSMyDecksDir instance.
+// NewFSMyDecksDir creates a new unfiltered FSMyDecksDir instance for
+// the given deck list.
 func NewFSMyDecksDir(
 	ctx context.Context, s forgefs.Storage, da forgefs.DataFetcher,
-	im *fsutil.ImageManager) (*FSMyDecksDir, error) {
+	im *fsutil.ImageManager, medians *collectionMedians,
+	list forgefs.DeckList) (*FSMyDecksDir, error) {
 	mdd := &FSMyDecksDir{
-		s:     s,
-		da:    da,
-		im:    im,
-		decks: make(map[string]forgefs.DeckMetadata),
+		s:       s,
+		da:      da,
+		im:      im,
+		medians: medians,
+		list:    list,
+		decks:   make(map[string]forgefs.DeckMetadata),
 	}
-	mds, err := mdd.s.GetMyDeckMetadata(ctx)
+	mds, err := mdd.s.GetDeckMetadata(ctx, list)
 	if err != nil {
 		return nil, fs.ToErrno(err)
 	}
@@ -462,16 +949,18 @@ func NewFSMyDecksDir(
 // the deck list filtered by the given filter.
 func NewFSMyDecksDirWithFilter(
 	ctx context.Context, s forgefs.Storage, da forgefs.DataFetcher,
-	im *fsutil.ImageManager, filterRoot *filter.Node) (
-	*FSMyDecksDir, error) {
+	im *fsutil.ImageManager, medians *collectionMedians,
+	list forgefs.DeckList, filterRoot *filter.Node) (*FSMyDecksDir, error) {
 	mdd := &FSMyDecksDir{
 		s:          s,
 		da:         da,
 		im:         im,
+		medians:    medians,
+		list:       list,
 		decks:      make(map[string]forgefs.DeckMetadata),
 		filterRoot: filterRoot,
 	}
-	mds, err := mdd.s.GetMyDeckMetadataWithFilter(ctx, filterRoot)
+	mds, err := mdd.s.GetDeckMetadataWithFilter(ctx, list, filterRoot)
 	if err != nil {
 		return nil, fs.ToErrno(err)
 	}
@@ -485,16 +974,128 @@ var _ fs.InodeEmbedder = (*FSMyDecksDir)(nil)
 var _ fs.NodeLookuper = (*FSMyDecksDir)(nil)
 var _ fs.NodeReaddirer = (*FSMyDecksDir)(nil)
 
+// refresh reloads the decks in this directory from storage, and
+// returns the names of the decks that were added and removed.
+func (mdd *FSMyDecksDir) refresh(ctx context.Context) (
+	added, removed []string, err error) {
+	var mds map[string]forgefs.DeckMetadata
+	if mdd.filterRoot == nil {
+		mds, err = mdd.s.GetDeckMetadata(ctx, mdd.list)
+	} else {
+		mds, err = mdd.s.GetDeckMetadataWithFilter(
+			ctx, mdd.list, mdd.filterRoot)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	decks := make(map[string]forgefs.DeckMetadata, len(mds))
+	for _, md := range mds {
+		decks[md.Name] = md
+	}
+
+	mdd.mu.Lock()
+	defer mdd.mu.Unlock()
+	for name := range decks {
+		if _, ok := mdd.decks[name]; !ok {
+			added = append(added, name)
+		}
+	}
+	for name := range mdd.decks {
+		if _, ok := decks[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	mdd.decks = decks
+	return added, removed, nil
+}
+
+// deckInList returns whether the given deck belongs in the given list.
+func deckInList(d forgefs.Deck, list forgefs.DeckList) bool {
+	switch list {
+	case forgefs.DeckListMine:
+		return d.OwnedByMe
+	case forgefs.DeckListWishlist:
+		return d.Wishlist
+	case forgefs.DeckListFunny:
+		return d.Funny
+	default:
+		return false
+	}
+}
+
+// listChangedBy returns whether storing the given deck would add it to
+// or remove it from this unfiltered directory, or rename it here.
+func (mdd *FSMyDecksDir) listChangedBy(d forgefs.Deck) bool {
+	mdd.mu.Lock()
+	defer mdd.mu.Unlock()
+	id := d.DeckInfo.KeyforgeID
+	if deckInList(d, mdd.list) {
+		md, ok := mdd.decks[d.DeckInfo.Name]
+		return !ok || md.ID != id
+	}
+	for _, md := range mdd.decks {
+		if md.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// deckNames returns the names of all the decks in this directory.
+func (mdd *FSMyDecksDir) deckNames() []string {
+	mdd.mu.Lock()
+	defer mdd.mu.Unlock()
+	names := make([]string, 0, len(mdd.decks))
+	for name := range mdd.decks {
+		names = append(names, name)
+	}
+	return names
+}
+
 // Lookup implements the fs.NodeLookuper interface.
 func (mdd *FSMyDecksDir) Lookup(
 	ctx context.Context, name string, out *fuse.EntryOut) (
 	*fs.Inode, syscall.Errno) {
+	// Every lookup of a random selection picks new decks.
+	if count, ok := parseRandomDecksDir(name); ok {
+		n := mdd.NewInode(ctx, &FSRandomDecksDir{
+			names: randomNames(mdd.deckNames(), count),
+		}, fs.StableAttr{
+			Mode: syscall.S_IFDIR,
+		})
+		ok = mdd.AddChild(name, n, true)
+		if !ok {
+			return nil, syscall.EIO
+		}
+		noEntryCache(out)
+		return n, 0
+	}
+
 	n := mdd.GetChild(name)
 	if n != nil {
+		if name == fsutil.RandomDeckLink {
+			noEntryCache(out)
+		}
 		return n, 0
 	}
 
+	if name == fsutil.RandomDeckLink {
+		n = mdd.NewInode(ctx, &FSRandomDeckLink{
+			mdd: mdd,
+		}, fs.StableAttr{
+			Mode: syscall.S_IFLNK,
+		})
+		ok := mdd.AddChild(name, n, false)
+		if !ok {
+			return nil, syscall.EIO
+		}
+		noEntryCache(out)
+		return n, 0
+	}
+
+	mdd.mu.Lock()
 	md, ok := mdd.decks[name]
+	mdd.mu.Unlock()
 	if !ok {
 		// See if it's a filter.
 		filterRoot, err := filter.Parse(name)
@@ -512,7 +1113,7 @@ func (mdd *FSMyDecksDir) Lookup(
 		}
 
 		newMDD, err := NewFSMyDecksDirWithFilter(
-			ctx, mdd.s, mdd.da, mdd.im, filterRoot)
+			ctx, mdd.s, mdd.da, mdd.im, mdd.medians, mdd.list, filterRoot)
 		if err != nil {
 			return nil, fs.ToErrno(err)
 		}
@@ -525,6 +1126,7 @@ func (mdd *FSMyDecksDir) Lookup(
 			da:        mdd.da,
 			id:        md.ID,
 			im:        mdd.im,
+			medians:   mdd.medians,
 			dateAdded: md.DateAdded,
 		}, fs.StableAttr{
 			Mode: syscall.S_IFDIR,
@@ -545,6 +1147,8 @@ func (mdd *FSMyDecksDir) Lookup(
 // Readdir implements the fs.NodeReaddirer interface.
 func (mdd *FSMyDecksDir) Readdir(ctx context.Context) (
 	fs.DirStream, syscall.Errno) {
+	mdd.mu.Lock()
+	defer mdd.mu.Unlock()
 	entries := make([]fuse.DirEntry, 0, len(mdd.decks))
 	for name := range mdd.decks {
 		entries = append(entries, fuse.DirEntry{
@@ -559,9 +1163,20 @@ func (mdd *FSMyDecksDir) Readdir(ctx context.Context) (
 // FSRoot is the root of the file system.
 type FSRoot struct {
 	fs.Inode
-	s  forgefs.Storage
-	da forgefs.DataFetcher
-	im *fsutil.ImageManager
+	s          forgefs.Storage
+	da         forgefs.DataFetcher
+	im         *fsutil.ImageManager
+	medians    *collectionMedians
+	loadConfig func() (*Config, error)
+
+	// Storage updates are queued here for a single background
+	// invalidation worker; see invalidate.go.
+	invalMu      sync.Mutex
+	pending      invalidation
+	invalidating bool
+	// chartVersion is the medians version that the deck charts were
+	// last invalidated for.  Only the invalidation worker uses it.
+	chartVersion uint64
 }
 
 // NewFSRoot creates a new `FSRoot` instance.
@@ -569,15 +1184,23 @@ func NewFSRoot(
 	s forgefs.Storage, da forgefs.DataFetcher,
 	im *fsutil.ImageManager) *FSRoot {
 	return &FSRoot{
-		s:  s,
-		da: da,
-		im: im,
+		s:       s,
+		da:      da,
+		im:      im,
+		medians: &collectionMedians{s: s},
 	}
 }
 
 var _ fs.InodeEmbedder = (*FSRoot)(nil)
 var _ fs.NodeOnAdder = (*FSRoot)(nil)
 
+// SetConfigLoader sets the function used to reload the config file
+// when asked through the control file.  It must be called before the
+// file system is mounted.
+func (r *FSRoot) SetConfigLoader(loadConfig func() (*Config, error)) {
+	r.loadConfig = loadConfig
+}
+
 func (r *FSRoot) getCardsDir(ctx context.Context) (*fs.Inode, error) {
 	cd, err := NewFSCardsDir(ctx, r.s, r.im)
 	if err != nil {
@@ -589,8 +1212,9 @@ func (r *FSRoot) getCardsDir(ctx context.Context) (*fs.Inode, error) {
 	return cdNode, nil
 }
 
-func (r *FSRoot) getMyDecksDir(ctx context.Context) (*fs.Inode, error) {
-	mdd, err := NewFSMyDecksDir(ctx, r.s, r.da, r.im)
+func (r *FSRoot) getDeckListDir(
+	ctx context.Context, list forgefs.DeckList) (*fs.Inode, error) {
+	mdd, err := NewFSMyDecksDir(ctx, r.s, r.da, r.im, r.medians, list)
 	if err != nil {
 		return nil, err
 	}
@@ -600,6 +1224,55 @@ func (r *FSRoot) getMyDecksDir(ctx context.Context) (*fs.Inode, error) {
 	return mddNode, nil
 }
 
+func (r *FSRoot) getSetsDir(ctx context.Context) (*fs.Inode, error) {
+	sd, err := NewFSSetsDir(ctx, r.s)
+	if err != nil {
+		return nil, err
+	}
+	sdNode := r.NewPersistentInode(ctx, sd, fs.StableAttr{
+		Mode: syscall.S_IFDIR,
+	})
+	return sdNode, nil
+}
+
+func (r *FSRoot) getCompareDir(ctx context.Context) *fs.Inode {
+	return r.NewPersistentInode(
+		ctx, NewFSCompareDir(r.s, r.da), fs.StableAttr{
+			Mode: syscall.S_IFDIR,
+		})
+}
+
+func (r *FSRoot) getSearchDir(ctx context.Context) *fs.Inode {
+	return r.NewPersistentInode(ctx, NewFSSearchDir(r.s), fs.StableAttr{
+		Mode: syscall.S_IFDIR,
+	})
+}
+
+func (r *FSRoot) getTraitsDir(ctx context.Context) *fs.Inode {
+	return r.NewPersistentInode(ctx, NewFSTraitsDir(r.s), fs.StableAttr{
+		Mode: syscall.S_IFDIR,
+	})
+}
+
+func (r *FSRoot) getStatsDir(ctx context.Context) *fs.Inode {
+	return r.NewPersistentInode(ctx, NewFSStatsDir(r.s), fs.StableAttr{
+		Mode: syscall.S_IFDIR,
+	})
+}
+
+func (r *FSRoot) getControlDir(ctx context.Context) *fs.Inode {
+	return r.NewPersistentInode(
+		ctx, NewFSControlDir(r.s, r.da, r.im, r.loadConfig), fs.StableAttr{
+			Mode: syscall.S_IFDIR,
+		})
+}
+
+func (r *FSRoot) getTagsDir(ctx context.Context) *fs.Inode {
+	return r.NewPersistentInode(ctx, NewFSTagsDir(r.s), fs.StableAttr{
+		Mode: syscall.S_IFDIR,
+	})
+}
+
 // OnAdd implements the fs.NodeOnAdder interface.
 func (r *FSRoot) OnAdd(ctx context.Context) {
 	cdNode, err := r.getCardsDir(ctx)
@@ -611,7 +1284,7 @@ func (r *FSRoot) OnAdd(ctx context.Context) {
 		panic("Couldn't add cards dir")
 	}
 
-	mddNode, err := r.getMyDecksDir(ctx)
+	mddNode, err := r.getDeckListDir(ctx, forgefs.DeckListMine)
 	if err != nil {
 		panic("Couldn't make my-decks dir")
 	}
@@ -619,4 +1292,61 @@ func (r *FSRoot) OnAdd(ctx context.Context) {
 	if !ok {
 		panic("Couldn't add my-decks dir")
 	}
+
+	wdNode, err := r.getDeckListDir(ctx, forgefs.DeckListWishlist)
+	if err != nil {
+		panic("Couldn't make wishlist dir")
+	}
+	ok = r.AddChild(fsutil.WishlistDir, wdNode, false)
+	if !ok {
+		panic("Couldn't add wishlist dir")
+	}
+
+	fdNode, err := r.getDeckListDir(ctx, forgefs.DeckListFunny)
+	if err != nil {
+		panic("Couldn't make funny dir")
+	}
+	ok = r.AddChild(fsutil.FunnyDir, fdNode, false)
+	if !ok {
+		panic("Couldn't add funny dir")
+	}
+
+	sdNode, err := r.getSetsDir(ctx)
+	if err != nil {
+		panic("Couldn't make sets dir")
+	}
+	ok = r.AddChild(fsutil.SetsDir, sdNode, false)
+	if !ok {
+		panic("Couldn't add sets dir")
+	}
+
+	ok = r.AddChild(fsutil.TagsDir, r.getTagsDir(ctx), false)
+	if !ok {
+		panic("Couldn't add tags dir")
+	}
+
+	ok = r.AddChild(fsutil.CompareDir, r.getCompareDir(ctx), false)
+	if !ok {
+		panic("Couldn't add compare dir")
+	}
+
+	ok = r.AddChild(fsutil.SearchDir, r.getSearchDir(ctx), false)
+	if !ok {
+		panic("Couldn't add search dir")
+	}
+
+	ok = r.AddChild(fsutil.TraitsDir, r.getTraitsDir(ctx), false)
+	if !ok {
+		panic("Couldn't add traits dir")
+	}
+
+	ok = r.AddChild(fsutil.StatsDir, r.getStatsDir(ctx), false)
+	if !ok {
+		panic("Couldn't add stats dir")
+	}
+
+	ok = r.AddChild(fsutil.ControlDir, r.getControlDir(ctx), false)
+	if !ok {
+		panic("Couldn't add control dir")
+	}
 }
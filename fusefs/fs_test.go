@@ -1,13 +1,22 @@
 package fusefs
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
@@ -17,6 +26,7 @@ import (
 	"github.com/strib/forgefs"
 	"github.com/strib/forgefs/filter"
 	"github.com/strib/forgefs/fsutil"
+	"github.com/strib/forgefs/storage"
 )
 
 // Data fetcher.
@@ -62,6 +72,9 @@ func (mcif *mockCardImageFetcher) GetCardImage(
 type mockDeckImageFetcher struct {
 	suffix     string
 	deckImages map[string][]byte // id -> image
+	fetches    int
+	// errs, if not nil, records failed fetches of missing images.
+	errs []forgefs.ErrorRecord
 }
 
 func (mdif *mockDeckImageFetcher) GetDeckImageSuffix() string {
@@ -71,28 +84,65 @@ func (mdif *mockDeckImageFetcher) GetDeckImageSuffix() string {
 func (mdif *mockDeckImageFetcher) GetDeckImage(
 	_ context.Context, deckID string) (
 	data []byte, err error) {
-	return mdif.deckImages[deckID], nil
+	mdif.fetches++
+	data, ok := mdif.deckImages[deckID]
+	if !ok && mdif.errs != nil {
+		err := errors.New("No image for " + deckID)
+		mdif.errs = append(mdif.errs, forgefs.ErrorRecord{
+			Time:   time.Now(),
+			Source: "mock",
+			Error:  err.Error(),
+		})
+		return nil, err
+	}
+	return data, nil
+}
+
+func (mdif *mockDeckImageFetcher) ClientStats() forgefs.ClientStats {
+	return forgefs.ClientStats{
+		Name:     "mock",
+		Requests: int64(mdif.fetches),
+		Errors:   int64(len(mdif.errs)),
+	}
+}
+
+func (mdif *mockDeckImageFetcher) RecentErrors() []forgefs.ErrorRecord {
+	return mdif.errs
 }
 
 // Storage.
 
 type mockStorage struct {
-	cards map[string]forgefs.Card // id -> Card
-	decks map[string]forgefs.Deck // id -> Deck
+	cards map[string]forgefs.Card    // id -> Card
+	decks map[string]forgefs.Deck    // id -> Deck
+	notes map[string]string          // id -> notes
+	tags  map[string]map[string]bool // tag -> deck IDs
+	syncs map[string]time.Time       // kind -> time
+
+	medianQueries   int32
+	metadataQueries int32
+
+	observer forgefs.StorageObserver
 }
 
 func newMockStorage() *mockStorage {
 	return &mockStorage{
 		cards: make(map[string]forgefs.Card),
 		decks: make(map[string]forgefs.Deck),
+		notes: make(map[string]string),
+		tags:  make(map[string]map[string]bool),
+		syncs: make(map[string]time.Time),
 	}
 }
 
 func (ms *mockStorage) StoreCards(
-	_ context.Context, cards []forgefs.Card) error {
+	ctx context.Context, cards []forgefs.Card) error {
 	for _, c := range cards {
 		ms.cards[c.ID] = c
 	}
+	if ms.observer != nil {
+		ms.observer.CardsUpdated(ctx, cards)
+	}
 	return nil
 }
 
@@ -110,25 +160,150 @@ func (ms *mockStorage) GetCardImageURL(_ context.Context, id string) (
 	return ms.cards[id].FrontImage, nil
 }
 
+func (ms *mockStorage) GetCardImageURLs(_ context.Context, title string) (
+	urls map[string]string, err error) {
+	urls = make(map[string]string)
+	for _, c := range ms.cards {
+		if c.CardTitle == title && c.ExpansionEnum != "" &&
+			c.FrontImage != "" {
+			urls[c.ExpansionEnum] = c.FrontImage
+		}
+	}
+	return urls, nil
+}
+
 func (ms *mockStorage) GetCard(_ context.Context, id string) (
 	card *forgefs.Card, err error) {
 	c := ms.cards[id]
 	return &c, nil
 }
 
+func (ms *mockStorage) GetCardSummary(_ context.Context, id string) (
+	summary *forgefs.CardSummary, err error) {
+	c, ok := ms.cards[id]
+	if !ok {
+		return nil, forgefs.ErrNotFound
+	}
+	return &forgefs.CardSummary{
+		House:     c.House,
+		Type:      c.CardType,
+		Rarity:    c.Rarity,
+		Expansion: c.ExpansionEnum,
+		AERC:      c.AERCScore,
+	}, nil
+}
+
+func (ms *mockStorage) GetCardByTitle(_ context.Context, title string) (
+	card *forgefs.Card, err error) {
+	for _, c := range ms.cards {
+		if c.CardTitle == title {
+			c := c
+			return &c, nil
+		}
+	}
+	return nil, forgefs.ErrNotFound
+}
+
+func (ms *mockStorage) GetCardNumbers(_ context.Context) (
+	numbers map[string][]forgefs.CardNumber, err error) {
+	numbers = make(map[string][]forgefs.CardNumber, len(ms.cards))
+	for id, c := range ms.cards {
+		if len(c.CardNumbers) > 0 {
+			numbers[id] = c.CardNumbers
+		}
+	}
+	return numbers, nil
+}
+
+func (ms *mockStorage) SearchCards(_ context.Context, query string) (
+	titles []string, err error) {
+	query = strings.ToLower(query)
+	for _, c := range ms.cards {
+		if strings.Contains(strings.ToLower(c.CardTitle), query) ||
+			strings.Contains(strings.ToLower(c.CardText), query) {
+			titles = append(titles, c.CardTitle)
+		}
+	}
+	sort.Strings(titles)
+	return titles, nil
+}
+
+func (ms *mockStorage) GetTraits(_ context.Context) (
+	traits []string, err error) {
+	seen := make(map[string]bool)
+	for _, c := range ms.cards {
+		for _, t := range append(
+			c.ExtraCardInfo.Traits, c.ExtraCardInfo.Synergies...) {
+			if !seen[t.Trait] {
+				seen[t.Trait] = true
+				traits = append(traits, t.Trait)
+			}
+		}
+	}
+	sort.Strings(traits)
+	return traits, nil
+}
+
+func (ms *mockStorage) GetCardsWithTrait(_ context.Context, trait string) (
+	providers, synergies []string, err error) {
+	hasTrait := func(traits []forgefs.Trait) bool {
+		for _, t := range traits {
+			if t.Trait == trait {
+				return true
+			}
+		}
+		return false
+	}
+	for _, c := range ms.cards {
+		if hasTrait(c.ExtraCardInfo.Traits) {
+			providers = append(providers, c.CardTitle)
+		}
+		if hasTrait(c.ExtraCardInfo.Synergies) {
+			synergies = append(synergies, c.CardTitle)
+		}
+	}
+	sort.Strings(providers)
+	sort.Strings(synergies)
+	return providers, synergies, nil
+}
+
 func (ms *mockStorage) StoreDecks(
-	_ context.Context, decks []forgefs.Deck) error {
+	ctx context.Context, decks []forgefs.Deck) error {
 	for _, d := range decks {
 		ms.decks[d.DeckInfo.KeyforgeID] = d
 	}
+	if ms.observer != nil {
+		ms.observer.DecksUpdated(ctx, decks)
+	}
+	return nil
+}
+
+func (ms *mockStorage) SetObserver(o forgefs.StorageObserver) {
+	ms.observer = o
+}
+
+func (ms *mockStorage) SetSyncTime(
+	_ context.Context, kind string, t time.Time) error {
+	ms.syncs[kind] = t
 	return nil
 }
 
-func (ms *mockStorage) GetMyDeckMetadata(_ context.Context) (
+func (ms *mockStorage) GetSyncTimes(_ context.Context) (
+	times map[string]time.Time, err error) {
+	times = make(map[string]time.Time, len(ms.syncs))
+	for kind, t := range ms.syncs {
+		times[kind] = t
+	}
+	return times, nil
+}
+
+func (ms *mockStorage) GetDeckMetadata(
+	_ context.Context, list forgefs.DeckList) (
 	mds map[string]forgefs.DeckMetadata, err error) {
+	atomic.AddInt32(&ms.metadataQueries, 1)
 	mds = make(map[string]forgefs.DeckMetadata, len(ms.decks))
 	for id, d := range ms.decks {
-		if d.OwnedByMe {
+		if deckInList(d, list) {
 			dateAdded, err := time.Parse("2006-01-02", d.DeckInfo.DateAdded)
 			if err != nil {
 				return nil, err
@@ -203,12 +378,12 @@ func mockFilter(n *filter.Node, d forgefs.Deck) (bool, error) {
 	}
 }
 
-func (ms *mockStorage) GetMyDeckMetadataWithFilter(
-	_ context.Context, filterRoot *filter.Node) (
+func (ms *mockStorage) GetDeckMetadataWithFilter(
+	_ context.Context, list forgefs.DeckList, filterRoot *filter.Node) (
 	mds map[string]forgefs.DeckMetadata, err error) {
 	mds = make(map[string]forgefs.DeckMetadata)
 	for id, d := range ms.decks {
-		if !d.OwnedByMe {
+		if !deckInList(d, list) {
 			continue
 		}
 
@@ -244,14 +419,216 @@ func (ms *mockStorage) Reset(ctx context.Context) error {
 
 func (ms *mockStorage) GetDeck(_ context.Context, id string) (
 	deck *forgefs.Deck, err error) {
-	d := ms.decks[id]
+	d, ok := ms.decks[id]
+	if !ok {
+		return nil, forgefs.ErrNotFound
+	}
 	return &d, nil
 }
 
+func (ms *mockStorage) GetDeckNotes(_ context.Context, id string) (
+	notes string, err error) {
+	d, ok := ms.decks[id]
+	if !ok {
+		return "", forgefs.ErrNotFound
+	}
+	notes, ok = ms.notes[id]
+	if !ok {
+		return d.Notes, nil
+	}
+	return notes, nil
+}
+
+func (ms *mockStorage) StoreDeckNotes(
+	_ context.Context, id, notes string) error {
+	ms.notes[id] = notes
+	return nil
+}
+
+func (ms *mockStorage) GetTags(_ context.Context) (
+	tags []string, err error) {
+	for tag := range ms.tags {
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+func (ms *mockStorage) CreateTag(_ context.Context, tag string) error {
+	if _, ok := ms.tags[tag]; !ok {
+		ms.tags[tag] = make(map[string]bool)
+	}
+	return nil
+}
+
+func (ms *mockStorage) DeleteTag(_ context.Context, tag string) error {
+	delete(ms.tags, tag)
+	return nil
+}
+
+func (ms *mockStorage) TagDeck(_ context.Context, tag, id string) error {
+	ms.tags[tag][id] = true
+	return nil
+}
+
+func (ms *mockStorage) UntagDeck(_ context.Context, tag, id string) error {
+	delete(ms.tags[tag], id)
+	return nil
+}
+
+func (ms *mockStorage) GetTaggedDeckMetadata(
+	ctx context.Context, tag string) (
+	mds map[string]forgefs.DeckMetadata, err error) {
+	myMDs, err := ms.GetDeckMetadata(ctx, forgefs.DeckListMine)
+	if err != nil {
+		return nil, err
+	}
+	mds = make(map[string]forgefs.DeckMetadata)
+	for id := range ms.tags[tag] {
+		if md, ok := myMDs[id]; ok {
+			mds[id] = md
+		}
+	}
+	return mds, nil
+}
+
+func (ms *mockStorage) GetDecksWithCard(
+	ctx context.Context, title string) (
+	decks []forgefs.DeckCardCount, err error) {
+	mds, err := ms.GetDeckMetadata(ctx, forgefs.DeckListMine)
+	if err != nil {
+		return nil, err
+	}
+	for id, md := range mds {
+		count := 0
+		for _, h := range ms.decks[id].DeckInfo.Houses {
+			for _, c := range h.Cards {
+				if c.CardTitle == title {
+					count++
+				}
+			}
+		}
+		if count > 0 {
+			decks = append(decks, forgefs.DeckCardCount{
+				DeckMetadata: md,
+				Count:        count,
+			})
+		}
+	}
+	return decks, nil
+}
+
+func (ms *mockStorage) GetUnfetchedDeckCount(ctx context.Context) (
+	count int, err error) {
+	mds, err := ms.GetDeckMetadata(ctx, forgefs.DeckListMine)
+	if err != nil {
+		return 0, err
+	}
+	for id := range mds {
+		if len(ms.decks[id].DeckInfo.Houses) == 0 {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (ms *mockStorage) GetCollectionStats(ctx context.Context) (
+	stats *forgefs.CollectionStats, err error) {
+	var cs forgefs.CollectionStats
+	expansions := make(map[string]*forgefs.GroupStats)
+	for _, d := range ms.decks {
+		if !d.OwnedByMe {
+			continue
+		}
+		info := d.DeckInfo
+		score := forgefs.DeckScore{
+			ID: info.KeyforgeID, Name: info.Name, SAS: info.SasRating,
+		}
+		cs.Decks++
+		cs.TopDecks = append(cs.TopDecks, score)
+		min := info.SasRating / 5 * 5
+		found := false
+		for i := range cs.SASHistogram {
+			if cs.SASHistogram[i].Min == min {
+				cs.SASHistogram[i].Decks++
+				found = true
+			}
+		}
+		if !found {
+			cs.SASHistogram = append(cs.SASHistogram, forgefs.SASBucket{
+				Min: min, Max: min + 4, Decks: 1,
+			})
+		}
+		g, ok := expansions[info.Expansion]
+		if !ok {
+			g = &forgefs.GroupStats{Name: info.Expansion}
+			expansions[info.Expansion] = g
+		}
+		g.Decks++
+		if g.Decks == 1 || score.SAS > g.TopDeck.SAS {
+			g.TopDeck = score
+		}
+	}
+	sort.Slice(cs.TopDecks, func(i, j int) bool {
+		return cs.TopDecks[i].SAS > cs.TopDecks[j].SAS
+	})
+	for _, g := range expansions {
+		cs.ByExpansion = append(cs.ByExpansion, *g)
+	}
+	sort.Slice(cs.ByExpansion, func(i, j int) bool {
+		return cs.ByExpansion[i].Name < cs.ByExpansion[j].Name
+	})
+	cs.UnfetchedDecks, err = ms.GetUnfetchedDeckCount(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &cs, nil
+}
+
+func (ms *mockStorage) GetCollectionMedians(_ context.Context) (
+	medians *forgefs.StatValues, err error) {
+	atomic.AddInt32(&ms.medianQueries, 1)
+	var as []float64
+	for _, d := range ms.decks {
+		if d.OwnedByMe {
+			as = append(as, d.DeckInfo.AmberControl)
+		}
+	}
+	sort.Float64s(as)
+	medians = &forgefs.StatValues{}
+	if len(as) > 0 {
+		medians.A = as[len(as)/2]
+	}
+	return medians, nil
+}
+
+func (ms *mockStorage) GetDeckSummary(_ context.Context, id string) (
+	summary *forgefs.DeckSummary, err error) {
+	d, ok := ms.decks[id]
+	if !ok {
+		return nil, forgefs.ErrNotFound
+	}
+	info := d.DeckInfo
+	ds := &forgefs.DeckSummary{
+		Expansion: info.Expansion,
+		SAS:       info.SasRating,
+		AERC:      info.AercScore,
+		A:         info.AmberControl,
+		E:         info.ExpectedAmber,
+		R:         info.ArtifactControl,
+		C:         info.CreatureControl,
+		F:         info.Efficiency,
+		D:         info.Disruption,
+	}
+	for _, h := range info.Houses {
+		ds.Houses = append(ds.Houses, h.House)
+	}
+	return ds, nil
+}
+
 // Image cache.
 
 type mockImageCache struct {
-	cards map[string][]byte // id+suffix -> data
+	cards map[string][]byte // id+expansion+suffix -> data
 	decks map[string][]byte // id+suffix -> data
 }
 
@@ -262,18 +639,33 @@ func newMockImageCache() *mockImageCache {
 	}
 }
 
+func (mic *mockImageCache) Clear(_ context.Context) error {
+	mic.cards = make(map[string][]byte)
+	mic.decks = make(map[string][]byte)
+	return nil
+}
+
 func (mic *mockImageCache) GetCardImage(
-	_ context.Context, cardID, fileType string) ([]byte, bool, error) {
-	data, ok := mic.cards[cardID+"."+fileType]
+	_ context.Context, cardID, expansion, fileType string) (
+	[]byte, bool, error) {
+	data, ok := mic.cards[cardID+"."+expansion+"."+fileType]
 	if !ok {
 		return nil, false, nil
 	}
 	return data, true, nil
 }
 
+func (mic *mockImageCache) GetCardImageSize(
+	_ context.Context, cardID, expansion, fileType string) (
+	int64, bool, error) {
+	data, ok := mic.cards[cardID+"."+expansion+"."+fileType]
+	return int64(len(data)), ok, nil
+}
+
 func (mic *mockImageCache) StoreCardImage(
-	_ context.Context, cardID, fileType string, data []byte) error {
-	mic.cards[cardID+"."+fileType] = data
+	_ context.Context, cardID, expansion, fileType string,
+	data []byte) error {
+	mic.cards[cardID+"."+expansion+"."+fileType] = data
 	return nil
 }
 
@@ -286,12 +678,46 @@ func (mic *mockImageCache) GetDeckImage(
 	return data, true, nil
 }
 
+func (mic *mockImageCache) GetDeckImageSize(
+	_ context.Context, deckID, fileType string) (int64, bool, error) {
+	data, ok := mic.decks[deckID+"."+fileType]
+	return int64(len(data)), ok, nil
+}
+
 func (mic *mockImageCache) StoreDeckImage(
 	_ context.Context, deckID, fileType string, data []byte) error {
 	mic.decks[deckID+"."+fileType] = data
 	return nil
 }
 
+type mockImageFile struct {
+	*bytes.Reader
+}
+
+func (mif mockImageFile) Close() error {
+	return nil
+}
+
+func (mic *mockImageCache) OpenCardImage(
+	_ context.Context, cardID, expansion, fileType string) (
+	forgefs.ImageFile, int64, bool, error) {
+	data, ok := mic.cards[cardID+"."+expansion+"."+fileType]
+	if !ok {
+		return nil, 0, false, nil
+	}
+	return mockImageFile{bytes.NewReader(data)}, int64(len(data)), true, nil
+}
+
+func (mic *mockImageCache) OpenDeckImage(
+	_ context.Context, deckID, fileType string) (
+	forgefs.ImageFile, int64, bool, error) {
+	data, ok := mic.decks[deckID+"."+fileType]
+	if !ok {
+		return nil, 0, false, nil
+	}
+	return mockImageFile{bytes.NewReader(data)}, int64(len(data)), true, nil
+}
+
 func readyMountTmpDir(t *testing.T) (
 	mountpoint string, root *FSRoot, mdf *mockDataFetcher,
 	mcif *mockCardImageFetcher, mdif *mockDeckImageFetcher, ms *mockStorage) {
@@ -302,7 +728,8 @@ func readyMountTmpDir(t *testing.T) (
 
 	mcif = &mockCardImageFetcher{}
 	mdif = &mockDeckImageFetcher{suffix: "jpg"}
-	im := fsutil.NewImageManager(mcif, mdif, newMockImageCache())
+	im := fsutil.NewImageManager(
+		mcif, mdif, newMockImageCache(), fsutil.ImageManagerOptions{})
 	ms = newMockStorage()
 	mdf = &mockDataFetcher{}
 	root = NewFSRoot(ms, mdf, im)
@@ -311,10 +738,20 @@ func readyMountTmpDir(t *testing.T) (
 }
 
 func mountTmpDir(t *testing.T, mountpoint string, root *FSRoot) {
+	mountTmpDirWithTimeout(t, mountpoint, root, 0)
+}
+
+// mountTmpDirWithTimeout mounts the file system, letting the kernel
+// cache entries and attributes for `timeout`.
+func mountTmpDirWithTimeout(
+	t *testing.T, mountpoint string, root *FSRoot, timeout time.Duration) {
 	server, err := fs.Mount(mountpoint, root, &fs.Options{
 		MountOptions: fuse.MountOptions{
 			Debug: false,
 		},
+		EntryTimeout:    &timeout,
+		AttrTimeout:     &timeout,
+		NegativeTimeout: &timeout,
 	})
 	require.NoError(t, err)
 
@@ -444,7 +881,11 @@ func TestFSSimple(t *testing.T) {
 	checkDir := func(dir string, expectedNames []string) {
 		checkDirWithTimestamps(dir, expectedNames, nil)
 	}
-	checkDir(mountpoint, []string{fsutil.CardsDir, fsutil.MyDecksDir})
+	checkDir(mountpoint, []string{
+		fsutil.CardsDir, fsutil.MyDecksDir, fsutil.WishlistDir,
+		fsutil.FunnyDir, fsutil.SetsDir, fsutil.TagsDir, fsutil.CompareDir,
+		fsutil.SearchDir, fsutil.TraitsDir, fsutil.StatsDir,
+		fsutil.ControlDir})
 
 	// Check cards.
 	cardsDir := filepath.Join(mountpoint, fsutil.CardsDir)
@@ -455,6 +896,12 @@ func TestFSSimple(t *testing.T) {
 	checkDir(c1Dir, []string{
 		fsutil.CardImagePrefix + "jpg",
 		fsutil.CardJSONFilename,
+		fsutil.CardTextFilename,
+		fsutil.CardThumbnailFilename,
+		fsutil.CardPNGFilename,
+		fsutil.CardDecksDir,
+		fsutil.CardTraitsDir,
+		fsutil.CardSynergiesDir,
 	})
 
 	// Check card image.
@@ -476,6 +923,11 @@ func TestFSSimple(t *testing.T) {
 	require.NoError(t, err)
 	checkFile(c1JSONFile, append(c1JSON, '\n'))
 
+	// Check card text.
+	checkFile(
+		filepath.Join(c1Dir, fsutil.CardTextFilename),
+		fsutil.FormatCardText(&c1))
+
 	// Check my-decks dir.
 	decksDir := filepath.Join(mountpoint, fsutil.MyDecksDir)
 	checkDirWithTimestamps(
@@ -491,6 +943,15 @@ func TestFSSimple(t *testing.T) {
 		fsutil.DeckJSONFilename,
 		fsutil.DeckCardsDir,
 		fsutil.DeckImageFilename,
+		fsutil.DeckThumbnailFilename,
+		fsutil.DeckPNGFilename,
+		fsutil.DeckTextFilename,
+		fsutil.DeckMarkdownFilename,
+		fsutil.DeckCSVFilename,
+		fsutil.DeckNotesFilename,
+		fsutil.DeckProxiesFilename,
+		fsutil.DeckContactSheetFilename,
+		fsutil.DeckChartFilename,
 	})
 
 	// Check deck image.
@@ -504,6 +965,18 @@ func TestFSSimple(t *testing.T) {
 	require.NoError(t, err)
 	checkFile(d1JSONFile, append(d1JSON, '\n'))
 
+	// Check the decklists.
+	d1Cards := map[string]*forgefs.Card{c1Title: &c1, c2Title: &c2}
+	checkFile(
+		filepath.Join(d1Dir, fsutil.DeckTextFilename),
+		fsutil.FormatDeckText(&d1, d1Cards))
+	checkFile(
+		filepath.Join(d1Dir, fsutil.DeckMarkdownFilename),
+		fsutil.FormatDeckMarkdown(&d1, d1Cards))
+	d1CSV, err := fsutil.FormatDeckCSV(&d1, d1Cards)
+	require.NoError(t, err)
+	checkFile(filepath.Join(d1Dir, fsutil.DeckCSVFilename), d1CSV)
+
 	// Check cards for the deck.
 	d1CardsDir := filepath.Join(d1Dir, fsutil.DeckCardsDir)
 	checkDir(d1CardsDir, []string{h1, h2, h3})
@@ -517,6 +990,12 @@ func TestFSSimple(t *testing.T) {
 	checkDir(c1ViaDeckDir, []string{
 		fsutil.CardImagePrefix + "jpg",
 		fsutil.CardJSONFilename,
+		fsutil.CardTextFilename,
+		fsutil.CardThumbnailFilename,
+		fsutil.CardPNGFilename,
+		fsutil.CardDecksDir,
+		fsutil.CardTraitsDir,
+		fsutil.CardSynergiesDir,
 	})
 	c1ViaDeckJSONFile := filepath.Join(c1ViaDeckDir, fsutil.CardJSONFilename)
 	require.NoError(t, err)
@@ -540,3 +1019,1266 @@ func TestFSSimple(t *testing.T) {
 	filteredDecksDir = filepath.Join(decksDir, "a=5:,(e=:25^e=35:)")
 	checkDir(filteredDecksDir, []string{d1Name})
 }
+
+func TestFSSets(t *testing.T) {
+	ctx := context.Background()
+	mountpoint, root, _, _, _, ms := readyMountTmpDir(t)
+
+	c1 := makeCard("1", "card1", "card1.jpg")
+	c1.CardNumbers = []forgefs.CardNumber{
+		{Expansion: "MASS_MUTATION", CardNumber: "12"},
+		{Expansion: "DARK_TIDINGS", CardNumber: "3"},
+	}
+	c2 := makeCard("2", "card2", "card2.jpg")
+	c2.CardNumbers = []forgefs.CardNumber{
+		{Expansion: "MASS_MUTATION", CardNumber: "2"},
+	}
+	err := ms.StoreCards(ctx, []forgefs.Card{c1, c2})
+	require.NoError(t, err)
+
+	mountTmpDir(t, mountpoint, root)
+
+	setsDir := filepath.Join(mountpoint, fsutil.SetsDir)
+	entries, err := os.ReadDir(setsDir)
+	require.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	require.ElementsMatch(t, []string{"MM", "DT"}, names)
+
+	mmDir := filepath.Join(setsDir, "MM")
+	entries, err = os.ReadDir(mmDir)
+	require.NoError(t, err)
+	names = names[:0]
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	require.ElementsMatch(t, []string{"002 - card2", "012 - card1"}, names)
+
+	link, err := os.Readlink(filepath.Join(mmDir, "012 - card1"))
+	require.NoError(t, err)
+	require.Equal(t, "../../"+fsutil.CardsDir+"/card1", link)
+
+	// The symlink should resolve to the real card directory.
+	entries, err = os.ReadDir(filepath.Join(setsDir, "DT", "003 - card1"))
+	require.NoError(t, err)
+	require.Len(t, entries, 8)
+}
+
+func TestFSXattrs(t *testing.T) {
+	ctx := context.Background()
+	mountpoint, root, _, _, _, ms := readyMountTmpDir(t)
+
+	c1 := makeCard("1", "card1", "card1.jpg")
+	c1.House = "Logos"
+	c1.CardType = "Creature"
+	c1.Rarity = "Rare"
+	c1.AERCScore = 2.5
+	err := ms.StoreCards(ctx, []forgefs.Card{c1})
+	require.NoError(t, err)
+
+	dateAdded, err := time.Parse("2006-01-02", "2023-01-01")
+	require.NoError(t, err)
+	d1 := makeDeck("3", "deck1", true, 10.5, 20, dateAdded)
+	d1.DeckInfo.SasRating = 75
+	d1.DeckInfo.Expansion = "MASS_MUTATION"
+	d1.DeckInfo.Houses = []forgefs.HouseInDeck{
+		{House: "Logos"}, {House: "Mars"}, {House: "Dis"},
+	}
+	err = ms.StoreDecks(ctx, []forgefs.Deck{d1})
+	require.NoError(t, err)
+
+	mountTmpDir(t, mountpoint, root)
+
+	getxattr := func(path, attr string) string {
+		size, err := syscall.Getxattr(path, attr, nil)
+		require.NoError(t, err)
+		dest := make([]byte, size)
+		size, err = syscall.Getxattr(path, attr, dest)
+		require.NoError(t, err)
+		return string(dest[:size])
+	}
+
+	d1Dir := filepath.Join(mountpoint, fsutil.MyDecksDir, "deck1")
+	require.Equal(t, "75", getxattr(d1Dir, "user.forgefs.sas"))
+	require.Equal(t, "Logos,Mars,Dis", getxattr(d1Dir, "user.forgefs.houses"))
+	require.Equal(t, "MM", getxattr(d1Dir, "user.forgefs.expansion"))
+	require.Equal(t, "10.5", getxattr(d1Dir, "user.forgefs.a"))
+	_, err = syscall.Getxattr(d1Dir, "user.forgefs.nope", nil)
+	require.Equal(t, syscall.ENODATA, err)
+
+	size, err := syscall.Listxattr(d1Dir, nil)
+	require.NoError(t, err)
+	dest := make([]byte, size)
+	_, err = syscall.Listxattr(d1Dir, dest)
+	require.NoError(t, err)
+	require.Contains(t, string(dest), "user.forgefs.aerc\x00")
+
+	c1Dir := filepath.Join(mountpoint, fsutil.CardsDir, "card1")
+	require.Equal(t, "Logos", getxattr(c1Dir, "user.forgefs.house"))
+	require.Equal(t, "Creature", getxattr(c1Dir, "user.forgefs.type"))
+	require.Equal(t, "Rare", getxattr(c1Dir, "user.forgefs.rarity"))
+	require.Equal(t, "2.5", getxattr(c1Dir, "user.forgefs.aerc"))
+}
+
+func TestFSLazyFiles(t *testing.T) {
+	ctx := context.Background()
+	mountpoint, root, mdf, _, mdif, ms := readyMountTmpDir(t)
+
+	dateAdded, err := time.Parse("2006-01-02", "2023-01-01")
+	require.NoError(t, err)
+	d1 := makeDeck("1", "deck1", true, 10, 20, dateAdded)
+	err = ms.StoreDecks(ctx, []forgefs.Deck{d1})
+	require.NoError(t, err)
+	d1Image := []byte{1, 2, 3, 4, 5}
+	mdif.deckImages = map[string][]byte{"1": d1Image}
+
+	// The fetched version of the deck has more details than the
+	// stored one.
+	d1.DeckInfo.Houses = []forgefs.HouseInDeck{{House: "Logos"}}
+	d1.SASVersion = 42
+	mdf.myDecks = map[string]forgefs.Deck{"1": d1}
+
+	mountTmpDir(t, mountpoint, root)
+
+	d1Dir := filepath.Join(mountpoint, fsutil.MyDecksDir, "deck1")
+
+	// Stat-ing an uncached image doesn't fetch it.
+	imageFile := filepath.Join(d1Dir, fsutil.DeckImageFilename)
+	fi, err := os.Stat(imageFile)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), fi.Size())
+	require.Equal(t, 0, mdif.fetches)
+
+	// Reading it gets the full data, even though the size was
+	// unknown.
+	data, err := os.ReadFile(imageFile)
+	require.NoError(t, err)
+	require.Equal(t, d1Image, data)
+	require.Equal(t, 1, mdif.fetches)
+	fi, err = os.Stat(imageFile)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(d1Image)), fi.Size())
+
+	// Reading the JSON fetches the full deck, and then the size
+	// matches the stored version.
+	jsonFile := filepath.Join(d1Dir, fsutil.DeckJSONFilename)
+	data, err = os.ReadFile(jsonFile)
+	require.NoError(t, err)
+	d1JSON, err := json.MarshalIndent(d1, "", "\t")
+	require.NoError(t, err)
+	require.Equal(t, append(d1JSON, '\n'), data)
+	fi, err = os.Stat(jsonFile)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), fi.Size())
+
+	// Files of fully-stored decks have the right size up front.
+	fi, err = os.Stat(filepath.Join(d1Dir, fsutil.DeckTextFilename))
+	require.NoError(t, err)
+	require.Equal(t, int64(len(fsutil.FormatDeckText(
+		&d1, map[string]*forgefs.Card{}))), fi.Size())
+}
+
+func TestFSDeckNotes(t *testing.T) {
+	ctx := context.Background()
+	mountpoint, root, _, _, _, ms := readyMountTmpDir(t)
+
+	dateAdded, err := time.Parse("2006-01-02", "2023-01-01")
+	require.NoError(t, err)
+	d1 := makeDeck("1", "deck1", true, 10, 20, dateAdded)
+	d1.Notes = "from dok"
+	err = ms.StoreDecks(ctx, []forgefs.Deck{d1})
+	require.NoError(t, err)
+
+	mountTmpDir(t, mountpoint, root)
+
+	notesFile := filepath.Join(
+		mountpoint, fsutil.MyDecksDir, "deck1", fsutil.DeckNotesFilename)
+
+	// Notes start out as the fetched deck notes.
+	data, err := os.ReadFile(notesFile)
+	require.NoError(t, err)
+	require.Equal(t, "from dok", string(data))
+
+	// Overwrite them.
+	err = os.WriteFile(notesFile, []byte("mine"), 0644)
+	require.NoError(t, err)
+	data, err = os.ReadFile(notesFile)
+	require.NoError(t, err)
+	require.Equal(t, "mine", string(data))
+	require.Equal(t, "mine", ms.notes["1"])
+
+	// Append to them.
+	f, err := os.OpenFile(notesFile, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString(", all mine")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	data, err = os.ReadFile(notesFile)
+	require.NoError(t, err)
+	require.Equal(t, "mine, all mine", string(data))
+
+	// Truncate them.
+	err = os.Truncate(notesFile, 4)
+	require.NoError(t, err)
+	fi, err := os.Stat(notesFile)
+	require.NoError(t, err)
+	require.Equal(t, int64(4), fi.Size())
+	require.Equal(t, "mine", ms.notes["1"])
+
+	// Overwriting them while a reader has them open doesn't let the
+	// reader's copy clobber the new notes.
+	reader, err := os.Open(notesFile)
+	require.NoError(t, err)
+	defer reader.Close()
+	buf := make([]byte, 10)
+	n, err := reader.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "mine", string(buf[:n]))
+	err = os.WriteFile(notesFile, []byte("x"), 0644)
+	require.NoError(t, err)
+	n, err = reader.ReadAt(buf, 0)
+	require.ErrorIs(t, err, io.EOF)
+	require.Equal(t, "mine", string(buf[:n]))
+	require.NoError(t, reader.Close())
+	data, err = os.ReadFile(notesFile)
+	require.NoError(t, err)
+	require.Equal(t, "x", string(data))
+	require.Equal(t, "x", ms.notes["1"])
+}
+
+func TestFSTags(t *testing.T) {
+	ctx := context.Background()
+	mountpoint, root, _, _, _, ms := readyMountTmpDir(t)
+
+	dateAdded, err := time.Parse("2006-01-02", "2023-01-01")
+	require.NoError(t, err)
+	d1 := makeDeck("1", "deck1", true, 10, 20, dateAdded)
+	d2 := makeDeck("2", "deck2", true, 10, 20, dateAdded)
+	err = ms.StoreDecks(ctx, []forgefs.Deck{d1, d2})
+	require.NoError(t, err)
+
+	mountTmpDir(t, mountpoint, root)
+
+	tagsDir := filepath.Join(mountpoint, fsutil.TagsDir)
+	leagueDir := filepath.Join(tagsDir, "league")
+	err = os.Mkdir(leagueDir, 0755)
+	require.NoError(t, err)
+	err = os.Mkdir(filepath.Join(tagsDir, "bad=tag"), 0755)
+	require.Error(t, err)
+	entries, err := os.ReadDir(tagsDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "league", entries[0].Name())
+
+	// Tag a deck.
+	err = os.Symlink(
+		"../../"+fsutil.MyDecksDir+"/deck1", filepath.Join(leagueDir, "deck1"))
+	require.NoError(t, err)
+	require.True(t, ms.tags["league"]["1"])
+	err = os.Symlink(
+		"../../"+fsutil.MyDecksDir+"/nope", filepath.Join(leagueDir, "nope"))
+	require.Error(t, err)
+	entries, err = os.ReadDir(leagueDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "deck1", entries[0].Name())
+	link, err := os.Readlink(filepath.Join(leagueDir, "deck1"))
+	require.NoError(t, err)
+	require.Equal(t, "../../"+fsutil.MyDecksDir+"/deck1", link)
+	_, err = os.Stat(filepath.Join(leagueDir, "deck1", fsutil.DeckJSONFilename))
+	require.NoError(t, err)
+
+	// Non-empty tags can't be removed.
+	err = os.Remove(leagueDir)
+	require.Error(t, err)
+
+	// Untag it.
+	err = os.Remove(filepath.Join(leagueDir, "deck1"))
+	require.NoError(t, err)
+	require.False(t, ms.tags["league"]["1"])
+	entries, err = os.ReadDir(leagueDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 0)
+
+	err = os.Remove(leagueDir)
+	require.NoError(t, err)
+	require.NotContains(t, ms.tags, "league")
+}
+
+func TestFSDeckLists(t *testing.T) {
+	ctx := context.Background()
+	mountpoint, root, _, _, _, ms := readyMountTmpDir(t)
+
+	dateAdded, err := time.Parse("2006-01-02", "2023-01-01")
+	require.NoError(t, err)
+	d1 := makeDeck("1", "deck1", true, 10, 20, dateAdded)
+	d2 := makeDeck("2", "deck2", false, 10, 20, dateAdded)
+	d2.Wishlist = true
+	d3 := makeDeck("3", "deck3", false, 5, 20, dateAdded)
+	d3.Wishlist = true
+	d3.Funny = true
+	err = ms.StoreDecks(ctx, []forgefs.Deck{d1, d2, d3})
+	require.NoError(t, err)
+
+	mountTmpDir(t, mountpoint, root)
+
+	checkNames := func(dir string, expectedNames []string) {
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		names := make([]string, 0, len(entries))
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		require.ElementsMatch(t, expectedNames, names)
+	}
+
+	wishlistDir := filepath.Join(mountpoint, fsutil.WishlistDir)
+	checkNames(wishlistDir, []string{"deck2", "deck3"})
+	checkNames(filepath.Join(wishlistDir, "a=10"), []string{"deck2"})
+	checkNames(filepath.Join(mountpoint, fsutil.FunnyDir), []string{"deck3"})
+	checkNames(filepath.Join(mountpoint, fsutil.MyDecksDir), []string{"deck1"})
+
+	_, err = os.Stat(
+		filepath.Join(wishlistDir, "deck2", fsutil.DeckJSONFilename))
+	require.NoError(t, err)
+}
+
+func TestFSCompare(t *testing.T) {
+	ctx := context.Background()
+	mountpoint, root, _, _, _, ms := readyMountTmpDir(t)
+
+	dateAdded, err := time.Parse("2006-01-02", "2023-01-01")
+	require.NoError(t, err)
+	d1 := makeDeck("1", "deck1", true, 10, 20, dateAdded)
+	d1.SASVersion = 1
+	d1.DeckInfo.Houses = []forgefs.HouseInDeck{
+		{House: "Logos", Cards: []forgefs.CardInDeck{{CardTitle: "card1"}}},
+	}
+	d2 := makeDeck("2", "deck2", false, 8, 21.5, dateAdded)
+	d2.Wishlist = true
+	d2.SASVersion = 1
+	d2.DeckInfo.Houses = []forgefs.HouseInDeck{
+		{House: "Mars", Cards: []forgefs.CardInDeck{{CardTitle: "card1"}}},
+	}
+	err = ms.StoreDecks(ctx, []forgefs.Deck{d1, d2})
+	require.NoError(t, err)
+
+	mountTmpDir(t, mountpoint, root)
+
+	diffDir := filepath.Join(mountpoint, fsutil.CompareDir, "deck1", "deck2")
+	entries, err := os.ReadDir(diffDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	expected := fsutil.CompareDecks(&d1, &d2)
+	data, err := os.ReadFile(filepath.Join(diffDir, fsutil.DiffTextFilename))
+	require.NoError(t, err)
+	require.Equal(t, string(fsutil.FormatDeckDiffText(expected)), string(data))
+
+	data, err = os.ReadFile(filepath.Join(diffDir, fsutil.DiffJSONFilename))
+	require.NoError(t, err)
+	var diff fsutil.DeckDiff
+	err = json.Unmarshal(data, &diff)
+	require.NoError(t, err)
+	require.Equal(t, *expected, diff)
+	require.Equal(t, -2.0, diff.Stats[2].Delta)
+
+	_, err = os.Stat(filepath.Join(mountpoint, fsutil.CompareDir, "nope"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestFSSearch(t *testing.T) {
+	ctx := context.Background()
+	mountpoint, root, _, _, _, ms := readyMountTmpDir(t)
+
+	c1 := makeCard("1", "card1", "card1.jpg")
+	c1.CardText = "Steal 1 amber."
+	c2 := makeCard("2", "card2", "card2.jpg")
+	c2.CardText = "Steal 2 amber."
+	c3 := makeCard("3", "card3", "card3.jpg")
+	err := ms.StoreCards(ctx, []forgefs.Card{c1, c2, c3})
+	require.NoError(t, err)
+
+	mountTmpDir(t, mountpoint, root)
+
+	resultsDir := filepath.Join(mountpoint, fsutil.SearchDir, "steal")
+	entries, err := os.ReadDir(resultsDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "01 - card1", entries[0].Name())
+	require.Equal(t, "02 - card2", entries[1].Name())
+
+	link, err := os.Readlink(filepath.Join(resultsDir, "02 - card2"))
+	require.NoError(t, err)
+	require.Equal(t, "../../"+fsutil.CardsDir+"/card2", link)
+}
+
+func TestFSCardDecks(t *testing.T) {
+	ctx := context.Background()
+	mountpoint, root, _, _, _, ms := readyMountTmpDir(t)
+
+	c1 := makeCard("1", "card1", "card1.jpg")
+	err := ms.StoreCards(ctx, []forgefs.Card{c1})
+	require.NoError(t, err)
+
+	dateAdded, err := time.Parse("2006-01-02", "2023-01-01")
+	require.NoError(t, err)
+	d1 := makeDeck("1", "deck1", true, 10, 20, dateAdded)
+	d1.DeckInfo.Houses = []forgefs.HouseInDeck{
+		{House: "Logos", Cards: []forgefs.CardInDeck{
+			{CardTitle: "card1"}, {CardTitle: "card1"},
+		}},
+	}
+	d2 := makeDeck("2", "deck2", true, 10, 20, dateAdded)
+	d2.DeckInfo.Houses = []forgefs.HouseInDeck{
+		{House: "Mars", Cards: []forgefs.CardInDeck{{CardTitle: "card1"}}},
+	}
+	// Not fetched yet.
+	d3 := makeDeck("3", "deck3", true, 10, 20, dateAdded)
+	err = ms.StoreDecks(ctx, []forgefs.Deck{d1, d2, d3})
+	require.NoError(t, err)
+
+	mountTmpDir(t, mountpoint, root)
+
+	decksDir := filepath.Join(
+		mountpoint, fsutil.CardsDir, "card1", fsutil.CardDecksDir)
+	entries, err := os.ReadDir(decksDir)
+	require.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	require.ElementsMatch(t, []string{
+		fsutil.CardDecksFilename, "2x deck1", "1x deck2",
+	}, names)
+
+	link, err := os.Readlink(filepath.Join(decksDir, "2x deck1"))
+	require.NoError(t, err)
+	require.Equal(t, "../../../"+fsutil.MyDecksDir+"/deck1", link)
+
+	data, err := os.ReadFile(filepath.Join(decksDir, fsutil.CardDecksFilename))
+	require.NoError(t, err)
+	require.Equal(t, `2x deck1
+1x deck2
+
+3 copies in 2 decks
+1 decks haven't had their card lists fetched yet, and aren't included
+`, string(data))
+}
+
+func TestFSTraits(t *testing.T) {
+	ctx := context.Background()
+	mountpoint, root, _, _, _, ms := readyMountTmpDir(t)
+
+	c1 := makeCard("1", "card1", "card1.jpg")
+	c1.ExtraCardInfo.Traits = []forgefs.Trait{
+		{Trait: "CapturesAmber"}, {Trait: "DealsDamage"},
+	}
+	c2 := makeCard("2", "card2", "card2.jpg")
+	c2.ExtraCardInfo.Synergies = []forgefs.Trait{
+		{Trait: "CapturesAmber", House: "Friendly"},
+		{Trait: "CapturesAmber", House: "Enemy"},
+	}
+	err := ms.StoreCards(ctx, []forgefs.Card{c1, c2})
+	require.NoError(t, err)
+
+	mountTmpDir(t, mountpoint, root)
+
+	readNames := func(dir string) []string {
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		names := make([]string, 0, len(entries))
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return names
+	}
+
+	c1Dir := filepath.Join(mountpoint, fsutil.CardsDir, "card1")
+	require.Equal(t, []string{"CapturesAmber", "DealsDamage"},
+		readNames(filepath.Join(c1Dir, fsutil.CardTraitsDir)))
+	require.Empty(t, readNames(filepath.Join(c1Dir, fsutil.CardSynergiesDir)))
+	c2Dir := filepath.Join(mountpoint, fsutil.CardsDir, "card2")
+	require.Equal(t, []string{"CapturesAmber"},
+		readNames(filepath.Join(c2Dir, fsutil.CardSynergiesDir)))
+	link, err := os.Readlink(
+		filepath.Join(c2Dir, fsutil.CardSynergiesDir, "CapturesAmber"))
+	require.NoError(t, err)
+	require.Equal(t, "../../../"+fsutil.TraitsDir+"/CapturesAmber", link)
+
+	traitsDir := filepath.Join(mountpoint, fsutil.TraitsDir)
+	require.Equal(t, []string{"CapturesAmber", "DealsDamage"},
+		readNames(traitsDir))
+	_, err = os.Stat(filepath.Join(traitsDir, "Flying"))
+	require.True(t, os.IsNotExist(err))
+
+	// Following the links from a card ends up back at the cards.
+	caDir := filepath.Join(
+		c2Dir, fsutil.CardSynergiesDir, "CapturesAmber")
+	require.Equal(t, []string{"card1"},
+		readNames(filepath.Join(caDir, fsutil.TraitProvidersDir)))
+	require.Equal(t, []string{"card2"},
+		readNames(filepath.Join(caDir, fsutil.TraitSynergiesDir)))
+	_, err = os.Stat(filepath.Join(
+		caDir, fsutil.TraitProvidersDir, "card1", fsutil.CardJSONFilename))
+	require.NoError(t, err)
+	_, err = os.Lstat(filepath.Join(
+		caDir, fsutil.TraitProvidersDir, "card2"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestFSCardExpansionImages(t *testing.T) {
+	ctx := context.Background()
+	mountpoint, root, _, mcif, _, ms := readyMountTmpDir(t)
+
+	mmURL := "https://example.com/mm/card1.png"
+	dtURL := "https://example.com/dt/card1.jpg"
+	c1 := makeCard("1", "card1", mmURL)
+	c1.ExpansionEnum = "MASS_MUTATION"
+	c1Reprint := makeCard("2", "card1", dtURL)
+	c1Reprint.ExpansionEnum = "DARK_TIDINGS"
+	err := ms.StoreCards(ctx, []forgefs.Card{c1, c1Reprint})
+	require.NoError(t, err)
+	mcif.cardImages = map[string][]byte{
+		mmURL: {1, 2, 3},
+		dtURL: {4, 5},
+	}
+
+	mountTmpDir(t, mountpoint, root)
+
+	c1Dir := filepath.Join(mountpoint, fsutil.CardsDir, "card1")
+	entries, err := os.ReadDir(c1Dir)
+	require.NoError(t, err)
+	var images []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), fsutil.CardImagePrefix) {
+			images = append(images, e.Name())
+		}
+	}
+	// The default image could come from either printing, so only
+	// check the expansion images.
+	require.Contains(t, images, "image.MM.png")
+	require.Contains(t, images, "image.DT.jpg")
+
+	data, err := os.ReadFile(filepath.Join(c1Dir, "image.DT.jpg"))
+	require.NoError(t, err)
+	require.Equal(t, []byte{4, 5}, data)
+	data, err = os.ReadFile(filepath.Join(c1Dir, "image.MM.png"))
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2, 3}, data)
+
+	// Both images are cached under the same card, without colliding.
+	delete(mcif.cardImages, dtURL)
+	delete(mcif.cardImages, mmURL)
+	fi, err := os.Stat(filepath.Join(c1Dir, "image.DT.jpg"))
+	require.NoError(t, err)
+	require.Equal(t, int64(2), fi.Size())
+	fi, err = os.Stat(filepath.Join(c1Dir, "image.MM.png"))
+	require.NoError(t, err)
+	require.Equal(t, int64(3), fi.Size())
+
+	_, err = os.Stat(filepath.Join(c1Dir, "image.AoA.png"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(c1Dir, "image.MM.jpg"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(c1Dir, "image.DT.gif"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestFSProxies(t *testing.T) {
+	ctx := context.Background()
+	mountpoint, root, mdf, mcif, _, ms := readyMountTmpDir(t)
+
+	var pngBuf bytes.Buffer
+	err := png.Encode(&pngBuf, image.NewRGBA(image.Rect(0, 0, 30, 42)))
+	require.NoError(t, err)
+	c1 := makeCard("1", "card1", "card1.png")
+	c2 := makeCard("2", "card2", "card2.png")
+	err = ms.StoreCards(ctx, []forgefs.Card{c1, c2})
+	require.NoError(t, err)
+	mcif.cardImages = map[string][]byte{
+		"card1.png": pngBuf.Bytes(),
+		"card2.png": pngBuf.Bytes(),
+	}
+
+	dateAdded, err := time.Parse("2006-01-02", "2023-01-01")
+	require.NoError(t, err)
+	d1 := makeDeck("1", "deck1", true, 10, 20, dateAdded)
+	d1.SASVersion = 1
+	cards := make([]forgefs.CardInDeck, 0, 10)
+	for i := 0; i < 5; i++ {
+		cards = append(cards,
+			forgefs.CardInDeck{CardTitle: "card1"},
+			forgefs.CardInDeck{CardTitle: "card2"})
+	}
+	d1.DeckInfo.Houses = []forgefs.HouseInDeck{{House: "Logos", Cards: cards}}
+	err = ms.StoreDecks(ctx, []forgefs.Deck{d1})
+	require.NoError(t, err)
+	mdf.myDecks = map[string]forgefs.Deck{"1": d1}
+
+	mountTmpDir(t, mountpoint, root)
+
+	proxiesFile := filepath.Join(
+		mountpoint, fsutil.MyDecksDir, "deck1", fsutil.DeckProxiesFilename)
+	data, err := os.ReadFile(proxiesFile)
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(data, []byte("%PDF-")))
+	require.Contains(t, string(data), "/Count 2")
+	require.Equal(t, 10, bytes.Count(data, []byte("/Subtype /Image")))
+
+	// The sheet is cached, so the card images aren't needed again.
+	mcif.cardImages = nil
+	fi, err := os.Stat(proxiesFile)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), fi.Size())
+}
+
+func TestFSContactSheet(t *testing.T) {
+	ctx := context.Background()
+	mountpoint, root, mdf, mcif, _, ms := readyMountTmpDir(t)
+
+	var pngBuf bytes.Buffer
+	err := png.Encode(&pngBuf, image.NewRGBA(image.Rect(0, 0, 40, 56)))
+	require.NoError(t, err)
+	c1 := makeCard("1", "card1", "card1.png")
+	err = ms.StoreCards(ctx, []forgefs.Card{c1})
+	require.NoError(t, err)
+	mcif.cardImages = map[string][]byte{"card1.png": pngBuf.Bytes()}
+
+	dateAdded, err := time.Parse("2006-01-02", "2023-01-01")
+	require.NoError(t, err)
+	d1 := makeDeck("1", "deck1", true, 10, 20, dateAdded)
+	d1.SASVersion = 1
+	d1.DeckInfo.Houses = []forgefs.HouseInDeck{
+		{House: "Logos", Cards: []forgefs.CardInDeck{
+			{CardTitle: "card1"}, {CardTitle: "card1"},
+		}},
+		{House: "Mars", Cards: []forgefs.CardInDeck{{CardTitle: "card1"}}},
+	}
+	err = ms.StoreDecks(ctx, []forgefs.Deck{d1})
+	require.NoError(t, err)
+	mdf.myDecks = map[string]forgefs.Deck{"1": d1}
+
+	mountTmpDir(t, mountpoint, root)
+
+	sheetFile := filepath.Join(
+		mountpoint, fsutil.MyDecksDir, "deck1",
+		fsutil.DeckContactSheetFilename)
+	data, err := os.ReadFile(sheetFile)
+	require.NoError(t, err)
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, "jpeg", format)
+	// Two half-size cards wide, with one row for each house.
+	require.Equal(t, 2*20+3*1, config.Width)
+	require.Equal(t, 2*28+4*1+2*1, config.Height)
+
+	mcif.cardImages = nil
+	fi, err := os.Stat(sheetFile)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), fi.Size())
+}
+
+func TestFSImageVariants(t *testing.T) {
+	ctx := context.Background()
+	mountpoint, root, mdf, mcif, mdif, ms := readyMountTmpDir(t)
+
+	var jpegBuf bytes.Buffer
+	err := jpeg.Encode(
+		&jpegBuf, image.NewRGBA(image.Rect(0, 0, 600, 840)), nil)
+	require.NoError(t, err)
+
+	c1 := makeCard("1", "card1", "card1.jpg")
+	err = ms.StoreCards(ctx, []forgefs.Card{c1})
+	require.NoError(t, err)
+	mcif.cardImages = map[string][]byte{"card1.jpg": jpegBuf.Bytes()}
+
+	dateAdded, err := time.Parse("2006-01-02", "2023-01-01")
+	require.NoError(t, err)
+	d1 := makeDeck("1", "deck1", true, 10, 20, dateAdded)
+	err = ms.StoreDecks(ctx, []forgefs.Deck{d1})
+	require.NoError(t, err)
+	mdf.myDecks = map[string]forgefs.Deck{"1": d1}
+	mdif.deckImages = map[string][]byte{"1": jpegBuf.Bytes()}
+
+	mountTmpDir(t, mountpoint, root)
+
+	checkImage := func(
+		file, expectedFormat string, expectedW, expectedH int) {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		config, format, err := image.DecodeConfig(bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, expectedFormat, format)
+		require.Equal(t, expectedW, config.Width)
+		require.Equal(t, expectedH, config.Height)
+	}
+
+	c1Dir := filepath.Join(mountpoint, fsutil.CardsDir, "card1")
+	checkImage(
+		filepath.Join(c1Dir, fsutil.CardThumbnailFilename), "jpeg", 182, 256)
+	checkImage(filepath.Join(c1Dir, fsutil.CardPNGFilename), "png", 600, 840)
+	d1Dir := filepath.Join(mountpoint, fsutil.MyDecksDir, "deck1")
+	checkImage(
+		filepath.Join(d1Dir, fsutil.DeckThumbnailFilename), "jpeg", 182, 256)
+	checkImage(filepath.Join(d1Dir, fsutil.DeckPNGFilename), "png", 600, 840)
+
+	// The variants are cached, so the originals aren't needed again.
+	mcif.cardImages = nil
+	mdif.deckImages = nil
+	checkImage(
+		filepath.Join(c1Dir, fsutil.CardThumbnailFilename), "jpeg", 182, 256)
+	checkImage(filepath.Join(d1Dir, fsutil.DeckPNGFilename), "png", 600, 840)
+}
+
+func TestFSStreamingImages(t *testing.T) {
+	ctx := context.Background()
+	mountpoint, _, mdf, mcif, mdif, ms := readyMountTmpDir(t)
+
+	// Serve images from a real on-disk cache, so reads are streamed
+	// from its files.
+	cache, err := storage.NewDirImageCache(t.TempDir())
+	require.NoError(t, err)
+	im := fsutil.NewImageManager(
+		mcif, mdif, cache, fsutil.ImageManagerOptions{})
+	root := NewFSRoot(ms, mdf, im)
+
+	// Big enough to take several FUSE reads.
+	cardImage := make([]byte, 1<<20)
+	for i := range cardImage {
+		cardImage[i] = byte(i % 251)
+	}
+	c1 := makeCard("1", "card1", "card1.png")
+	err = ms.StoreCards(ctx, []forgefs.Card{c1})
+	require.NoError(t, err)
+	mcif.cardImages = map[string][]byte{"card1.png": cardImage}
+
+	dateAdded, err := time.Parse("2006-01-02", "2023-01-01")
+	require.NoError(t, err)
+	d1 := makeDeck("1", "deck1", true, 10, 20, dateAdded)
+	err = ms.StoreDecks(ctx, []forgefs.Deck{d1})
+	require.NoError(t, err)
+	mdf.myDecks = map[string]forgefs.Deck{"1": d1}
+	mdif.deckImages = map[string][]byte{"1": []byte("deck image")}
+
+	mountTmpDir(t, mountpoint, root)
+
+	cardFile := filepath.Join(
+		mountpoint, fsutil.CardsDir, "card1", fsutil.CardImagePrefix+"png")
+	data, err := os.ReadFile(cardFile)
+	require.NoError(t, err)
+	require.Equal(t, cardImage, data)
+
+	// Once cached, the image is still served without the fetcher.
+	mcif.cardImages = nil
+	f, err := os.Open(cardFile)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	buf := make([]byte, 100)
+	n, err := f.ReadAt(buf, 500000)
+	require.NoError(t, err)
+	require.Equal(t, cardImage[500000:500000+n], buf[:n])
+
+	data, err = os.ReadFile(filepath.Join(
+		mountpoint, fsutil.MyDecksDir, "deck1", fsutil.DeckImageFilename))
+	require.NoError(t, err)
+	require.Equal(t, "deck image", string(data))
+}
+
+func TestFSInvalidation(t *testing.T) {
+	ctx := context.Background()
+	mountpoint, root, _, _, _, ms := readyMountTmpDir(t)
+
+	c1 := makeCard("1", "card1", "card1.jpg")
+	c1.CardText = "Play: Gain 1A."
+	c1.CardNumbers = []forgefs.CardNumber{
+		{Expansion: "MASS_MUTATION", CardNumber: "12"},
+	}
+	err := ms.StoreCards(ctx, []forgefs.Card{c1})
+	require.NoError(t, err)
+
+	dateAdded, err := time.Parse("2006-01-02", "2023-01-01")
+	require.NoError(t, err)
+	d1 := makeDeck("2", "deck1", true, 10, 20, dateAdded)
+	d1.SASVersion = 1
+	d1.DeckInfo.Houses = []forgefs.HouseInDeck{{House: "Brobnar"}}
+	err = ms.StoreDecks(ctx, []forgefs.Deck{d1})
+	require.NoError(t, err)
+
+	// Let the kernel cache everything for longer than the test runs,
+	// so that only invalidations make changes visible.
+	mountTmpDirWithTimeout(t, mountpoint, root, time.Hour)
+	ms.SetObserver(root)
+
+	myDecksDir := filepath.Join(mountpoint, fsutil.MyDecksDir)
+	d1JSON := filepath.Join(myDecksDir, "deck1", fsutil.DeckJSONFilename)
+	expected, err := formatDeckJSON(ctx, &d1)
+	require.NoError(t, err)
+	data, err := os.ReadFile(d1JSON)
+	require.NoError(t, err)
+	require.Equal(t, expected, data)
+	c1Text := filepath.Join(
+		mountpoint, fsutil.CardsDir, "card1", fsutil.CardTextFilename)
+	data, err = os.ReadFile(c1Text)
+	require.NoError(t, err)
+	require.Equal(t, fsutil.FormatCardText(&c1), data)
+	_, err = os.Stat(filepath.Join(myDecksDir, "deck2"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(mountpoint, fsutil.CardsDir, "card2"))
+	require.True(t, os.IsNotExist(err))
+	resultsDir := filepath.Join(mountpoint, fsutil.SearchDir, "gain")
+	entries, err := os.ReadDir(resultsDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	mmDir := filepath.Join(mountpoint, fsutil.SetsDir, "MM")
+	entries, err = os.ReadDir(mmDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	dtDir := filepath.Join(mountpoint, fsutil.SetsDir, "DT")
+	_, err = os.Stat(dtDir)
+	require.True(t, os.IsNotExist(err))
+
+	// Update the deck, and add a new one.
+	d1.DeckInfo.AmberControl = 12.5
+	d1.DeckInfo.Houses = append(
+		d1.DeckInfo.Houses, forgefs.HouseInDeck{House: "Dis"})
+	d2 := makeDeck("3", "deck2", true, 10, 20, dateAdded)
+	err = ms.StoreDecks(ctx, []forgefs.Deck{d1, d2})
+	require.NoError(t, err)
+	expected, err = formatDeckJSON(ctx, &d1)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(d1JSON)
+		return err == nil && bytes.Equal(expected, data)
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(myDecksDir, "deck2"))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Changing only a deck's details doesn't reload the deck lists.
+	invalidated := func() bool {
+		root.invalMu.Lock()
+		defer root.invalMu.Unlock()
+		return !root.invalidating
+	}
+	require.Eventually(t, invalidated, 5*time.Second, 10*time.Millisecond)
+	queries := atomic.LoadInt32(&ms.metadataQueries)
+	d1.DeckInfo.AmberControl = 15
+	err = ms.StoreDecks(ctx, []forgefs.Deck{d1})
+	require.NoError(t, err)
+	expected, err = formatDeckJSON(ctx, &d1)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(d1JSON)
+		return err == nil && bytes.Equal(expected, data)
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, invalidated, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, queries, atomic.LoadInt32(&ms.metadataQueries))
+
+	// But renaming one does.
+	d1.DeckInfo.Name = "deck1 renamed"
+	err = ms.StoreDecks(ctx, []forgefs.Deck{d1})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(myDecksDir, "deck1 renamed"))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	_, err = os.Stat(filepath.Join(myDecksDir, "deck1"))
+	require.True(t, os.IsNotExist(err))
+
+	// Same for cards.
+	c1.CardText = "Play: Gain 2A."
+	c1.CardNumbers = append(c1.CardNumbers, forgefs.CardNumber{
+		Expansion: "DARK_TIDINGS", CardNumber: "3",
+	})
+	c2 := makeCard("4", "card2", "card2.jpg")
+	c2.CardText = "Play: Gain 3A."
+	c2.CardNumbers = []forgefs.CardNumber{
+		{Expansion: "MASS_MUTATION", CardNumber: "2"},
+	}
+	err = ms.StoreCards(ctx, []forgefs.Card{c1, c2})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(c1Text)
+		return err == nil && bytes.Equal(fsutil.FormatCardText(&c1), data)
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(mountpoint, fsutil.CardsDir, "card2"))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		entries, err := os.ReadDir(resultsDir)
+		return err == nil && len(entries) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		entries, err := os.ReadDir(mmDir)
+		return err == nil && len(entries) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(dtDir, "003 - card1"))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestFSRandomDecks(t *testing.T) {
+	ctx := context.Background()
+	mountpoint, root, _, _, _, ms := readyMountTmpDir(t)
+
+	dateAdded, err := time.Parse("2006-01-02", "2023-01-01")
+	require.NoError(t, err)
+	d1 := makeDeck("1", "deck1", true, 10, 20, dateAdded)
+	d2 := makeDeck("2", "deck2", true, 10, 20, dateAdded)
+	d3 := makeDeck("3", "deck3", true, 5, 20, dateAdded)
+	err = ms.StoreDecks(ctx, []forgefs.Deck{d1, d2, d3})
+	require.NoError(t, err)
+
+	mountTmpDir(t, mountpoint, root)
+
+	myDecksDir := filepath.Join(mountpoint, fsutil.MyDecksDir)
+	allNames := []string{"deck1", "deck2", "deck3"}
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		link, err := os.Readlink(
+			filepath.Join(myDecksDir, fsutil.RandomDeckLink))
+		require.NoError(t, err)
+		require.Contains(t, allNames, link)
+		seen[link] = true
+	}
+	require.Greater(t, len(seen), 1)
+
+	// The link resolves to the deck itself.
+	_, err = os.Stat(filepath.Join(
+		myDecksDir, fsutil.RandomDeckLink, fsutil.DeckJSONFilename))
+	require.NoError(t, err)
+
+	// Random picks are limited to matching decks.
+	link, err := os.Readlink(
+		filepath.Join(myDecksDir, "a=5", fsutil.RandomDeckLink))
+	require.NoError(t, err)
+	require.Equal(t, "deck3", link)
+
+	checkRandomDir := func(dir string, expectedLen int) {
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, expectedLen)
+		names := make(map[string]bool, len(entries))
+		for _, e := range entries {
+			require.Contains(t, allNames, e.Name())
+			names[e.Name()] = true
+			link, err := os.Readlink(filepath.Join(dir, e.Name()))
+			require.NoError(t, err)
+			require.Equal(t, "../"+e.Name(), link)
+		}
+		require.Len(t, names, expectedLen)
+	}
+	checkRandomDir(filepath.Join(myDecksDir, fsutil.RandomDecksDirPrefix+"2"), 2)
+	checkRandomDir(filepath.Join(myDecksDir, fsutil.RandomDecksDirPrefix+"5"), 3)
+
+	_, err = os.Stat(filepath.Join(myDecksDir, fsutil.RandomDecksDirPrefix+"0"))
+	require.True(t, os.IsNotExist(err))
+
+	// Random entries aren't listed.
+	entries, err := os.ReadDir(myDecksDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+}
+
+func TestFSStats(t *testing.T) {
+	ctx := context.Background()
+	mountpoint, root, _, _, _, ms := readyMountTmpDir(t)
+
+	dateAdded, err := time.Parse("2006-01-02", "2023-01-01")
+	require.NoError(t, err)
+	d1 := makeDeck("1", "deck1", true, 10, 20, dateAdded)
+	d1.DeckInfo.Expansion = "MASS_MUTATION"
+	d1.DeckInfo.SasRating = 70
+	d2 := makeDeck("2", "deck2", true, 10, 20, dateAdded)
+	d2.DeckInfo.Expansion = "MASS_MUTATION"
+	d2.DeckInfo.SasRating = 60
+	err = ms.StoreDecks(ctx, []forgefs.Deck{d1, d2})
+	require.NoError(t, err)
+
+	mountTmpDirWithTimeout(t, mountpoint, root, time.Hour)
+	ms.SetObserver(root)
+
+	statsDir := filepath.Join(mountpoint, fsutil.StatsDir)
+	entries, err := os.ReadDir(statsDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 5)
+
+	readStats := func() forgefs.CollectionStats {
+		data, err := os.ReadFile(
+			filepath.Join(statsDir, fsutil.StatsSummaryFilename))
+		require.NoError(t, err)
+		var stats forgefs.CollectionStats
+		err = json.Unmarshal(data, &stats)
+		require.NoError(t, err)
+		return stats
+	}
+	stats := readStats()
+	require.Equal(t, 2, stats.Decks)
+	require.Equal(t, "deck1", stats.TopDecks[0].Name)
+
+	data, err := os.ReadFile(
+		filepath.Join(statsDir, fsutil.StatsByExpansionFilename))
+	require.NoError(t, err)
+	require.Equal(t,
+		"expansion,decks,avg_sas,avg_aerc,avg_a,avg_e,avg_r,avg_c,avg_f,"+
+			"avg_d,top_deck,top_deck_sas\n"+
+			"MM,2,0,0,0,0,0,0,0,0,deck1,70\n",
+		string(data))
+
+	// Storing decks refreshes the stats.
+	d3 := makeDeck("3", "deck3", true, 10, 20, dateAdded)
+	d3.DeckInfo.SasRating = 80
+	err = ms.StoreDecks(ctx, []forgefs.Deck{d3})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return readStats().Decks == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, "deck3", readStats().TopDecks[0].Name)
+}
+
+func TestFSCharts(t *testing.T) {
+	ctx := context.Background()
+	mountpoint, root, _, _, _, ms := readyMountTmpDir(t)
+
+	dateAdded, err := time.Parse("2006-01-02", "2023-01-01")
+	require.NoError(t, err)
+	d1 := makeDeck("1", "deck1 <&>", true, 10, 20, dateAdded)
+	d1.DeckInfo.SasRating = 70
+	d2 := makeDeck("2", "deck2", true, 4, 20, dateAdded)
+	d2.DeckInfo.SasRating = 61
+	err = ms.StoreDecks(ctx, []forgefs.Deck{d1, d2})
+	require.NoError(t, err)
+
+	mountTmpDir(t, mountpoint, root)
+	ms.SetObserver(root)
+
+	checkSVG := func(file string) string {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		d := xml.NewDecoder(bytes.NewReader(data))
+		var root *xml.StartElement
+		for {
+			tok, err := d.Token()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			if se, ok := tok.(xml.StartElement); ok && root == nil {
+				root = &se
+			}
+		}
+		require.NotNil(t, root)
+		require.Equal(t, "svg", root.Name.Local)
+		return string(data)
+	}
+
+	deckChart := filepath.Join(
+		mountpoint, fsutil.MyDecksDir, "deck1 <&>", fsutil.DeckChartFilename)
+	chart := checkSVG(deckChart)
+	require.Contains(t, chart, "deck1 &lt;&amp;&gt;")
+	require.Contains(t, chart, "A 10")
+	sasChart := checkSVG(filepath.Join(
+		mountpoint, fsutil.StatsDir, fsutil.StatsSASChartFilename))
+	require.Contains(t, sasChart, "SAS distribution (2 decks)")
+
+	// The medians are only computed once, not on every stat.
+	for i := 0; i < 3; i++ {
+		_, err = os.Stat(deckChart)
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&ms.medianQueries))
+
+	// New decks change the medians.
+	d3 := makeDeck("3", "deck3", true, 30, 20, dateAdded)
+	d4 := makeDeck("4", "deck4", true, 40, 20, dateAdded)
+	err = ms.StoreDecks(ctx, []forgefs.Deck{d3, d4})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return checkSVG(deckChart) != chart
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, int32(2), atomic.LoadInt32(&ms.medianQueries))
+
+}
+
+func TestFSStatus(t *testing.T) {
+	ctx := context.Background()
+	mountpoint, root, _, _, mdif, ms := readyMountTmpDir(t)
+	mdif.errs = []forgefs.ErrorRecord{}
+
+	dateAdded, err := time.Parse("2006-01-02", "2023-01-01")
+	require.NoError(t, err)
+	d1 := makeDeck("1", "deck1", true, 10, 20, dateAdded)
+	d2 := makeDeck("2", "deck2", true, 10, 20, dateAdded)
+	err = ms.StoreDecks(ctx, []forgefs.Deck{d1, d2})
+	require.NoError(t, err)
+	mdif.deckImages = map[string][]byte{"1": []byte("deck1 image")}
+	syncTime := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	err = ms.SetSyncTime(ctx, forgefs.SyncDecks, syncTime)
+	require.NoError(t, err)
+
+	mountTmpDir(t, mountpoint, root)
+
+	controlDir := filepath.Join(mountpoint, fsutil.ControlDir)
+	entries, err := os.ReadDir(controlDir)
+	require.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	require.Contains(t, names, fsutil.StatusFilename)
+
+	readStatus := func() fsutil.Status {
+		data, err := os.ReadFile(
+			filepath.Join(controlDir, fsutil.StatusFilename))
+		require.NoError(t, err)
+		var status fsutil.Status
+		err = json.Unmarshal(data, &status)
+		require.NoError(t, err)
+		return status
+	}
+	status := readStatus()
+	require.True(t, syncTime.Equal(status.LastSync[forgefs.SyncDecks]))
+	require.Equal(t, fsutil.CacheStats{}, status.ImageCache)
+	require.Empty(t, status.RecentErrors)
+
+	// The first read of an image misses the cache, and the second
+	// hits it.
+	d1Image := filepath.Join(
+		mountpoint, fsutil.MyDecksDir, "deck1", fsutil.DeckImageFilename)
+	for i := 0; i < 2; i++ {
+		data, err := os.ReadFile(d1Image)
+		require.NoError(t, err)
+		require.Equal(t, "deck1 image", string(data))
+	}
+	_, err = root.im.GetDeckImage(ctx, "2")
+	require.Error(t, err)
+
+	status = readStatus()
+	require.Equal(t, fsutil.CacheStats{Hits: 1, Misses: 2}, status.ImageCache)
+	require.Len(t, status.Clients, 1)
+	require.Equal(t, "mock", status.Clients[0].Name)
+	require.Equal(t, int64(2), status.Clients[0].Requests)
+	require.Equal(t, int64(1), status.Clients[0].Errors)
+	require.Len(t, status.RecentErrors, 1)
+	require.Equal(t, "No image for 2", status.RecentErrors[0].Error)
+
+	// Deriving a thumbnail counts as one lookup, even though it also
+	// reads the cached original.
+	_, err = root.im.GetDeckImageVariant(
+		ctx, "1", fsutil.ImageVariantThumbnail)
+	require.Error(t, err)
+	status = readStatus()
+	require.Equal(t, fsutil.CacheStats{Hits: 1, Misses: 3}, status.ImageCache)
+}
+
+func TestFSControl(t *testing.T) {
+	ctx := context.Background()
+	mountpoint, root, mdf, mcif, mdif, ms := readyMountTmpDir(t)
+	mic := newMockImageCache()
+	root.im = fsutil.NewImageManager(
+		mcif, mdif, mic, fsutil.ImageManagerOptions{})
+
+	dateAdded, err := time.Parse("2006-01-02", "2023-01-01")
+	require.NoError(t, err)
+	d1 := makeDeck("1", "deck1", true, 10, 20, dateAdded)
+	d1.DeckInfo.Houses = []forgefs.HouseInDeck{{House: "Logos"}}
+	d1.SASVersion = 1
+	err = ms.StoreDecks(ctx, []forgefs.Deck{d1})
+	require.NoError(t, err)
+
+	root.SetConfigLoader(func() (*Config, error) {
+		return &Config{ThumbnailSize: 64}, nil
+	})
+	mountTmpDir(t, mountpoint, root)
+
+	controlDir := filepath.Join(mountpoint, fsutil.ControlDir)
+	controlFile := filepath.Join(controlDir, fsutil.ControlFilename)
+	logFile := filepath.Join(controlDir, fsutil.ControlLogFilename)
+	entries, err := os.ReadDir(controlDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	// The control file can't be read.
+	_, err = os.ReadFile(controlFile)
+	require.Error(t, err)
+
+	run := func(cmd, expectedLog string) {
+		err := os.WriteFile(controlFile, []byte(cmd+"\n"), 0200)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			data, err := os.ReadFile(logFile)
+			require.NoError(t, err)
+			return strings.HasSuffix(string(data), " "+expectedLog+"\n")
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	mdf.cards = []forgefs.Card{
+		makeCard("1", "card1", "card1.jpg"),
+		makeCard("2", "card2", "card2.jpg"),
+	}
+	run("sync cards", "sync cards: stored 2 cards")
+	require.Len(t, ms.cards, 2)
+	require.Contains(t, ms.syncs, forgefs.SyncCards)
+
+	// Syncing the deck lists keeps the cards of decks that were
+	// already fetched.
+	d1Listed := makeDeck("1", "deck1", true, 10, 20, dateAdded)
+	d1Listed.DeckInfo.SasRating = 70
+	d2 := makeDeck("2", "deck2", true, 10, 20, dateAdded)
+	mdf.myDecks = map[string]forgefs.Deck{"1": d1Listed, "2": d2}
+	run("sync   decks", "sync decks: stored 2 decks")
+	require.Len(t, ms.decks, 2)
+	require.Equal(t, 70, ms.decks["1"].DeckInfo.SasRating)
+	require.Equal(t, d1.DeckInfo.Houses, ms.decks["1"].DeckInfo.Houses)
+	require.Equal(t, 1, ms.decks["1"].SASVersion)
+	require.Contains(t, ms.syncs, forgefs.SyncDecks)
+
+	d2.DeckInfo.Houses = []forgefs.HouseInDeck{{House: "Dis"}}
+	mdf.myDecks["2"] = d2
+	run("refresh 2", "refresh 2: refreshed deck2")
+	require.Equal(t, d2.DeckInfo.Houses, ms.decks["2"].DeckInfo.Houses)
+
+	mcif.cardImages = map[string][]byte{
+		"card1.jpg": []byte("card1 image"),
+		"card2.jpg": []byte("card2 image"),
+	}
+	mdif.deckImages = map[string][]byte{
+		"1": []byte("deck1 image"),
+		"2": []byte("deck2 image"),
+	}
+	run("prefetch images", "prefetch images: cached 4 images")
+	require.Len(t, mic.cards, 2)
+	require.Len(t, mic.decks, 2)
+
+	run("drop-cache", "drop-cache: dropped all cached images")
+	require.Len(t, mic.cards, 0)
+	require.Len(t, mic.decks, 0)
+
+	run("reload-config",
+		"reload-config: applied image settings; other settings need a "+
+			"restart")
+
+	// Unknown commands fail right away, and are logged.
+	err = os.WriteFile(controlFile, []byte("explode\n"), 0200)
+	require.Error(t, err)
+	data, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(
+		string(data), ` explode: error: Unknown command: "explode"`+"\n"))
+
+	// Failed commands show up in the status.
+	run("refresh 3", "refresh 3: error: No stored deck with ID 3")
+	data, err = os.ReadFile(filepath.Join(controlDir, fsutil.StatusFilename))
+	require.NoError(t, err)
+	var status fsutil.Status
+	err = json.Unmarshal(data, &status)
+	require.NoError(t, err)
+	require.Len(t, status.RecentErrors, 2)
+	require.Equal(t, "control refresh 3", status.RecentErrors[1].Source)
+}
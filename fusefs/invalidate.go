@@ -0,0 +1,233 @@
+package fusefs
+
+import (
+	"context"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/strib/forgefs"
+	"github.com/strib/forgefs/fsutil"
+)
+
+var _ forgefs.StorageObserver = (*FSRoot)(nil)
+
+// invalidation describes the storage updates that the kernel hasn't
+// been told about yet.
+type invalidation struct {
+	cardIDs map[string]bool
+	deckIDs map[string]bool
+	// deckLists is set when an update added, removed or renamed a
+	// deck in one of the deck list directories, rather than just
+	// changing its details.
+	deckLists bool
+
+	// chartsChecked and chartsStale remember, for one walk, whether
+	// the collection medians drawn in every deck chart changed.
+	chartsChecked bool
+	chartsStale   bool
+}
+
+func (inv *invalidation) empty() bool {
+	return len(inv.cardIDs) == 0 && len(inv.deckIDs) == 0
+}
+
+func mergeIDs(dst map[string]bool, ids map[string]bool) map[string]bool {
+	if dst == nil {
+		dst = make(map[string]bool, len(ids))
+	}
+	for id := range ids {
+		dst[id] = true
+	}
+	return dst
+}
+
+// CardsUpdated implements the forgefs.StorageObserver interface.
+func (r *FSRoot) CardsUpdated(_ context.Context, cards []forgefs.Card) {
+	ids := make(map[string]bool, len(cards))
+	for _, c := range cards {
+		ids[c.ID] = true
+	}
+	r.queueInvalidation(ids, nil, false)
+}
+
+// DecksUpdated implements the forgefs.StorageObserver interface.
+func (r *FSRoot) DecksUpdated(_ context.Context, decks []forgefs.Deck) {
+	ids := make(map[string]bool, len(decks))
+	for _, d := range decks {
+		ids[d.DeckInfo.KeyforgeID] = true
+	}
+	// The charts drawn from here on need the new medians.
+	r.medians.reset()
+	r.queueInvalidation(nil, ids, r.deckListsChangedBy(decks))
+}
+
+// deckListsChangedBy returns whether storing the given decks changes
+// which decks any of the deck list directories hold, or their names.
+// Lazily fetched deck details usually don't, and then the list
+// directories can be left alone.
+func (r *FSRoot) deckListsChangedBy(decks []forgefs.Deck) bool {
+	for _, child := range r.Children() {
+		mdd, ok := child.Operations().(*FSMyDecksDir)
+		if !ok {
+			continue
+		}
+		for _, d := range decks {
+			if mdd.listChangedBy(d) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// queueInvalidation adds the given updates to the pending ones, and
+// starts the invalidation worker if it isn't already running.  Cards
+// and decks are often stored while serving a FUSE request, and the
+// kernel may be holding locks that the notifications need, so they
+// must be sent from outside the request.
+func (r *FSRoot) queueInvalidation(
+	cardIDs, deckIDs map[string]bool, deckLists bool) {
+	r.invalMu.Lock()
+	defer r.invalMu.Unlock()
+	if len(cardIDs) > 0 {
+		r.pending.cardIDs = mergeIDs(r.pending.cardIDs, cardIDs)
+	}
+	if len(deckIDs) > 0 {
+		r.pending.deckIDs = mergeIDs(r.pending.deckIDs, deckIDs)
+		r.pending.deckLists = r.pending.deckLists || deckLists
+	}
+	if r.invalidating || r.pending.empty() {
+		return
+	}
+	r.invalidating = true
+	go r.invalidateLoop()
+}
+
+// invalidateLoop walks the file system once for all the updates
+// queued so far, and again for any queued during the walk, until
+// there are none left.
+func (r *FSRoot) invalidateLoop() {
+	ctx := context.Background()
+	for {
+		r.invalMu.Lock()
+		inv := r.pending
+		r.pending = invalidation{}
+		if inv.empty() {
+			r.invalidating = false
+			r.invalMu.Unlock()
+			return
+		}
+		r.invalMu.Unlock()
+
+		r.invalidate(ctx, &r.Inode, &inv)
+	}
+}
+
+// invalidateChildren drops everything under `n` that was generated
+// from stale data.  Files keep their inodes but lose their cached
+// sizes and contents, and directories are removed so that they are
+// rebuilt on the next lookup.
+func invalidateChildren(n *fs.Inode) {
+	for name, child := range n.Children() {
+		if f, ok := child.Operations().(*FSFile); ok {
+			f.invalidate()
+			continue
+		}
+		n.RmChild(name)
+		_ = n.NotifyEntry(name)
+	}
+	_ = n.NotifyContent(0, 0)
+}
+
+// chartsStale returns whether the deck charts need to be redrawn,
+// because the collection medians changed since they were last
+// invalidated.
+func (r *FSRoot) chartsStale(ctx context.Context, inv *invalidation) bool {
+	if inv.chartsChecked {
+		return inv.chartsStale
+	}
+	inv.chartsChecked = true
+	version, err := r.medians.getVersion(ctx)
+	if err != nil {
+		inv.chartsStale = true
+		return true
+	}
+	inv.chartsStale = version != r.chartVersion
+	r.chartVersion = version
+	return inv.chartsStale
+}
+
+// invalidate walks the inodes under `n` that the kernel knows about,
+// and tells the kernel to drop anything it has cached about the given
+// cards and decks, or about directories listing them.
+func (r *FSRoot) invalidate(
+	ctx context.Context, n *fs.Inode, inv *invalidation) {
+	for _, child := range n.Children() {
+		switch node := child.Operations().(type) {
+		case *FSCard:
+			if inv.cardIDs[node.id] {
+				invalidateChildren(child)
+				continue
+			}
+		case *FSDeck:
+			if inv.deckIDs[node.id] {
+				invalidateChildren(child)
+				continue
+			}
+			// Every deck's chart compares it to the whole collection.
+			chart := child.GetChild(fsutil.DeckChartFilename)
+			if chart != nil && len(inv.deckIDs) > 0 &&
+				r.chartsStale(ctx, inv) {
+				if f, ok := chart.Operations().(*FSFile); ok {
+					f.invalidate()
+				}
+			}
+		case *FSSearchDir:
+			// Any search may now match different cards.
+			if len(inv.cardIDs) > 0 {
+				invalidateChildren(child)
+				continue
+			}
+		case *FSStatsDir:
+			if len(inv.deckIDs) > 0 {
+				node.reset()
+				invalidateChildren(child)
+				continue
+			}
+		}
+		if child.IsDir() {
+			r.invalidate(ctx, child, inv)
+		}
+	}
+
+	var added, removed []string
+	var err error
+	switch node := n.Operations().(type) {
+	case *FSCardsDir:
+		if len(inv.cardIDs) > 0 {
+			added, removed, err = node.refresh(ctx)
+		}
+	case *FSSetsDir:
+		if len(inv.cardIDs) > 0 {
+			added, removed, err = node.refresh(ctx)
+		}
+	case *FSMyDecksDir:
+		// A filter can match different decks whenever their details
+		// change, but the unfiltered lists only change when decks
+		// are added, removed or renamed.
+		if inv.deckLists ||
+			(node.filterRoot != nil && len(inv.deckIDs) > 0) {
+			added, removed, err = node.refresh(ctx)
+		}
+	}
+	if err != nil || len(added)+len(removed) == 0 {
+		return
+	}
+	for _, name := range removed {
+		n.RmChild(name)
+	}
+	// Added names may have been cached as missing.
+	for _, name := range append(added, removed...) {
+		_ = n.NotifyEntry(name)
+	}
+	_ = n.NotifyContent(0, 0)
+}
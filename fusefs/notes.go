@@ -0,0 +1,228 @@
+package fusefs
+
+import (
+	"context"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/strib/forgefs"
+)
+
+// FSDeckNotes is a writable file holding the user's local notes for a
+// deck.  Writes are buffered in the file handle, and saved to storage
+// when the handle is flushed.  Handles that were never written to are
+// never saved, so they can't clobber changes made through other
+// handles.
+type FSDeckNotes struct {
+	fs.Inode
+	s     forgefs.Storage
+	id    string
+	mtime time.Time
+
+	// mu serializes the stored notes updates.  To avoid deadlocks,
+	// it's never held while taking a handle's lock.
+	mu sync.Mutex
+}
+
+var _ fs.InodeEmbedder = (*FSDeckNotes)(nil)
+var _ fs.NodeGetattrer = (*FSDeckNotes)(nil)
+var _ fs.NodeSetattrer = (*FSDeckNotes)(nil)
+var _ fs.NodeOpener = (*FSDeckNotes)(nil)
+var _ fs.NodeReader = (*FSDeckNotes)(nil)
+var _ fs.NodeWriter = (*FSDeckNotes)(nil)
+var _ fs.NodeFlusher = (*FSDeckNotes)(nil)
+
+// notesHandle holds the contents of one opening of a notes file.
+// The contents are loaded on first use rather than on open, since
+// `open(O_TRUNC)` truncates the file only after opening it.
+type notesHandle struct {
+	mu     sync.Mutex
+	loaded bool
+	data   []byte
+	dirty  bool
+}
+
+// load reads the stored notes into the handle, if it hasn't been used
+// yet.  The caller must hold `nh.mu`.
+func (dn *FSDeckNotes) load(ctx context.Context, nh *notesHandle) error {
+	if nh.loaded {
+		return nil
+	}
+	notes, err := dn.s.GetDeckNotes(ctx, dn.id)
+	if err != nil {
+		return err
+	}
+	nh.data = []byte(notes)
+	nh.loaded = true
+	return nil
+}
+
+func (dn *FSDeckNotes) fillAttr(size int, out *fuse.Attr) {
+	out.Mode = 0644
+	out.Size = uint64(size)
+	out.SetTimes(&dn.mtime, &dn.mtime, &dn.mtime)
+}
+
+// Getattr implements the fs.NodeGetattrer interface.
+func (dn *FSDeckNotes) Getattr(
+	ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	if nh, ok := fh.(*notesHandle); ok {
+		nh.mu.Lock()
+		defer nh.mu.Unlock()
+		err := dn.load(ctx, nh)
+		if err != nil {
+			return fs.ToErrno(err)
+		}
+		dn.fillAttr(len(nh.data), &out.Attr)
+		return 0
+	}
+
+	notes, err := dn.s.GetDeckNotes(ctx, dn.id)
+	if err != nil {
+		return fs.ToErrno(err)
+	}
+	dn.fillAttr(len(notes), &out.Attr)
+	return 0
+}
+
+// Setattr implements the fs.NodeSetattrer interface.  Only changing
+// the size is supported.
+func (dn *FSDeckNotes) Setattr(
+	ctx context.Context, fh fs.FileHandle, in *fuse.SetAttrIn,
+	out *fuse.AttrOut) syscall.Errno {
+	size, ok := in.GetSize()
+	if !ok {
+		return dn.Getattr(ctx, fh, out)
+	}
+
+	if nh, ok := fh.(*notesHandle); ok {
+		nh.mu.Lock()
+		defer nh.mu.Unlock()
+		err := dn.load(ctx, nh)
+		if err != nil {
+			return fs.ToErrno(err)
+		}
+		nh.data = resize(nh.data, int(size))
+		nh.dirty = true
+		dn.fillAttr(len(nh.data), &out.Attr)
+		return 0
+	}
+
+	// The kernel doesn't always say which handle a truncation is
+	// for (e.g., for `open(O_TRUNC)`), so just save it right away.
+	// The truncating handle hasn't been used yet, so it picks up the
+	// truncated notes when it's first written to.
+	dn.mu.Lock()
+	defer dn.mu.Unlock()
+	notes, err := dn.s.GetDeckNotes(ctx, dn.id)
+	if err != nil {
+		return fs.ToErrno(err)
+	}
+	data := resize([]byte(notes), int(size))
+	err = dn.s.StoreDeckNotes(ctx, dn.id, string(data))
+	if err != nil {
+		return fs.ToErrno(err)
+	}
+	dn.fillAttr(len(data), &out.Attr)
+	return 0
+}
+
+func resize(data []byte, size int) []byte {
+	if size <= len(data) {
+		return data[:size]
+	}
+	return append(data, make([]byte, size-len(data))...)
+}
+
+// Open implements the fs.NodeOpener interface.
+func (dn *FSDeckNotes) Open(ctx context.Context, flags uint32) (
+	fs.FileHandle, uint32, syscall.Errno) {
+	nh := &notesHandle{}
+	if flags&syscall.O_TRUNC != 0 {
+		nh.loaded = true
+		nh.dirty = true
+	}
+
+	// Skip the page cache, since the contents can change underneath
+	// it with every flush.
+	return nh, fuse.FOPEN_DIRECT_IO, 0
+}
+
+// Read implements the fs.NodeReader interface.
+func (dn *FSDeckNotes) Read(
+	ctx context.Context, fh fs.FileHandle, dest []byte, off int64) (
+	fuse.ReadResult, syscall.Errno) {
+	nh, ok := fh.(*notesHandle)
+	if !ok {
+		return nil, syscall.EBADF
+	}
+	nh.mu.Lock()
+	defer nh.mu.Unlock()
+	err := dn.load(ctx, nh)
+	if err != nil {
+		return nil, fs.ToErrno(err)
+	}
+	if off >= int64(len(nh.data)) {
+		return fuse.ReadResultData(nil), 0
+	}
+	end := off + int64(len(dest))
+	if end > int64(len(nh.data)) {
+		end = int64(len(nh.data))
+	}
+	// Copy, since the buffer may change before the result is sent.
+	return fuse.ReadResultData(
+		append([]byte(nil), nh.data[off:end]...)), 0
+}
+
+// Write implements the fs.NodeWriter interface.
+func (dn *FSDeckNotes) Write(
+	ctx context.Context, fh fs.FileHandle, data []byte, off int64) (
+	uint32, syscall.Errno) {
+	nh, ok := fh.(*notesHandle)
+	if !ok {
+		return 0, syscall.EBADF
+	}
+	nh.mu.Lock()
+	defer nh.mu.Unlock()
+	err := dn.load(ctx, nh)
+	if err != nil {
+		return 0, fs.ToErrno(err)
+	}
+	end := int(off) + len(data)
+	if end > len(nh.data) {
+		nh.data = resize(nh.data, end)
+	}
+	copy(nh.data[off:], data)
+	nh.dirty = true
+	return uint32(len(data)), 0
+}
+
+// Flush implements the fs.NodeFlusher interface.
+func (dn *FSDeckNotes) Flush(ctx context.Context, fh fs.FileHandle) syscall.Errno {
+	nh, ok := fh.(*notesHandle)
+	if !ok {
+		return 0
+	}
+	nh.mu.Lock()
+	if !nh.dirty {
+		nh.mu.Unlock()
+		return 0
+	}
+	data := string(nh.data)
+	nh.dirty = false
+	nh.mu.Unlock()
+
+	dn.mu.Lock()
+	defer dn.mu.Unlock()
+	err := dn.s.StoreDeckNotes(ctx, dn.id, data)
+	if err != nil {
+		nh.mu.Lock()
+		nh.dirty = true
+		nh.mu.Unlock()
+		return fs.ToErrno(err)
+	}
+	return 0
+}
@@ -0,0 +1,137 @@
+package fusefs
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/strib/forgefs/fsutil"
+)
+
+var (
+	randLock sync.Mutex
+	randSrc  = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// randomNames returns up to `n` distinct names picked at random from
+// `names`.
+func randomNames(names []string, n int) []string {
+	randLock.Lock()
+	defer randLock.Unlock()
+	if n > len(names) {
+		n = len(names)
+	}
+	picks := make([]string, n)
+	for i, j := range randSrc.Perm(len(names))[:n] {
+		picks[i] = names[j]
+	}
+	return picks
+}
+
+// noEntryCache stops the kernel from caching the entry in `out`, so
+// that every lookup of the name comes back to the file system.  The
+// FUSE bridge replaces a zero timeout with its default, so this uses
+// the smallest non-zero one instead.
+func noEntryCache(out *fuse.EntryOut) {
+	out.SetEntryTimeout(time.Nanosecond)
+	out.SetAttrTimeout(time.Nanosecond)
+}
+
+// parseRandomDecksDir returns the number of decks requested by a
+// `.random-N` directory name, and `true` if the name is one.
+func parseRandomDecksDir(name string) (int, bool) {
+	if !strings.HasPrefix(name, fsutil.RandomDecksDirPrefix) {
+		return 0, false
+	}
+	s := strings.TrimPrefix(name, fsutil.RandomDecksDirPrefix)
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 || strconv.Itoa(n) != s {
+		return 0, false
+	}
+	return n, true
+}
+
+// FSRandomDeckLink represents a symlink to a deck picked at random
+// from its parent directory, every time the link is read.
+type FSRandomDeckLink struct {
+	fs.Inode
+	mdd *FSMyDecksDir
+}
+
+var _ fs.InodeEmbedder = (*FSRandomDeckLink)(nil)
+var _ fs.NodeReadlinker = (*FSRandomDeckLink)(nil)
+
+// Readlink implements the fs.NodeReadlinker interface.
+func (rdl *FSRandomDeckLink) Readlink(ctx context.Context) (
+	[]byte, syscall.Errno) {
+	picks := randomNames(rdl.mdd.deckNames(), 1)
+	if len(picks) == 0 {
+		return nil, syscall.ENOENT
+	}
+	return []byte(picks[0]), 0
+}
+
+// FSRandomDecksDir represents a directory containing symlinks to
+// distinct decks picked at random from its parent directory when the
+// directory is looked up.
+type FSRandomDecksDir struct {
+	fs.Inode
+	names []string
+}
+
+var _ fs.InodeEmbedder = (*FSRandomDecksDir)(nil)
+var _ fs.NodeLookuper = (*FSRandomDecksDir)(nil)
+var _ fs.NodeReaddirer = (*FSRandomDecksDir)(nil)
+
+// Lookup implements the fs.NodeLookuper interface.
+func (rdd *FSRandomDecksDir) Lookup(
+	ctx context.Context, name string, out *fuse.EntryOut) (
+	*fs.Inode, syscall.Errno) {
+	n := rdd.GetChild(name)
+	if n != nil {
+		return n, 0
+	}
+
+	found := false
+	for _, deckName := range rdd.names {
+		if deckName == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, syscall.ENOENT
+	}
+
+	n = rdd.NewInode(ctx, &fs.MemSymlink{
+		Data: []byte("../" + name),
+	}, fs.StableAttr{
+		Mode: syscall.S_IFLNK,
+	})
+
+	ok := rdd.AddChild(name, n, false)
+	if !ok {
+		return nil, syscall.EIO
+	}
+	return n, 0
+}
+
+// Readdir implements the fs.NodeReaddirer interface.
+func (rdd *FSRandomDecksDir) Readdir(ctx context.Context) (
+	fs.DirStream, syscall.Errno) {
+	entries := make([]fuse.DirEntry, 0, len(rdd.names))
+	for _, name := range rdd.names {
+		entries = append(entries, fuse.DirEntry{
+			Mode: syscall.S_IFLNK,
+			Name: name,
+		})
+	}
+
+	return fs.NewListDirStream(entries), 0
+}
@@ -0,0 +1,135 @@
+package fusefs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/strib/forgefs"
+	"github.com/strib/forgefs/fsutil"
+)
+
+// FSSearchResultsDir represents a directory containing symlinks to
+// every card matching a search query.  Entries are prefixed with
+// their rank, so that listings sort by relevance, like `01 - Anger`.
+type FSSearchResultsDir struct {
+	fs.Inode
+
+	names  []string
+	titles map[string]string // entry name -> card title
+}
+
+func newFSSearchResultsDir(titles []string) *FSSearchResultsDir {
+	width := len(strconv.Itoa(len(titles)))
+	if width < 2 {
+		width = 2
+	}
+	srd := &FSSearchResultsDir{
+		names:  make([]string, 0, len(titles)),
+		titles: make(map[string]string, len(titles)),
+	}
+	for i, title := range titles {
+		name := fmt.Sprintf("%0*d - %s", width, i+1, title)
+		srd.names = append(srd.names, name)
+		srd.titles[name] = title
+	}
+	return srd
+}
+
+var _ fs.InodeEmbedder = (*FSSearchResultsDir)(nil)
+var _ fs.NodeLookuper = (*FSSearchResultsDir)(nil)
+var _ fs.NodeReaddirer = (*FSSearchResultsDir)(nil)
+
+// Lookup implements the fs.NodeLookuper interface.
+func (srd *FSSearchResultsDir) Lookup(
+	ctx context.Context, name string, out *fuse.EntryOut) (
+	*fs.Inode, syscall.Errno) {
+	n := srd.GetChild(name)
+	if n != nil {
+		return n, 0
+	}
+
+	title, ok := srd.titles[name]
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+
+	n = srd.NewInode(ctx, &fs.MemSymlink{
+		Data: []byte("../../" + fsutil.CardsDir + "/" + title),
+	}, fs.StableAttr{
+		Mode: syscall.S_IFLNK,
+	})
+
+	ok = srd.AddChild(name, n, false)
+	if !ok {
+		return nil, syscall.EIO
+	}
+	return n, 0
+}
+
+// Readdir implements the fs.NodeReaddirer interface.
+func (srd *FSSearchResultsDir) Readdir(ctx context.Context) (
+	fs.DirStream, syscall.Errno) {
+	entries := make([]fuse.DirEntry, 0, len(srd.names))
+	for _, name := range srd.names {
+		entries = append(entries, fuse.DirEntry{
+			Mode: syscall.S_IFLNK,
+			Name: name,
+		})
+	}
+
+	return fs.NewListDirStream(entries), 0
+}
+
+// FSSearchDir is a virtual directory for full-text searches of the
+// card catalog, where each subdirectory name is a search query.
+type FSSearchDir struct {
+	fs.Inode
+	s forgefs.Storage
+}
+
+// NewFSSearchDir creates a new FSSearchDir instance.
+func NewFSSearchDir(s forgefs.Storage) *FSSearchDir {
+	return &FSSearchDir{
+		s: s,
+	}
+}
+
+var _ fs.InodeEmbedder = (*FSSearchDir)(nil)
+var _ fs.NodeLookuper = (*FSSearchDir)(nil)
+var _ fs.NodeReaddirer = (*FSSearchDir)(nil)
+
+// Lookup implements the fs.NodeLookuper interface.
+func (sd *FSSearchDir) Lookup(
+	ctx context.Context, name string, out *fuse.EntryOut) (
+	*fs.Inode, syscall.Errno) {
+	n := sd.GetChild(name)
+	if n != nil {
+		return n, 0
+	}
+
+	titles, err := sd.s.SearchCards(ctx, name)
+	if err != nil {
+		return nil, fs.ToErrno(err)
+	}
+
+	n = sd.NewInode(ctx, newFSSearchResultsDir(titles), fs.StableAttr{
+		Mode: syscall.S_IFDIR,
+	})
+
+	ok := sd.AddChild(name, n, false)
+	if !ok {
+		return nil, syscall.EIO
+	}
+	return n, 0
+}
+
+// Readdir implements the fs.NodeReaddirer interface.  The directory
+// is virtual, so it doesn't list any queries.
+func (sd *FSSearchDir) Readdir(ctx context.Context) (
+	fs.DirStream, syscall.Errno) {
+	return fs.NewListDirStream(nil), 0
+}
@@ -0,0 +1,257 @@
+package fusefs
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/strib/forgefs"
+	"github.com/strib/forgefs/fsutil"
+)
+
+// setEntry represents one printing of a card within an expansion.
+type setEntry struct {
+	number string
+	title  string
+}
+
+// name returns the directory entry name for this printing, with the
+// collector number zero-padded so that entries sort naturally.
+func (se setEntry) name() string {
+	number := se.number
+	if i, err := strconv.Atoi(number); err == nil {
+		number = fmt.Sprintf("%03d", i)
+	}
+	return number + " - " + se.title
+}
+
+func sortSetEntries(entries []setEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, aErr := strconv.Atoi(entries[i].number)
+		b, bErr := strconv.Atoi(entries[j].number)
+		switch {
+		case aErr == nil && bErr == nil && a != b:
+			return a < b
+		case aErr == nil && bErr != nil:
+			return true
+		case aErr != nil && bErr == nil:
+			return false
+		case entries[i].number != entries[j].number:
+			return entries[i].number < entries[j].number
+		}
+		return entries[i].title < entries[j].title
+	})
+}
+
+// FSSetDir represents a directory containing symlinks to every card
+// printed in one expansion, named by collector number.
+type FSSetDir struct {
+	fs.Inode
+
+	entries []setEntry
+	titles  map[string]string // entry name -> card title
+}
+
+// newFSSetDir creates a new FSSetDir instance from already-sorted
+// entries.
+func newFSSetDir(entries []setEntry) *FSSetDir {
+	sd := &FSSetDir{
+		entries: make([]setEntry, 0, len(entries)),
+		titles:  make(map[string]string, len(entries)),
+	}
+	for _, e := range entries {
+		name := e.name()
+		if _, ok := sd.titles[name]; ok {
+			continue
+		}
+		sd.titles[name] = e.title
+		sd.entries = append(sd.entries, e)
+	}
+	return sd
+}
+
+var _ fs.InodeEmbedder = (*FSSetDir)(nil)
+var _ fs.NodeLookuper = (*FSSetDir)(nil)
+var _ fs.NodeReaddirer = (*FSSetDir)(nil)
+
+// Lookup implements the fs.NodeLookuper interface.
+func (sd *FSSetDir) Lookup(
+	ctx context.Context, name string, out *fuse.EntryOut) (
+	*fs.Inode, syscall.Errno) {
+	n := sd.GetChild(name)
+	if n != nil {
+		return n, 0
+	}
+
+	title, ok := sd.titles[name]
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+
+	n = sd.NewInode(ctx, &fs.MemSymlink{
+		Data: []byte("../../" + fsutil.CardsDir + "/" + title),
+	}, fs.StableAttr{
+		Mode: syscall.S_IFLNK,
+	})
+
+	ok = sd.AddChild(name, n, false)
+	if !ok {
+		return nil, syscall.EIO
+	}
+	return n, 0
+}
+
+// Readdir implements the fs.NodeReaddirer interface.
+func (sd *FSSetDir) Readdir(ctx context.Context) (
+	fs.DirStream, syscall.Errno) {
+	entries := make([]fuse.DirEntry, 0, len(sd.entries))
+	for _, e := range sd.entries {
+		entries = append(entries, fuse.DirEntry{
+			Mode: syscall.S_IFLNK,
+			Name: e.name(),
+		})
+	}
+
+	return fs.NewListDirStream(entries), 0
+}
+
+// FSSetsDir represents the directory containing a subdirectory for
+// each expansion.
+type FSSetsDir struct {
+	fs.Inode
+	s forgefs.Storage
+
+	mu   sync.Mutex
+	sets map[string][]setEntry // expansion short name -> sorted cards
+}
+
+// NewFSSetsDir creates a new FSSetsDir instance.
+func NewFSSetsDir(ctx context.Context, s forgefs.Storage) (
+	*FSSetsDir, error) {
+	sd := &FSSetsDir{
+		s: s,
+	}
+	sets, err := sd.loadSets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sd.sets = sets
+	return sd, nil
+}
+
+func (sd *FSSetsDir) loadSets(ctx context.Context) (
+	map[string][]setEntry, error) {
+	titles, err := sd.s.GetCardTitles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	numbers, err := sd.s.GetCardNumbers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sets := make(map[string][]setEntry)
+	for id, cardNumbers := range numbers {
+		title, ok := titles[id]
+		if !ok {
+			continue
+		}
+		for _, cn := range cardNumbers {
+			if cn.Expansion == "" {
+				continue
+			}
+			exp := fsutil.ExpansionShortName(cn.Expansion)
+			sets[exp] = append(sets[exp], setEntry{
+				number: cn.CardNumber,
+				title:  title,
+			})
+		}
+	}
+	for _, entries := range sets {
+		sortSetEntries(entries)
+	}
+	return sets, nil
+}
+
+// refresh reloads the expansions from storage, and returns the ones
+// that were added, and the ones that were removed or whose cards
+// changed, which must be rebuilt.
+func (sd *FSSetsDir) refresh(ctx context.Context) (
+	added, removed []string, err error) {
+	sets, err := sd.loadSets(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	for exp, entries := range sets {
+		oldEntries, ok := sd.sets[exp]
+		switch {
+		case !ok:
+			added = append(added, exp)
+		case !reflect.DeepEqual(entries, oldEntries):
+			removed = append(removed, exp)
+		}
+	}
+	for exp := range sd.sets {
+		if _, ok := sets[exp]; !ok {
+			removed = append(removed, exp)
+		}
+	}
+	sd.sets = sets
+	return added, removed, nil
+}
+
+var _ fs.InodeEmbedder = (*FSSetsDir)(nil)
+var _ fs.NodeLookuper = (*FSSetsDir)(nil)
+var _ fs.NodeReaddirer = (*FSSetsDir)(nil)
+
+// Lookup implements the fs.NodeLookuper interface.
+func (sd *FSSetsDir) Lookup(
+	ctx context.Context, name string, out *fuse.EntryOut) (
+	*fs.Inode, syscall.Errno) {
+	n := sd.GetChild(name)
+	if n != nil {
+		return n, 0
+	}
+
+	sd.mu.Lock()
+	entries, ok := sd.sets[name]
+	sd.mu.Unlock()
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+
+	n = sd.NewInode(ctx, newFSSetDir(entries), fs.StableAttr{
+		Mode: syscall.S_IFDIR,
+	})
+
+	ok = sd.AddChild(name, n, false)
+	if !ok {
+		return nil, syscall.EIO
+	}
+	return n, 0
+}
+
+// Readdir implements the fs.NodeReaddirer interface.
+func (sd *FSSetsDir) Readdir(ctx context.Context) (
+	fs.DirStream, syscall.Errno) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	entries := make([]fuse.DirEntry, 0, len(sd.sets))
+	for exp := range sd.sets {
+		entries = append(entries, fuse.DirEntry{
+			Mode: syscall.S_IFDIR,
+			Name: exp,
+		})
+	}
+
+	return fs.NewListDirStream(entries), 0
+}
@@ -0,0 +1,193 @@
+package fusefs
+
+import (
+	"context"
+	"sync"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/strib/forgefs"
+	"github.com/strib/forgefs/fsutil"
+)
+
+// FSStatsDir represents a directory of files summarizing the user's
+// whole collection of decks.  The stats are computed once and kept
+// until the stored decks change.
+type FSStatsDir struct {
+	fs.Inode
+	s forgefs.Storage
+
+	mu    sync.Mutex
+	stats *forgefs.CollectionStats
+}
+
+// NewFSStatsDir creates a new FSStatsDir instance.
+func NewFSStatsDir(s forgefs.Storage) *FSStatsDir {
+	return &FSStatsDir{
+		s: s,
+	}
+}
+
+var _ fs.InodeEmbedder = (*FSStatsDir)(nil)
+var _ fs.NodeLookuper = (*FSStatsDir)(nil)
+var _ fs.NodeReaddirer = (*FSStatsDir)(nil)
+
+func (sd *FSStatsDir) getStats(ctx context.Context) (
+	*forgefs.CollectionStats, error) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	if sd.stats != nil {
+		return sd.stats, nil
+	}
+	stats, err := sd.s.GetCollectionStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sd.stats = stats
+	return stats, nil
+}
+
+// reset drops the computed stats, so they are recomputed on the next
+// read.
+func (sd *FSStatsDir) reset() {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	sd.stats = nil
+}
+
+// collectionMedians caches the median stats of the user's whole
+// collection, which every deck chart is drawn against.  Like the
+// stats directory, it is kept until the stored decks change.
+type collectionMedians struct {
+	s forgefs.Storage
+
+	mu      sync.Mutex
+	medians *forgefs.StatValues
+	// latest and version track the last medians computed, even
+	// across resets, so callers can tell when the values really
+	// changed.
+	latest  forgefs.StatValues
+	version uint64
+}
+
+func (cm *collectionMedians) getLocked(ctx context.Context) (
+	*forgefs.StatValues, error) {
+	if cm.medians != nil {
+		return cm.medians, nil
+	}
+	medians, err := cm.s.GetCollectionMedians(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if cm.version == 0 || *medians != cm.latest {
+		cm.latest = *medians
+		cm.version++
+	}
+	cm.medians = medians
+	return medians, nil
+}
+
+func (cm *collectionMedians) get(ctx context.Context) (
+	*forgefs.StatValues, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.getLocked(ctx)
+}
+
+// getVersion returns a number that changes whenever the computed
+// medians do.
+func (cm *collectionMedians) getVersion(ctx context.Context) (
+	uint64, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	_, err := cm.getLocked(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return cm.version, nil
+}
+
+// reset drops the computed medians, so they are recomputed on the
+// next read.
+func (cm *collectionMedians) reset() {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.medians = nil
+}
+
+func statsFormatter(name string) func(
+	*forgefs.CollectionStats) ([]byte, error) {
+	switch name {
+	case fsutil.StatsSummaryFilename:
+		return fsutil.FormatCollectionStatsJSON
+	case fsutil.StatsByHouseFilename:
+		return func(stats *forgefs.CollectionStats) ([]byte, error) {
+			return fsutil.FormatHouseStatsCSV(stats.ByHouse)
+		}
+	case fsutil.StatsByExpansionFilename:
+		return func(stats *forgefs.CollectionStats) ([]byte, error) {
+			return fsutil.FormatExpansionStatsCSV(stats.ByExpansion)
+		}
+	case fsutil.StatsSASHistogramFilename:
+		return func(stats *forgefs.CollectionStats) ([]byte, error) {
+			return fsutil.FormatSASHistogramCSV(stats.SASHistogram)
+		}
+	case fsutil.StatsSASChartFilename:
+		return func(stats *forgefs.CollectionStats) ([]byte, error) {
+			return fsutil.FormatSASHistogramSVG(stats.SASHistogram), nil
+		}
+	}
+	return nil
+}
+
+// Lookup implements the fs.NodeLookuper interface.
+func (sd *FSStatsDir) Lookup(
+	ctx context.Context, name string, out *fuse.EntryOut) (
+	*fs.Inode, syscall.Errno) {
+	n := sd.GetChild(name)
+	if n != nil {
+		return n, fillEntryAttr(ctx, n, out)
+	}
+
+	format := statsFormatter(name)
+	if format == nil {
+		return nil, syscall.ENOENT
+	}
+
+	n = sd.NewInode(ctx, &FSFile{
+		getData: func(ctx context.Context) ([]byte, error) {
+			stats, err := sd.getStats(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return format(stats)
+		},
+	}, fs.StableAttr{})
+
+	ok := sd.AddChild(name, n, false)
+	if !ok {
+		return nil, syscall.EIO
+	}
+	return n, fillEntryAttr(ctx, n, out)
+}
+
+// Readdir implements the fs.NodeReaddirer interface.
+func (sd *FSStatsDir) Readdir(ctx context.Context) (
+	fs.DirStream, syscall.Errno) {
+	names := []string{
+		fsutil.StatsSummaryFilename,
+		fsutil.StatsByHouseFilename,
+		fsutil.StatsByExpansionFilename,
+		fsutil.StatsSASHistogramFilename,
+		fsutil.StatsSASChartFilename,
+	}
+	entries := make([]fuse.DirEntry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, fuse.DirEntry{
+			Mode: syscall.S_IFREG,
+			Name: name,
+		})
+	}
+	return fs.NewListDirStream(entries), 0
+}
@@ -0,0 +1,250 @@
+package fusefs
+
+import (
+	"context"
+	"path"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/strib/forgefs"
+	"github.com/strib/forgefs/filter"
+	"github.com/strib/forgefs/fsutil"
+)
+
+// validTagName returns true if `tag` can be used as a tag name, which
+// means it must also be usable as a `tag=` filter value.
+func validTagName(tag string) bool {
+	n, err := filter.Parse("tag=" + tag)
+	if err != nil || n.Constraint == nil {
+		return false
+	}
+	v := n.Constraint.Value.String
+	return v != nil && *v == tag
+}
+
+// FSTagDir represents a directory containing symlinks to every deck
+// with a given tag.  Symlinking a deck into it tags the deck, and
+// removing a symlink untags it.
+type FSTagDir struct {
+	fs.Inode
+	s   forgefs.Storage
+	tag string
+}
+
+var _ fs.InodeEmbedder = (*FSTagDir)(nil)
+var _ fs.NodeLookuper = (*FSTagDir)(nil)
+var _ fs.NodeReaddirer = (*FSTagDir)(nil)
+var _ fs.NodeSymlinker = (*FSTagDir)(nil)
+var _ fs.NodeUnlinker = (*FSTagDir)(nil)
+
+func (td *FSTagDir) newDeckLink(ctx context.Context, name string) *fs.Inode {
+	return td.NewInode(ctx, &fs.MemSymlink{
+		Data: []byte("../../" + fsutil.MyDecksDir + "/" + name),
+	}, fs.StableAttr{
+		Mode: syscall.S_IFLNK,
+	})
+}
+
+// getDeckID returns the ID of the tagged deck with the given name.
+func (td *FSTagDir) getDeckID(ctx context.Context, name string) (
+	string, syscall.Errno) {
+	mds, err := td.s.GetTaggedDeckMetadata(ctx, td.tag)
+	if err != nil {
+		return "", fs.ToErrno(err)
+	}
+	for _, md := range mds {
+		if md.Name == name {
+			return md.ID, 0
+		}
+	}
+	return "", syscall.ENOENT
+}
+
+// Lookup implements the fs.NodeLookuper interface.
+func (td *FSTagDir) Lookup(
+	ctx context.Context, name string, out *fuse.EntryOut) (
+	*fs.Inode, syscall.Errno) {
+	n := td.GetChild(name)
+	if n != nil {
+		return n, 0
+	}
+
+	_, errno := td.getDeckID(ctx, name)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	n = td.newDeckLink(ctx, name)
+	ok := td.AddChild(name, n, false)
+	if !ok {
+		return nil, syscall.EIO
+	}
+	return n, 0
+}
+
+// Readdir implements the fs.NodeReaddirer interface.
+func (td *FSTagDir) Readdir(ctx context.Context) (
+	fs.DirStream, syscall.Errno) {
+	mds, err := td.s.GetTaggedDeckMetadata(ctx, td.tag)
+	if err != nil {
+		return nil, fs.ToErrno(err)
+	}
+	entries := make([]fuse.DirEntry, 0, len(mds))
+	for _, md := range mds {
+		entries = append(entries, fuse.DirEntry{
+			Mode: syscall.S_IFLNK,
+			Name: md.Name,
+		})
+	}
+
+	return fs.NewListDirStream(entries), 0
+}
+
+// Symlink implements the fs.NodeSymlinker interface.  The target must
+// be one of the user's decks, and the link must have the same name as
+// the deck.
+func (td *FSTagDir) Symlink(
+	ctx context.Context, target, name string, out *fuse.EntryOut) (
+	*fs.Inode, syscall.Errno) {
+	if path.Base(target) != name {
+		return nil, syscall.EINVAL
+	}
+
+	mds, err := td.s.GetDeckMetadata(ctx, forgefs.DeckListMine)
+	if err != nil {
+		return nil, fs.ToErrno(err)
+	}
+	var id string
+	for _, md := range mds {
+		if md.Name == name {
+			id = md.ID
+			break
+		}
+	}
+	if id == "" {
+		return nil, syscall.ENOENT
+	}
+
+	err = td.s.TagDeck(ctx, td.tag, id)
+	if err != nil {
+		return nil, fs.ToErrno(err)
+	}
+	return td.newDeckLink(ctx, name), 0
+}
+
+// Unlink implements the fs.NodeUnlinker interface.
+func (td *FSTagDir) Unlink(ctx context.Context, name string) syscall.Errno {
+	id, errno := td.getDeckID(ctx, name)
+	if errno != 0 {
+		return errno
+	}
+	return fs.ToErrno(td.s.UntagDeck(ctx, td.tag, id))
+}
+
+// FSTagsDir represents the directory containing a subdirectory for
+// each user-defined tag.  Making a subdirectory creates a new tag.
+type FSTagsDir struct {
+	fs.Inode
+	s forgefs.Storage
+}
+
+// NewFSTagsDir creates a new FSTagsDir instance.
+func NewFSTagsDir(s forgefs.Storage) *FSTagsDir {
+	return &FSTagsDir{
+		s: s,
+	}
+}
+
+var _ fs.InodeEmbedder = (*FSTagsDir)(nil)
+var _ fs.NodeLookuper = (*FSTagsDir)(nil)
+var _ fs.NodeReaddirer = (*FSTagsDir)(nil)
+var _ fs.NodeMkdirer = (*FSTagsDir)(nil)
+var _ fs.NodeRmdirer = (*FSTagsDir)(nil)
+
+func (td *FSTagsDir) newTagDir(ctx context.Context, tag string) *fs.Inode {
+	return td.NewInode(ctx, &FSTagDir{
+		s:   td.s,
+		tag: tag,
+	}, fs.StableAttr{
+		Mode: syscall.S_IFDIR,
+	})
+}
+
+// Lookup implements the fs.NodeLookuper interface.
+func (td *FSTagsDir) Lookup(
+	ctx context.Context, name string, out *fuse.EntryOut) (
+	*fs.Inode, syscall.Errno) {
+	n := td.GetChild(name)
+	if n != nil {
+		return n, 0
+	}
+
+	tags, err := td.s.GetTags(ctx)
+	if err != nil {
+		return nil, fs.ToErrno(err)
+	}
+	found := false
+	for _, tag := range tags {
+		if tag == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, syscall.ENOENT
+	}
+
+	n = td.newTagDir(ctx, name)
+	ok := td.AddChild(name, n, false)
+	if !ok {
+		return nil, syscall.EIO
+	}
+	return n, 0
+}
+
+// Readdir implements the fs.NodeReaddirer interface.
+func (td *FSTagsDir) Readdir(ctx context.Context) (
+	fs.DirStream, syscall.Errno) {
+	tags, err := td.s.GetTags(ctx)
+	if err != nil {
+		return nil, fs.ToErrno(err)
+	}
+	entries := make([]fuse.DirEntry, 0, len(tags))
+	for _, tag := range tags {
+		entries = append(entries, fuse.DirEntry{
+			Mode: syscall.S_IFDIR,
+			Name: tag,
+		})
+	}
+
+	return fs.NewListDirStream(entries), 0
+}
+
+// Mkdir implements the fs.NodeMkdirer interface.
+func (td *FSTagsDir) Mkdir(
+	ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (
+	*fs.Inode, syscall.Errno) {
+	if !validTagName(name) {
+		return nil, syscall.EINVAL
+	}
+
+	err := td.s.CreateTag(ctx, name)
+	if err != nil {
+		return nil, fs.ToErrno(err)
+	}
+	return td.newTagDir(ctx, name), 0
+}
+
+// Rmdir implements the fs.NodeRmdirer interface.  Only tags without
+// any decks can be removed.
+func (td *FSTagsDir) Rmdir(ctx context.Context, name string) syscall.Errno {
+	mds, err := td.s.GetTaggedDeckMetadata(ctx, name)
+	if err != nil {
+		return fs.ToErrno(err)
+	}
+	if len(mds) > 0 {
+		return syscall.ENOTEMPTY
+	}
+	return fs.ToErrno(td.s.DeleteTag(ctx, name))
+}
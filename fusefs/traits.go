@@ -0,0 +1,339 @@
+package fusefs
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/strib/forgefs"
+	"github.com/strib/forgefs/fsutil"
+)
+
+// validTraitName returns true if the trait can be used as a file
+// name.
+func validTraitName(trait string) bool {
+	return trait != "" && trait != "." && trait != ".." &&
+		!strings.Contains(trait, "/")
+}
+
+// FSCardTraitsDir represents a directory containing symlinks to the
+// root trait directory of each trait a card provides or, if
+// `synergies` is set, each trait the card has a synergy with.
+type FSCardTraitsDir struct {
+	fs.Inode
+	s         forgefs.Storage
+	id        string
+	synergies bool
+}
+
+var _ fs.InodeEmbedder = (*FSCardTraitsDir)(nil)
+var _ fs.NodeLookuper = (*FSCardTraitsDir)(nil)
+var _ fs.NodeReaddirer = (*FSCardTraitsDir)(nil)
+
+func (ctd *FSCardTraitsDir) getTraits(ctx context.Context) (
+	[]string, error) {
+	card, err := ctd.s.GetCard(ctx, ctd.id)
+	if err != nil {
+		return nil, err
+	}
+	traits := card.ExtraCardInfo.Traits
+	if ctd.synergies {
+		traits = card.ExtraCardInfo.Synergies
+	}
+
+	// The same trait can show up more than once, for example with
+	// different houses or players.
+	seen := make(map[string]bool, len(traits))
+	names := make([]string, 0, len(traits))
+	for _, t := range traits {
+		if !validTraitName(t.Trait) || seen[t.Trait] {
+			continue
+		}
+		seen[t.Trait] = true
+		names = append(names, t.Trait)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Lookup implements the fs.NodeLookuper interface.
+func (ctd *FSCardTraitsDir) Lookup(
+	ctx context.Context, name string, out *fuse.EntryOut) (
+	*fs.Inode, syscall.Errno) {
+	n := ctd.GetChild(name)
+	if n != nil {
+		return n, 0
+	}
+
+	traits, err := ctd.getTraits(ctx)
+	if err != nil {
+		return nil, fs.ToErrno(err)
+	}
+	i := sort.SearchStrings(traits, name)
+	if i == len(traits) || traits[i] != name {
+		return nil, syscall.ENOENT
+	}
+
+	n = ctd.NewInode(ctx, &fs.MemSymlink{
+		Data: []byte("../../../" + fsutil.TraitsDir + "/" + name),
+	}, fs.StableAttr{
+		Mode: syscall.S_IFLNK,
+	})
+
+	ok := ctd.AddChild(name, n, false)
+	if !ok {
+		return nil, syscall.EIO
+	}
+	return n, 0
+}
+
+// Readdir implements the fs.NodeReaddirer interface.
+func (ctd *FSCardTraitsDir) Readdir(ctx context.Context) (
+	fs.DirStream, syscall.Errno) {
+	traits, err := ctd.getTraits(ctx)
+	if err != nil {
+		return nil, fs.ToErrno(err)
+	}
+	entries := make([]fuse.DirEntry, 0, len(traits))
+	for _, trait := range traits {
+		entries = append(entries, fuse.DirEntry{
+			Mode: syscall.S_IFLNK,
+			Name: trait,
+		})
+	}
+
+	return fs.NewListDirStream(entries), 0
+}
+
+// FSTraitCardsDir represents a directory containing symlinks to every
+// card that provides a trait or, if `synergies` is set, every card
+// that has a synergy with it.
+type FSTraitCardsDir struct {
+	fs.Inode
+	s         forgefs.Storage
+	trait     string
+	synergies bool
+}
+
+var _ fs.InodeEmbedder = (*FSTraitCardsDir)(nil)
+var _ fs.NodeLookuper = (*FSTraitCardsDir)(nil)
+var _ fs.NodeReaddirer = (*FSTraitCardsDir)(nil)
+
+func (tcd *FSTraitCardsDir) getTitles(ctx context.Context) (
+	[]string, error) {
+	providers, synergies, err := tcd.s.GetCardsWithTrait(ctx, tcd.trait)
+	if err != nil {
+		return nil, err
+	}
+	if tcd.synergies {
+		return synergies, nil
+	}
+	return providers, nil
+}
+
+// Lookup implements the fs.NodeLookuper interface.
+func (tcd *FSTraitCardsDir) Lookup(
+	ctx context.Context, name string, out *fuse.EntryOut) (
+	*fs.Inode, syscall.Errno) {
+	n := tcd.GetChild(name)
+	if n != nil {
+		return n, 0
+	}
+
+	titles, err := tcd.getTitles(ctx)
+	if err != nil {
+		return nil, fs.ToErrno(err)
+	}
+	found := false
+	for _, title := range titles {
+		if title == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, syscall.ENOENT
+	}
+
+	n = tcd.NewInode(ctx, &fs.MemSymlink{
+		Data: []byte("../../../" + fsutil.CardsDir + "/" + name),
+	}, fs.StableAttr{
+		Mode: syscall.S_IFLNK,
+	})
+
+	ok := tcd.AddChild(name, n, false)
+	if !ok {
+		return nil, syscall.EIO
+	}
+	return n, 0
+}
+
+// Readdir implements the fs.NodeReaddirer interface.
+func (tcd *FSTraitCardsDir) Readdir(ctx context.Context) (
+	fs.DirStream, syscall.Errno) {
+	titles, err := tcd.getTitles(ctx)
+	if err != nil {
+		return nil, fs.ToErrno(err)
+	}
+	entries := make([]fuse.DirEntry, 0, len(titles))
+	for _, title := range titles {
+		entries = append(entries, fuse.DirEntry{
+			Mode: syscall.S_IFLNK,
+			Name: title,
+		})
+	}
+
+	return fs.NewListDirStream(entries), 0
+}
+
+// FSTraitDir represents a directory for one trait, split into the
+// cards that provide it and the cards that have a synergy with it.
+type FSTraitDir struct {
+	fs.Inode
+	s     forgefs.Storage
+	trait string
+}
+
+var _ fs.InodeEmbedder = (*FSTraitDir)(nil)
+var _ fs.NodeLookuper = (*FSTraitDir)(nil)
+var _ fs.NodeReaddirer = (*FSTraitDir)(nil)
+
+// Lookup implements the fs.NodeLookuper interface.
+func (td *FSTraitDir) Lookup(
+	ctx context.Context, name string, out *fuse.EntryOut) (
+	*fs.Inode, syscall.Errno) {
+	n := td.GetChild(name)
+	if n != nil {
+		return n, 0
+	}
+
+	var synergies bool
+	switch name {
+	case fsutil.TraitProvidersDir:
+	case fsutil.TraitSynergiesDir:
+		synergies = true
+	default:
+		return nil, syscall.ENOENT
+	}
+
+	n = td.NewInode(ctx, &FSTraitCardsDir{
+		s:         td.s,
+		trait:     td.trait,
+		synergies: synergies,
+	}, fs.StableAttr{
+		Mode: syscall.S_IFDIR,
+	})
+
+	ok := td.AddChild(name, n, false)
+	if !ok {
+		return nil, syscall.EIO
+	}
+	return n, 0
+}
+
+// Readdir implements the fs.NodeReaddirer interface.
+func (td *FSTraitDir) Readdir(ctx context.Context) (
+	fs.DirStream, syscall.Errno) {
+	entries := []fuse.DirEntry{
+		{
+			Mode: syscall.S_IFDIR,
+			Name: fsutil.TraitProvidersDir,
+		},
+		{
+			Mode: syscall.S_IFDIR,
+			Name: fsutil.TraitSynergiesDir,
+		},
+	}
+	return fs.NewListDirStream(entries), 0
+}
+
+// FSTraitsDir represents the directory containing every trait known
+// to the card catalog as subdirectories.
+type FSTraitsDir struct {
+	fs.Inode
+	s forgefs.Storage
+}
+
+// NewFSTraitsDir creates a new FSTraitsDir instance.
+func NewFSTraitsDir(s forgefs.Storage) *FSTraitsDir {
+	return &FSTraitsDir{
+		s: s,
+	}
+}
+
+var _ fs.InodeEmbedder = (*FSTraitsDir)(nil)
+var _ fs.NodeLookuper = (*FSTraitsDir)(nil)
+var _ fs.NodeReaddirer = (*FSTraitsDir)(nil)
+
+func (td *FSTraitsDir) getTraits(ctx context.Context) ([]string, error) {
+	traits, err := td.s.GetTraits(ctx)
+	if err != nil {
+		return nil, err
+	}
+	valid := traits[:0]
+	for _, trait := range traits {
+		if validTraitName(trait) {
+			valid = append(valid, trait)
+		}
+	}
+	return valid, nil
+}
+
+// Lookup implements the fs.NodeLookuper interface.
+func (td *FSTraitsDir) Lookup(
+	ctx context.Context, name string, out *fuse.EntryOut) (
+	*fs.Inode, syscall.Errno) {
+	n := td.GetChild(name)
+	if n != nil {
+		return n, 0
+	}
+
+	traits, err := td.getTraits(ctx)
+	if err != nil {
+		return nil, fs.ToErrno(err)
+	}
+	found := false
+	for _, trait := range traits {
+		if trait == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, syscall.ENOENT
+	}
+
+	n = td.NewInode(ctx, &FSTraitDir{
+		s:     td.s,
+		trait: name,
+	}, fs.StableAttr{
+		Mode: syscall.S_IFDIR,
+	})
+
+	ok := td.AddChild(name, n, false)
+	if !ok {
+		return nil, syscall.EIO
+	}
+	return n, 0
+}
+
+// Readdir implements the fs.NodeReaddirer interface.
+func (td *FSTraitsDir) Readdir(ctx context.Context) (
+	fs.DirStream, syscall.Errno) {
+	traits, err := td.getTraits(ctx)
+	if err != nil {
+		return nil, fs.ToErrno(err)
+	}
+	entries := make([]fuse.DirEntry, 0, len(traits))
+	for _, trait := range traits {
+		entries = append(entries, fuse.DirEntry{
+			Mode: syscall.S_IFDIR,
+			Name: trait,
+		})
+	}
+
+	return fs.NewListDirStream(entries), 0
+}
@@ -0,0 +1,142 @@
+package fusefs
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/strib/forgefs"
+	"github.com/strib/forgefs/fsutil"
+)
+
+const xattrPrefix = "user.forgefs."
+
+// xattr is a single extended attribute name and value.
+type xattr struct {
+	name  string
+	value string
+}
+
+func formatXattrFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func deckXattrs(ds *forgefs.DeckSummary) []xattr {
+	return []xattr{
+		{xattrPrefix + "sas", strconv.Itoa(ds.SAS)},
+		{xattrPrefix + "aerc", strconv.Itoa(ds.AERC)},
+		{xattrPrefix + "houses", strings.Join(ds.Houses, ",")},
+		{xattrPrefix + "expansion", fsutil.ExpansionShortName(ds.Expansion)},
+		{xattrPrefix + "a", formatXattrFloat(ds.A)},
+		{xattrPrefix + "e", formatXattrFloat(ds.E)},
+		{xattrPrefix + "r", formatXattrFloat(ds.R)},
+		{xattrPrefix + "c", formatXattrFloat(ds.C)},
+		{xattrPrefix + "f", formatXattrFloat(ds.F)},
+		{xattrPrefix + "d", formatXattrFloat(ds.D)},
+	}
+}
+
+func cardXattrs(cs *forgefs.CardSummary) []xattr {
+	return []xattr{
+		{xattrPrefix + "house", cs.House},
+		{xattrPrefix + "type", cs.Type},
+		{xattrPrefix + "rarity", cs.Rarity},
+		{xattrPrefix + "expansion", fsutil.ExpansionShortName(cs.Expansion)},
+		{xattrPrefix + "aerc", formatXattrFloat(cs.AERC)},
+	}
+}
+
+// getxattr copies the value of the attribute named `attr` into
+// `dest`, following the fs.NodeGetxattrer conventions.
+func getxattr(attrs []xattr, attr string, dest []byte) (
+	uint32, syscall.Errno) {
+	for _, x := range attrs {
+		if x.name != attr {
+			continue
+		}
+		if len(dest) < len(x.value) {
+			return uint32(len(x.value)), syscall.ERANGE
+		}
+		return uint32(copy(dest, x.value)), 0
+	}
+	return 0, fs.ENOATTR
+}
+
+// listxattr copies the null-terminated names of all the given
+// attributes into `dest`, following the fs.NodeListxattrer
+// conventions.
+func listxattr(attrs []xattr, dest []byte) (uint32, syscall.Errno) {
+	var names []byte
+	for _, x := range attrs {
+		names = append(names, x.name...)
+		names = append(names, 0)
+	}
+	if len(dest) < len(names) {
+		return uint32(len(names)), syscall.ERANGE
+	}
+	return uint32(copy(dest, names)), 0
+}
+
+var _ fs.NodeGetxattrer = (*FSDeck)(nil)
+var _ fs.NodeListxattrer = (*FSDeck)(nil)
+
+func (d *FSDeck) xattrs(ctx context.Context) ([]xattr, error) {
+	ds, err := d.s.GetDeckSummary(ctx, d.id)
+	if err != nil {
+		return nil, err
+	}
+	return deckXattrs(ds), nil
+}
+
+// Getxattr implements the fs.NodeGetxattrer interface.
+func (d *FSDeck) Getxattr(ctx context.Context, attr string, dest []byte) (
+	uint32, syscall.Errno) {
+	attrs, err := d.xattrs(ctx)
+	if err != nil {
+		return 0, fs.ToErrno(err)
+	}
+	return getxattr(attrs, attr, dest)
+}
+
+// Listxattr implements the fs.NodeListxattrer interface.
+func (d *FSDeck) Listxattr(ctx context.Context, dest []byte) (
+	uint32, syscall.Errno) {
+	attrs, err := d.xattrs(ctx)
+	if err != nil {
+		return 0, fs.ToErrno(err)
+	}
+	return listxattr(attrs, dest)
+}
+
+var _ fs.NodeGetxattrer = (*FSCard)(nil)
+var _ fs.NodeListxattrer = (*FSCard)(nil)
+
+func (c *FSCard) xattrs(ctx context.Context) ([]xattr, error) {
+	cs, err := c.s.GetCardSummary(ctx, c.id)
+	if err != nil {
+		return nil, err
+	}
+	return cardXattrs(cs), nil
+}
+
+// Getxattr implements the fs.NodeGetxattrer interface.
+func (c *FSCard) Getxattr(ctx context.Context, attr string, dest []byte) (
+	uint32, syscall.Errno) {
+	attrs, err := c.xattrs(ctx)
+	if err != nil {
+		return 0, fs.ToErrno(err)
+	}
+	return getxattr(attrs, attr, dest)
+}
+
+// Listxattr implements the fs.NodeListxattrer interface.
+func (c *FSCard) Listxattr(ctx context.Context, dest []byte) (
+	uint32, syscall.Errno) {
+	attrs, err := c.xattrs(ctx)
+	if err != nil {
+		return 0, fs.ToErrno(err)
+	}
+	return listxattr(attrs, dest)
+}
@@ -2,16 +2,24 @@ package forgefs
 
 import (
 	"context"
+	"errors"
+	"io"
+	"time"
 
 	"github.com/strib/forgefs/filter"
 )
 
+// ErrNotFound is returned by the Storage methods that look up a
+// single card or deck, when it isn't stored.
+var ErrNotFound = errors.New("not found")
+
 // DataFetcher provides card and deck data.
 type DataFetcher interface {
 	// GetCards gets a full set of card objects.
 	GetCards(ctx context.Context) ([]Card, error)
 	// GetMyDecks gets all the decks associated with the user running
-	// this program.
+	// this program, including decks that are only on the user's
+	// wishlist or marked as funny.
 	GetMyDecks(ctx context.Context) (decks []Deck, err error)
 	// GetDeck returns the full deck object for the given `id`. If
 	// `deck` is not nil, it will be updated with whatever data has
@@ -47,45 +55,181 @@ type Storage interface {
 	GetCardTitles(ctx context.Context) (titles map[string]string, err error)
 	// GetCardImageURL retrieves the URL to the given card's image.
 	GetCardImageURL(ctx context.Context, id string) (url string, err error)
+	// GetCardImageURLs returns a map of expansion -> image URL for
+	// every printing of the card with the given `title`.
+	GetCardImageURLs(ctx context.Context, title string) (
+		urls map[string]string, err error)
 	// GetCard gets the full card object for the given `id`.
 	GetCard(ctx context.Context, id string) (card *Card, err error)
+	// GetCardSummary gets the indexed attributes of the card with
+	// the given `id`.
+	GetCardSummary(ctx context.Context, id string) (
+		summary *CardSummary, err error)
+	// GetCardByTitle gets the full card object for the card with the
+	// given `title`.
+	GetCardByTitle(ctx context.Context, title string) (card *Card, err error)
+	// GetCardNumbers returns a map of cardID -> every expansion and
+	// collector number that card was printed with, including
+	// reprints.
+	GetCardNumbers(ctx context.Context) (
+		numbers map[string][]CardNumber, err error)
+	// SearchCards returns the titles of all the cards whose title,
+	// text, flavor text or traits match every term in the given
+	// query, most relevant first.
+	SearchCards(ctx context.Context, query string) (
+		titles []string, err error)
+	// GetTraits returns every trait that a card provides or has a
+	// synergy with, in alphabetical order.
+	GetTraits(ctx context.Context) (traits []string, err error)
+	// GetCardsWithTrait returns the titles of the cards that provide
+	// the given trait, and of the cards that have a synergy with it.
+	GetCardsWithTrait(ctx context.Context, trait string) (
+		providers, synergies []string, err error)
 	// StoreDecks stores all the given decks, overwriting any existing
 	// decks with the same IDs as the new decks.
 	StoreDecks(ctx context.Context, decks []Deck) error
-	// GetMetadataNames gets all the decks owned by the user running the
-	// program.  It returns a map of deckID -> metadata.
-	GetMyDeckMetadata(ctx context.Context) (
+	// GetDeckMetadata gets all the decks in the given list of the
+	// user running the program.  It returns a map of deckID ->
+	// metadata.
+	GetDeckMetadata(ctx context.Context, list DeckList) (
 		mds map[string]DeckMetadata, err error)
-	// GetMyDeckMetadataWithFilter gets all the decks owned by the user,
-	// which also match the given filter. It returns a map of deckID
-	// -> metadata.
-	GetMyDeckMetadataWithFilter(ctx context.Context, filterRoot *filter.Node) (
+	// GetDeckMetadataWithFilter gets all the decks in the given list
+	// of the user, which also match the given filter. It returns a
+	// map of deckID -> metadata.
+	GetDeckMetadataWithFilter(
+		ctx context.Context, list DeckList, filterRoot *filter.Node) (
 		mds map[string]DeckMetadata, err error)
 	// GetDeck returns the full deck object for the given `id`.
 	GetDeck(ctx context.Context, id string) (deck *Deck, err error)
+	// GetDecksWithCard returns every deck owned by the user that
+	// contains the card with the given title, along with how many
+	// copies of it each deck contains.  Decks whose card lists
+	// haven't been fetched yet aren't included.
+	GetDecksWithCard(ctx context.Context, title string) (
+		decks []DeckCardCount, err error)
+	// GetUnfetchedDeckCount returns the number of decks owned by the
+	// user whose card lists haven't been fetched yet.
+	GetUnfetchedDeckCount(ctx context.Context) (count int, err error)
+	// GetCollectionStats returns counts, averages and top decks for
+	// all the decks owned by the user, overall and by house and
+	// expansion.
+	GetCollectionStats(ctx context.Context) (
+		stats *CollectionStats, err error)
+	// GetCollectionMedians returns the median of each stat over all
+	// the decks owned by the user.
+	GetCollectionMedians(ctx context.Context) (
+		medians *StatValues, err error)
+	// GetDeckSummary gets the indexed stats of the deck with the
+	// given `id`.
+	GetDeckSummary(ctx context.Context, id string) (
+		summary *DeckSummary, err error)
+	// GetDeckNotes returns the user's local notes for the given deck,
+	// which default to the deck's notes from the data fetcher.
+	GetDeckNotes(ctx context.Context, id string) (notes string, err error)
+	// StoreDeckNotes overwrites the user's local notes for the given
+	// deck.  These notes are preserved across deck updates and
+	// storage resets.
+	StoreDeckNotes(ctx context.Context, id, notes string) error
+	// GetTags returns the names of all the user-defined deck tags.
+	GetTags(ctx context.Context) (tags []string, err error)
+	// CreateTag creates a new deck tag, if it doesn't already exist.
+	// Tags are preserved across storage resets.
+	CreateTag(ctx context.Context, tag string) error
+	// DeleteTag deletes the given tag, removing it from all decks.
+	DeleteTag(ctx context.Context, tag string) error
+	// TagDeck adds the given tag to the deck with the given `id`.
+	TagDeck(ctx context.Context, tag, id string) error
+	// UntagDeck removes the given tag from the deck with the given
+	// `id`.
+	UntagDeck(ctx context.Context, tag, id string) error
+	// GetTaggedDeckMetadata gets all the decks with the given tag.
+	// It returns a map of deckID -> metadata.
+	GetTaggedDeckMetadata(ctx context.Context, tag string) (
+		mds map[string]DeckMetadata, err error)
 	// GetSampleDeckWithVersion returns a sample deck and its SAS version.
 	GetSampleDeckWithVersion(ctx context.Context) (
 		deckID string, sasVersion int, err error)
 	// Resets the storage, deleting all current data.
 	Reset(ctx context.Context) error
+	// SetSyncTime records that a full sync of the given kind (e.g.,
+	// `SyncCards`) finished at time `t`.
+	SetSyncTime(ctx context.Context, kind string, t time.Time) error
+	// GetSyncTimes returns a map of sync kind -> the time that kind of
+	// sync last finished.
+	GetSyncTimes(ctx context.Context) (times map[string]time.Time, err error)
+	// SetObserver registers an observer to notify whenever cards or
+	// decks are stored, replacing any previous observer.  A nil
+	// observer turns notifications off.
+	SetObserver(o StorageObserver)
+}
+
+// StorageObserver is notified after cards or decks are stored, so
+// that anything showing the old data can be refreshed.
+type StorageObserver interface {
+	// CardsUpdated is called after the given cards are stored.
+	CardsUpdated(ctx context.Context, cards []Card)
+	// DecksUpdated is called after the given decks are stored.
+	DecksUpdated(ctx context.Context, decks []Deck)
+}
+
+// StatsReporter is implemented by network clients that keep track
+// of their own activity.
+type StatsReporter interface {
+	// ClientStats returns a snapshot of the client's activity.
+	ClientStats() ClientStats
+	// RecentErrors returns the client's most recent errors, oldest
+	// first.
+	RecentErrors() []ErrorRecord
+}
+
+// ImageFile is an open, read-only image file.
+type ImageFile interface {
+	io.ReaderAt
+	io.Closer
 }
 
 // ImageCache stores card and deck images locally, for performance.
 type ImageCache interface {
 	// GetCardImage returns the card image data and `true` if the card
-	// exists in the cache.
-	GetCardImage(ctx context.Context, cardID, fileType string) (
+	// exists in the cache.  An empty `expansion` refers to the card's
+	// default image.
+	GetCardImage(ctx context.Context, cardID, expansion, fileType string) (
 		[]byte, bool, error)
+	// GetCardImageSize returns the size of the cached card image
+	// data and `true` if the card exists in the cache.
+	GetCardImageSize(
+		ctx context.Context, cardID, expansion, fileType string) (
+		int64, bool, error)
 	// StoreCardImage stores the given card data as the given file
-	// type, overwriting any existing data for that card and type.
+	// type, overwriting any existing data for that card, expansion
+	// and type.
 	StoreCardImage(
-		ctx context.Context, cardID, fileType string, data []byte) error
+		ctx context.Context, cardID, expansion, fileType string,
+		data []byte) error
 	// GetDeckImage returns the deck image data and `true` if the deck
 	// exists in the cache.
 	GetDeckImage(ctx context.Context, deckID, fileType string) (
 		[]byte, bool, error)
+	// GetDeckImageSize returns the size of the cached deck image
+	// data and `true` if the deck exists in the cache.
+	GetDeckImageSize(ctx context.Context, deckID, fileType string) (
+		int64, bool, error)
+	// OpenCardImage opens the cached card image for streaming reads,
+	// and returns its size and `true` if the card exists in the
+	// cache.  The caller must close the returned file.
+	OpenCardImage(
+		ctx context.Context, cardID, expansion, fileType string) (
+		ImageFile, int64, bool, error)
+	// OpenDeckImage opens the cached deck image for streaming reads,
+	// and returns its size and `true` if the deck exists in the
+	// cache.  The caller must close the returned file.
+	OpenDeckImage(ctx context.Context, deckID, fileType string) (
+		ImageFile, int64, bool, error)
 	// StoreDeckImage stores the given deck data as the given file
 	// type, overwriting any existing data for that deck and type.
 	StoreDeckImage(
 		ctx context.Context, deckID, fileType string, data []byte) error
+	// Clear deletes every cached image.  Files that are already open
+	// can still be read.
+	Clear(ctx context.Context) error
 }
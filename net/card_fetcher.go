@@ -10,14 +10,25 @@ import (
 )
 
 // CardFetcher is a simple type for fetching images directly from a
-// URL.
-type CardFetcher struct{}
+// URL.  The zero value is ready to use, though its stats are unnamed.
+type CardFetcher struct {
+	clientStats
+}
 
 var _ forgefs.CardImageFetcher = (*CardFetcher)(nil)
+var _ forgefs.StatsReporter = (*CardFetcher)(nil)
+
+// NewCardFetcher returns a new instance of CardFetcher.
+func NewCardFetcher() *CardFetcher {
+	return &CardFetcher{clientStats: clientStats{name: "card images"}}
+}
 
 // GetCardImage implements the forgefs.CardImageFetcher interface.
 func (cf *CardFetcher) GetCardImage(ctx context.Context, imageURL string) (
 	data []byte, err error) {
+	cf.start()
+	defer func() { cf.finish(imageURL, err) }()
+
 	req, err := http.NewRequestWithContext(ctx, "GET", imageURL, nil)
 	if err != nil {
 		return nil, err
@@ -21,26 +21,26 @@ const (
 // rate-limited to ensure compliance with the decksofkeyforge API
 // rules.
 type DoKAPI struct {
+	clientStats
 	baseURL string
 	apiKey  string
-	limiter *rate.Limiter
 }
 
 var _ forgefs.DataFetcher = (*DoKAPI)(nil)
+var _ forgefs.StatsReporter = (*DoKAPI)(nil)
 
 // NewDoKAPI returns a new instance using the given address and API key.
 func NewDoKAPI(addr, apiKey string) *DoKAPI {
 	return &DoKAPI{
+		clientStats: clientStats{
+			name:    "decksofkeyforge",
+			limiter: rate.NewLimiter(dokCallsPerSec, dokBurst),
+		},
 		baseURL: addr + "/public-api/",
 		apiKey:  apiKey,
-		limiter: rate.NewLimiter(dokCallsPerSec, dokBurst),
 	}
 }
 
-func (da *DoKAPI) wait(ctx context.Context) error {
-	return da.limiter.Wait(ctx)
-}
-
 // GetCards implements the forgefs.DataFetcher interface.
 func (da *DoKAPI) GetCards(ctx context.Context) (
 	cards []forgefs.Card, err error) {
@@ -48,6 +48,8 @@ func (da *DoKAPI) GetCards(ctx context.Context) (
 	if err != nil {
 		return nil, err
 	}
+	da.start()
+	defer func() { da.finish("v1/cards", err) }()
 
 	req, err := http.NewRequestWithContext(
 		ctx, "GET", da.baseURL+"v1/cards", nil)
@@ -87,6 +89,8 @@ func (da *DoKAPI) GetMyDecks(ctx context.Context) (
 	if err != nil {
 		return nil, err
 	}
+	da.start()
+	defer func() { da.finish("v1/my-decks", err) }()
 
 	req, err := http.NewRequestWithContext(
 		ctx, "GET", da.baseURL+"v1/my-decks", nil)
@@ -126,6 +130,8 @@ func (da *DoKAPI) GetDeck(ctx context.Context, id string, deck *forgefs.Deck) (
 	if err != nil {
 		return forgefs.Deck{}, err
 	}
+	da.start()
+	defer func() { da.finish("v3/decks/"+id, err) }()
 
 	req, err := http.NewRequestWithContext(
 		ctx, "GET", da.baseURL+"v3/decks/"+id, nil)
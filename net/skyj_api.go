@@ -13,11 +13,12 @@ import (
 // SkyJAPI enables fetching of deck list images from SkyJedi's TTS
 // server.  Requests are rate-limited to be nice.
 type SkyJAPI struct {
+	clientStats
 	baseURL string
-	limiter *rate.Limiter
 }
 
 var _ forgefs.DeckImageFetcher = (*SkyJAPI)(nil)
+var _ forgefs.StatsReporter = (*SkyJAPI)(nil)
 
 const (
 	skyjCallsPerSec     = 1
@@ -28,8 +29,11 @@ const (
 // NewSkyJAPI returns a new instance of SkyJAPI.
 func NewSkyJAPI(baseURL string) *SkyJAPI {
 	return &SkyJAPI{
+		clientStats: clientStats{
+			name:    "skyjedi",
+			limiter: rate.NewLimiter(skyjCallsPerSec, skyjBurst),
+		},
 		baseURL: baseURL,
-		limiter: rate.NewLimiter(skyjCallsPerSec, skyjBurst),
 	}
 }
 
@@ -41,10 +45,12 @@ func (sja *SkyJAPI) GetDeckImageSuffix() string {
 // GetDeckImage implements the forgefs.DeckImageFetcher interface.
 func (sja *SkyJAPI) GetDeckImage(ctx context.Context, deckID string) (
 	data []byte, err error) {
-	err = sja.limiter.Wait(ctx)
+	err = sja.wait(ctx)
 	if err != nil {
 		return nil, err
 	}
+	sja.start()
+	defer func() { sja.finish("deck-list "+deckID, err) }()
 
 	req, err := http.NewRequestWithContext(
 		ctx, "GET", sja.baseURL+"/?type=deck-list&deckId="+deckID, nil)
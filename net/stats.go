@@ -0,0 +1,94 @@
+package net
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/strib/forgefs"
+	"github.com/strib/forgefs/util"
+	"golang.org/x/time/rate"
+)
+
+// clientStats keeps track of a client's requests, so it can implement
+// the forgefs.StatsReporter interface.  The zero value is ready to
+// use, for a client without a name or a rate limiter.
+type clientStats struct {
+	name    string
+	limiter *rate.Limiter // nil if the client isn't rate-limited
+	errs    util.ErrorLog
+
+	mu          sync.Mutex
+	queued      int
+	inFlight    int
+	requests    int64
+	errors      int64
+	lastRequest time.Time
+}
+
+// wait blocks until the rate limiter allows another request.
+func (cs *clientStats) wait(ctx context.Context) error {
+	if cs.limiter == nil {
+		return nil
+	}
+	cs.mu.Lock()
+	cs.queued++
+	cs.mu.Unlock()
+	defer func() {
+		cs.mu.Lock()
+		cs.queued--
+		cs.mu.Unlock()
+	}()
+	return cs.limiter.Wait(ctx)
+}
+
+// start records the start of a request.  The caller must call
+// `finish` with the request's result once it's done.
+func (cs *clientStats) start() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.inFlight++
+	cs.requests++
+	cs.lastRequest = time.Now()
+}
+
+// finish records the result of a request to `path`.
+func (cs *clientStats) finish(path string, err error) {
+	cs.mu.Lock()
+	cs.inFlight--
+	if err != nil {
+		cs.errors++
+	}
+	cs.mu.Unlock()
+	if err != nil {
+		source := path
+		if cs.name != "" {
+			source = cs.name + " " + path
+		}
+		cs.errs.Add(source, err)
+	}
+}
+
+// ClientStats implements the forgefs.StatsReporter interface.
+func (cs *clientStats) ClientStats() forgefs.ClientStats {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	stats := forgefs.ClientStats{
+		Name:        cs.name,
+		Queued:      cs.queued,
+		InFlight:    cs.inFlight,
+		Requests:    cs.requests,
+		Errors:      cs.errors,
+		LastRequest: cs.lastRequest,
+	}
+	if cs.limiter != nil {
+		tokens := cs.limiter.Tokens()
+		stats.LimiterTokens = &tokens
+	}
+	return stats
+}
+
+// RecentErrors implements the forgefs.StatsReporter interface.
+func (cs *clientStats) RecentErrors() []forgefs.ErrorRecord {
+	return cs.errs.Recent()
+}
@@ -43,7 +43,8 @@ build_one_architecture() {
 
   # Build the client binary. Note that `go build` reads $GOARCH.
   echo "Building forgefs for $GOARCH..."
-  go build -o \
+  # The `sqlite_fts5` tag enables full-text card searches.
+  go build -tags sqlite_fts5 -o \
      "$layout_dir/usr/bin/forgefs" github.com/strib/forgefs/forgefs
 }
 
@@ -5,13 +5,15 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/strib/forgefs"
 )
 
 // DirImageCache stores image files for cards and decks into a single
 // on-disk directory, with each file named after the UUID of the
-// card/deck.
+// card/deck.  Card images from a specific expansion also include the
+// expansion in the name, like `<UUID>.MASS_MUTATION.png`.
 type DirImageCache struct {
 	cacheDir string
 }
@@ -47,32 +49,105 @@ func (dic *DirImageCache) getImage(
 	return nil, false, err
 }
 
+func (dic *DirImageCache) openImage(
+	ctx context.Context, prefix, fileType string) (
+	forgefs.ImageFile, int64, bool, error) {
+	cacheFile := filepath.Join(dic.cacheDir, prefix+"."+fileType)
+
+	f, err := os.Open(cacheFile)
+	if os.IsNotExist(err) {
+		return nil, 0, false, nil
+	} else if err != nil {
+		return nil, 0, false, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, 0, false, err
+	}
+	return f, fi.Size(), true, nil
+}
+
+func (dic *DirImageCache) getImageSize(
+	ctx context.Context, prefix, fileType string) (int64, bool, error) {
+	cacheFile := filepath.Join(dic.cacheDir, prefix+"."+fileType)
+
+	fi, err := os.Stat(cacheFile)
+	if err == nil {
+		return fi.Size(), true, nil
+	} else if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	return 0, false, err
+}
+
+func cardImagePrefix(cardID, expansion string) string {
+	if expansion == "" {
+		return cardID
+	}
+	return cardID + "." + expansion
+}
+
 // GetCardImage implements the forgefs.ImageCache interface.
 func (dic *DirImageCache) GetCardImage(
-	ctx context.Context, cardID, fileType string) ([]byte, bool, error) {
-	return dic.getImage(ctx, cardID, fileType)
+	ctx context.Context, cardID, expansion, fileType string) (
+	[]byte, bool, error) {
+	return dic.getImage(ctx, cardImagePrefix(cardID, expansion), fileType)
+}
+
+// GetCardImageSize implements the forgefs.ImageCache interface.
+func (dic *DirImageCache) GetCardImageSize(
+	ctx context.Context, cardID, expansion, fileType string) (
+	int64, bool, error) {
+	return dic.getImageSize(
+		ctx, cardImagePrefix(cardID, expansion), fileType)
+}
+
+// OpenCardImage implements the forgefs.ImageCache interface.
+func (dic *DirImageCache) OpenCardImage(
+	ctx context.Context, cardID, expansion, fileType string) (
+	forgefs.ImageFile, int64, bool, error) {
+	return dic.openImage(ctx, cardImagePrefix(cardID, expansion), fileType)
 }
 
 func (dic *DirImageCache) storeImage(
-	ctx context.Context, prefix, fileType string, data []byte) error {
+	ctx context.Context, prefix, fileType string, data []byte) (err error) {
 	cacheFile := filepath.Join(dic.cacheDir, prefix+"."+fileType)
-	f, err := os.OpenFile(cacheFile, os.O_CREATE|os.O_RDWR, 0644)
+
+	// Write to a temporary file first, so that any open handles
+	// streaming the old file never see a partial write.
+	f, err := os.CreateTemp(dic.cacheDir, ".tmp-"+prefix+"-*")
 	if err != nil {
 		return err
 	}
-	defer func() { _ = f.Close() }()
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
 	_, err = f.Write(data)
 	if err != nil {
 		return err
 	}
+	err = f.Chmod(0644)
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
 
-	return nil
+	return os.Rename(f.Name(), cacheFile)
 }
 
 // StoreCardImage implements the forgefs.ImageCache interface.
 func (dic *DirImageCache) StoreCardImage(
-	ctx context.Context, cardID, fileType string, data []byte) error {
-	return dic.storeImage(ctx, cardID, fileType, data)
+	ctx context.Context, cardID, expansion, fileType string,
+	data []byte) error {
+	return dic.storeImage(
+		ctx, cardImagePrefix(cardID, expansion), fileType, data)
 }
 
 // GetDeckImage implements the forgefs.ImageCache interface.
@@ -81,8 +156,40 @@ func (dic *DirImageCache) GetDeckImage(
 	return dic.getImage(ctx, deckID, fileType)
 }
 
+// GetDeckImageSize implements the forgefs.ImageCache interface.
+func (dic *DirImageCache) GetDeckImageSize(
+	ctx context.Context, deckID, fileType string) (int64, bool, error) {
+	return dic.getImageSize(ctx, deckID, fileType)
+}
+
+// OpenDeckImage implements the forgefs.ImageCache interface.
+func (dic *DirImageCache) OpenDeckImage(
+	ctx context.Context, deckID, fileType string) (
+	forgefs.ImageFile, int64, bool, error) {
+	return dic.openImage(ctx, deckID, fileType)
+}
+
 // StoreDeckImage implements the forgefs.ImageCache interface.
 func (dic *DirImageCache) StoreDeckImage(
 	ctx context.Context, deckID, fileType string, data []byte) error {
 	return dic.storeImage(ctx, deckID, fileType, data)
 }
+
+// Clear implements the forgefs.ImageCache interface.  Temporary files
+// are left alone, since they belong to images still being stored.
+func (dic *DirImageCache) Clear(ctx context.Context) error {
+	entries, err := os.ReadDir(dic.cacheDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".tmp-") {
+			continue
+		}
+		err = os.Remove(filepath.Join(dic.cacheDir, e.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirImageCacheOpen(t *testing.T) {
+	ctx := context.Background()
+	dic, err := NewDirImageCache(t.TempDir())
+	require.NoError(t, err)
+
+	_, _, ok, err := dic.OpenCardImage(ctx, "1", "", "png")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	err = dic.StoreCardImage(ctx, "1", "", "png", []byte("first"))
+	require.NoError(t, err)
+	f, size, ok, err := dic.OpenCardImage(ctx, "1", "", "png")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(5), size)
+
+	// Replacing a file doesn't disturb readers that already have it
+	// open.
+	err = dic.StoreCardImage(ctx, "1", "", "png", []byte("second"))
+	require.NoError(t, err)
+	data, err := io.ReadAll(io.NewSectionReader(f, 0, size))
+	require.NoError(t, err)
+	require.Equal(t, "first", string(data))
+	require.NoError(t, f.Close())
+
+	f, size, ok, err = dic.OpenCardImage(ctx, "1", "", "png")
+	require.NoError(t, err)
+	require.True(t, ok)
+	data, err = io.ReadAll(io.NewSectionReader(f, 0, size))
+	require.NoError(t, err)
+	require.Equal(t, "second", string(data))
+	require.NoError(t, f.Close())
+
+	// Expansion-specific and deck images are kept separately.
+	_, _, ok, err = dic.OpenCardImage(ctx, "1", "MASS_MUTATION", "png")
+	require.NoError(t, err)
+	require.False(t, ok)
+	err = dic.StoreDeckImage(ctx, "1", "jpg", []byte("deck"))
+	require.NoError(t, err)
+	f, size, ok, err = dic.OpenDeckImage(ctx, "1", "jpg")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, int64(4), size)
+	require.NoError(t, f.Close())
+}
+
+func TestDirImageCacheClear(t *testing.T) {
+	ctx := context.Background()
+	dic, err := NewDirImageCache(t.TempDir())
+	require.NoError(t, err)
+
+	err = dic.StoreCardImage(ctx, "1", "", "png", []byte("card"))
+	require.NoError(t, err)
+	err = dic.StoreDeckImage(ctx, "2", "jpg", []byte("deck"))
+	require.NoError(t, err)
+	f, _, ok, err := dic.OpenDeckImage(ctx, "2", "jpg")
+	require.NoError(t, err)
+	require.True(t, ok)
+	defer f.Close()
+
+	err = dic.Clear(ctx)
+	require.NoError(t, err)
+	_, ok, err = dic.GetCardImage(ctx, "1", "", "png")
+	require.NoError(t, err)
+	require.False(t, ok)
+	_, ok, err = dic.GetDeckImage(ctx, "2", "jpg")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// Open files are still readable.
+	buf := make([]byte, 4)
+	_, err = f.ReadAt(buf, 0)
+	require.NoError(t, err)
+	require.Equal(t, "deck", string(buf))
+}
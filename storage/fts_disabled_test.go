@@ -0,0 +1,6 @@
+//go:build !sqlite_fts5
+
+package storage
+
+// testFTS is true if the tests are built with FTS5 support.
+const testFTS = false
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/strib/forgefs"
+)
+
+// migration upgrades stored data from the previous data version to
+// `version`.  It runs in a transaction along with the version
+// update, so a failed migration leaves the data untouched.
+type migration struct {
+	version int
+	migrate func(ctx context.Context, tx *sql.Tx) error
+}
+
+// migrations upgrade existing databases to `sqlDataVersion`, in
+// order.  Deck details can take hours to re-fetch under the
+// decksofkeyforge rate limit, so migrations should keep the fetched
+// data whenever possible, e.g. by adding columns and backfilling
+// them from each row's stored JSON.  Dropping data so that it gets
+// re-fetched is a last resort, for when the stored JSON itself is
+// missing something.
+var migrations = []migration{
+	// Version 2: re-fetch cards to pick up their text, which was
+	// previously dropped due to a bad JSON tag.
+	{2, clearCards},
+	// Version 3: index card types, rarities and AERC scores.
+	{3, addCardSummaryColumns},
+	// Version 4: store each deck's houses, and every card copy with
+	// its position and flags, rather than just per-title counts.
+	{4, rebuildDeckCards},
+	// Version 5: index card titles.
+	{5, addCardsTitleIndex},
+}
+
+// The tables derived from the cards table are rebuilt from it
+// whenever they're missing.  The full-text index is left alone, since
+// it can only be touched by builds with FTS5, and it's rebuilt anyway
+// once it no longer matches the cards table.
+const sqlClearCards string = `
+    DELETE FROM cards;
+    DROP TABLE IF EXISTS card_images;
+`
+
+// clearCards deletes every card, so they're all re-fetched.
+func clearCards(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, sqlClearCards)
+	return err
+}
+
+const sqlAddCardSummaryColumns string = `
+    ALTER TABLE cards ADD COLUMN card_type varchar(64) NOT NULL DEFAULT '';
+    ALTER TABLE cards ADD COLUMN rarity varchar(64) NOT NULL DEFAULT '';
+    ALTER TABLE cards ADD COLUMN aerc real NOT NULL DEFAULT 0;
+`
+
+const sqlCardIDsAndJSON string = `
+    SELECT id, json FROM cards;
+`
+
+const sqlBackfillCardSummary string = `
+    UPDATE cards SET card_type=?, rarity=?, aerc=? WHERE id=?;
+`
+
+func addCardSummaryColumns(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, sqlAddCardSummaryColumns)
+	if err != nil {
+		return err
+	}
+
+	cards, err := getCardsInTx(ctx, tx)
+	if err != nil {
+		return err
+	}
+	for _, card := range cards {
+		_, err = tx.ExecContext(
+			ctx, sqlBackfillCardSummary, card.CardType, card.Rarity,
+			card.AERCScore, card.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The deck cards and houses are derived from the deck JSON, so
+// they're rebuilt from it with the new schema.
+const sqlDropDeckCards string = `
+    DROP TABLE IF EXISTS deck_cards;
+`
+
+func rebuildDeckCards(ctx context.Context, tx *sql.Tx) error {
+	for _, query := range []string{
+		sqlDropDeckCards,
+		sqlDeckHousesCreate,
+		sqlDeckHousesBackfill,
+		sqlDeckCardsCreate,
+		sqlDeckCardsBackfill,
+	} {
+		_, err := tx.ExecContext(ctx, query)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addCardsTitleIndex(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, sqlCardsTitleIndexCreate)
+	return err
+}
+
+// getCardsInTx decodes every stored card from its JSON.  The cards
+// are all read before returning, so the caller is free to update
+// them.
+func getCardsInTx(ctx context.Context, tx *sql.Tx) (
+	cards []forgefs.Card, err error) {
+	rows, err := tx.QueryContext(ctx, sqlCardIDsAndJSON)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := rows.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	for rows.Next() {
+		var id, cardJSON string
+		err = rows.Scan(&id, &cardJSON)
+		if err != nil {
+			return nil, err
+		}
+		var card forgefs.Card
+		err = json.Unmarshal([]byte(cardJSON), &card)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't decode card %s: %w", id, err)
+		}
+		card.ID = id
+		cards = append(cards, card)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return cards, nil
+}
+
+// migrate runs every migration newer than `currVersion`.
+func (s *SQLiteStorage) migrate(ctx context.Context, currVersion int) error {
+	for _, m := range migrations {
+		if m.version <= currVersion {
+			continue
+		}
+		err := s.runMigration(ctx, m)
+		if err != nil {
+			return fmt.Errorf(
+				"Couldn't migrate DB to version %d: %w", m.version, err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) runMigration(
+	ctx context.Context, m migration) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	err = m.migrate(ctx, tx)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, sqlWriteVersion, m.version)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/strib/forgefs"
+)
+
+// The schema of the cards, decks and deck cards tables as of data
+// version 2.
+const sqlTestV2Schema string = `
+    CREATE TABLE version (
+    version integer NOT NULL PRIMARY KEY
+);
+    CREATE TABLE cards (
+    id varchar(36) NOT NULL PRIMARY KEY,
+    title varchar(1024) NOT NULL,
+    house varchar(64) NOT NULL,
+    expansion varchar(64) NOT NULL,
+    image_url varchat(4096) NOT NULL,
+    version integer NOT NULL,
+    json blob NOT NULL
+);
+    CREATE TABLE deck_cards (
+    deck_id varchar(36) NOT NULL,
+    card_title varchar(1024) NOT NULL,
+    count integer NOT NULL,
+    PRIMARY KEY (deck_id, card_title)
+);
+    INSERT INTO deck_cards (deck_id, card_title, count)
+    VALUES ('2', 'Anger', 1);
+` + sqlDecksCreate
+
+// makeTestOldDB creates a DB file with the version 2 schema, claiming
+// to be at the given version, and holding one card and one deck.
+func makeTestOldDB(t *testing.T, version int, cardJSON string) string {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "test.sqlite")
+	db, err := sql.Open("sqlite3", file)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.ExecContext(ctx, sqlTestV2Schema)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, sqlWriteVersion, version)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `
+        INSERT INTO cards (id, title, house, expansion, image_url, version, json)
+        VALUES ('1', 'Anger', 'Brobnar', 'CALL_OF_THE_ARCHONS', 'anger.png', 1, ?);
+    `, cardJSON)
+	require.NoError(t, err)
+
+	deckJSON, err := json.Marshal(forgefs.Deck{
+		DeckInfo: forgefs.DeckInfo{
+			KeyforgeID: "2",
+			Name:       "deck1",
+			Houses: []forgefs.HouseInDeck{{
+				House: "Brobnar",
+				Cards: []forgefs.CardInDeck{{CardTitle: "Anger"}},
+			}},
+		},
+		OwnedByMe: true,
+	})
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, sqlDeckStore, "2", "deck1", "", 0, 0, 0,
+		0, 0, 0, 0, 0, 0, "Brobnar", "", "", time.Time{}, true, false,
+		false, deckJSON)
+	require.NoError(t, err)
+	return file
+}
+
+func TestMigrationsOrdered(t *testing.T) {
+	prev := 1
+	for _, m := range migrations {
+		require.Greater(t, m.version, prev)
+		prev = m.version
+	}
+	require.Equal(t, sqlDataVersion, prev)
+}
+
+func TestMigrateKeepsData(t *testing.T) {
+	ctx := context.Background()
+	file := makeTestOldDB(t, 2, `{"id":"1","cardTitle":"Anger",`+
+		`"house":"Brobnar","cardType":"Action","rarity":"Common",`+
+		`"aercScore":1.5}`)
+
+	s, err := NewSQLiteStorage(ctx, file)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = s.Shutdown() })
+
+	// The new columns are backfilled from the stored JSON.
+	summary, err := s.GetCardSummary(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, "Action", summary.Type)
+	require.Equal(t, "Common", summary.Rarity)
+	require.Equal(t, 1.5, summary.AERC)
+
+	// The fetched deck details survive.
+	deck, err := s.GetDeck(ctx, "2")
+	require.NoError(t, err)
+	require.Len(t, deck.DeckInfo.Houses, 1)
+	decks, err := s.GetDecksWithCard(ctx, "Anger")
+	require.NoError(t, err)
+	require.Len(t, decks, 1)
+	require.Equal(t, 1, decks[0].Count)
+	ds, err := s.GetDeckSummary(ctx, "2")
+	require.NoError(t, err)
+	require.Equal(t, []string{"Brobnar"}, ds.Houses)
+	titles, err := s.SearchCards(ctx, "anger")
+	require.NoError(t, err)
+	require.Equal(t, []string{"Anger"}, titles)
+
+	var version int
+	err = s.db.QueryRowContext(ctx, sqlVersion).Scan(&version)
+	require.NoError(t, err)
+	require.Equal(t, sqlDataVersion, version)
+
+	// Card titles are indexed.
+	var index string
+	err = s.db.QueryRowContext(ctx, `
+        SELECT name FROM sqlite_master
+        WHERE type = 'index' AND tbl_name = 'cards' AND name = 'cards_title';
+    `).Scan(&index)
+	require.NoError(t, err)
+}
+
+func TestMigrateRefetchesCards(t *testing.T) {
+	ctx := context.Background()
+	file := makeTestOldDB(t, 1, `{"id":"1","cardTitle":"Anger"}`)
+
+	s, err := NewSQLiteStorage(ctx, file)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = s.Shutdown() })
+
+	// Version 1 cards are missing their text, so they're dropped to
+	// be re-fetched, but the decks are kept.
+	count, err := s.GetCardsCount(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+	count, err = s.GetDecksCount(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+}
+
+func TestMigrateFailureKeepsOldData(t *testing.T) {
+	ctx := context.Background()
+	file := makeTestOldDB(t, 2, `not json`)
+
+	_, err := NewSQLiteStorage(ctx, file)
+	require.Error(t, err)
+
+	// The failed migration was rolled back.
+	db, err := sql.Open("sqlite3", file)
+	require.NoError(t, err)
+	defer db.Close()
+	var version int
+	err = db.QueryRowContext(ctx, sqlVersion).Scan(&version)
+	require.NoError(t, err)
+	require.Equal(t, 2, version)
+	_, err = db.ExecContext(ctx, "SELECT card_type FROM cards;")
+	require.Error(t, err)
+}
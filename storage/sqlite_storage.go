@@ -6,8 +6,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 
 	_ "github.com/mattn/go-sqlite3" // load sqlite driver
 	"github.com/strib/forgefs"
@@ -16,13 +19,21 @@ import (
 
 const (
 	// If the existing data version is lower than this, we should
-	// delete the DB on startup.   If it's larger, we should error.
-	sqlDataVersion = 1
+	// migrate the DB on startup (see `migrations`).  If it's larger,
+	// we should error.
+	sqlDataVersion = 5
 )
 
 // SQLiteStorage stores deck and card info in an on-disk SQLite file.
 type SQLiteStorage struct {
 	db *sql.DB
+	// fts is true if SQLite was built with FTS5 support (see the
+	// `sqlite_fts5` build tag), in which case card searches use a
+	// full-text index.
+	fts bool
+
+	observerLock sync.RWMutex
+	observer     forgefs.StorageObserver
 }
 
 var _ forgefs.Storage = (*SQLiteStorage)(nil)
@@ -46,6 +57,19 @@ func NewSQLiteStorage(
 	return s, nil
 }
 
+// SetObserver implements the forgefs.Storage interface.
+func (s *SQLiteStorage) SetObserver(o forgefs.StorageObserver) {
+	s.observerLock.Lock()
+	defer s.observerLock.Unlock()
+	s.observer = o
+}
+
+func (s *SQLiteStorage) getObserver() forgefs.StorageObserver {
+	s.observerLock.RLock()
+	defer s.observerLock.RUnlock()
+	return s.observer
+}
+
 // Shutdown shuts down the storage instance.
 func (s *SQLiteStorage) Shutdown() error {
 	return s.db.Close()
@@ -62,11 +86,22 @@ const sqlCardsCreate string = `
     title varchar(1024) NOT NULL,
     house varchar(64) NOT NULL,
     expansion varchar(64) NOT NULL,
+    card_type varchar(64) NOT NULL,
+    rarity varchar(64) NOT NULL,
+    aerc real NOT NULL,
     image_url varchat(4096) NOT NULL,
     version integer NOT NULL,
     json blob NOT NULL
-);`
+);
+` + sqlCardsTitleIndexCreate
+
+// Cards are looked up by title for every card in a deck.
+const sqlCardsTitleIndexCreate string = `
+    CREATE INDEX IF NOT EXISTS cards_title ON cards (title);
+`
 
+// The house columns are only filled in for decks with exactly three
+// houses; queries should use the deck_houses table instead.
 const sqlDecksCreate string = `
     CREATE TABLE IF NOT EXISTS decks (
     id varchar(36) NOT NULL PRIMARY KEY,
@@ -91,6 +126,167 @@ const sqlDecksCreate string = `
     json blob NOT NULL
 );`
 
+// The houses of each deck, in order, derived from the deck JSON.
+// Unlike the legacy house columns of the decks table, these are
+// filled in whenever the deck's houses are known.
+const sqlDeckHousesCreate string = `
+    CREATE TABLE IF NOT EXISTS deck_houses (
+    deck_id varchar(36) NOT NULL,
+    position integer NOT NULL,
+    house varchar(64) NOT NULL,
+    PRIMARY KEY (deck_id, position)
+);
+    CREATE INDEX IF NOT EXISTS deck_houses_house ON deck_houses (house);
+`
+
+// Fill in the deck houses from any decks stored before the table
+// existed.
+const sqlDeckHousesBackfill string = `
+    INSERT INTO deck_houses (deck_id, position, house)
+    SELECT decks.id, h.key, COALESCE(json_extract(h.value, '$.house'), '')
+    FROM decks, json_each(decks.json, '$.deck.housesAndCards') AS h
+    WHERE NOT EXISTS (SELECT 1 FROM deck_houses);
+`
+
+// The cards in each deck, one row per copy, derived from the deck
+// JSON so that decks can be looked up and filtered by card.
+// `position` is the card's index in the whole deck list.
+const sqlDeckCardsCreate string = `
+    CREATE TABLE IF NOT EXISTS deck_cards (
+    deck_id varchar(36) NOT NULL,
+    position integer NOT NULL,
+    house varchar(64) NOT NULL,
+    card_title varchar(1024) NOT NULL,
+    rarity varchar(64) NOT NULL,
+    maverick boolean NOT NULL,
+    legacy boolean NOT NULL,
+    anomaly boolean NOT NULL,
+    PRIMARY KEY (deck_id, position)
+);
+    CREATE INDEX IF NOT EXISTS deck_cards_title
+        ON deck_cards (card_title, deck_id);
+`
+
+// Fill in the deck cards from any decks stored before the table
+// existed.
+const sqlDeckCardsBackfill string = `
+    INSERT INTO deck_cards (
+        deck_id, position, house, card_title, rarity, maverick, legacy,
+        anomaly
+    )
+    SELECT decks.id,
+        ROW_NUMBER() OVER (PARTITION BY decks.id ORDER BY h.key, c.key) - 1,
+        COALESCE(json_extract(h.value, '$.house'), ''),
+        COALESCE(json_extract(c.value, '$.cardTitle'), ''),
+        COALESCE(json_extract(c.value, '$.rarity'), ''),
+        COALESCE(json_extract(c.value, '$.maverick'), 0),
+        COALESCE(json_extract(c.value, '$.legacy'), 0),
+        COALESCE(json_extract(c.value, '$.anomaly'), 0)
+    FROM decks,
+        json_each(decks.json, '$.deck.housesAndCards') AS h,
+        json_each(h.value, '$.cards') AS c
+    WHERE NOT EXISTS (SELECT 1 FROM deck_cards);
+`
+
+// The image URL of each printing of a card, since reprints in
+// different expansions can have different art.
+const sqlCardImagesCreate string = `
+    CREATE TABLE IF NOT EXISTS card_images (
+    title varchar(1024) NOT NULL,
+    expansion varchar(64) NOT NULL,
+    image_url varchar(4096) NOT NULL,
+    PRIMARY KEY (title, expansion)
+);`
+
+// Fill in the card images from any cards stored before the table
+// existed.
+const sqlCardImagesBackfill string = `
+    INSERT OR IGNORE INTO card_images (title, expansion, image_url)
+    SELECT title, expansion, image_url FROM cards
+    WHERE expansion != '' AND image_url != ''
+        AND NOT EXISTS (SELECT 1 FROM card_images);
+`
+
+// sqlFTSAvailable reports whether this build of SQLite includes FTS5.
+// The cards_fts table must not be touched otherwise, even if it
+// exists, since it was created by a build that did.
+const sqlFTSAvailable string = `
+    SELECT sqlite_compileoption_used('ENABLE_FTS5');
+`
+
+// The full-text index of the card catalog.  It's derived from the
+// cards table, so it's dropped along with it.
+const sqlCardsFTSCreate string = `
+    CREATE VIRTUAL TABLE IF NOT EXISTS cards_fts USING fts5(
+    id UNINDEXED,
+    title,
+    text,
+    flavor,
+    traits
+);`
+
+// The full-text index isn't updated when cards are stored by a build
+// without FTS5, so those builds leave a row here to say the index
+// must be rebuilt.  Like the notes, it survives resets, since the
+// index may still be stale afterward.
+const sqlCardsFTSStaleCreate string = `
+    CREATE TABLE IF NOT EXISTS cards_fts_stale (
+    id integer NOT NULL PRIMARY KEY CHECK (id = 1)
+);`
+
+const sqlCardsFTSMarkStale string = `
+    INSERT OR IGNORE INTO cards_fts_stale (id) VALUES (1);
+`
+
+// Rebuild the full-text index if it's stale, or if it doesn't cover
+// the same cards as the cards table (e.g., cards stored before it
+// existed).
+const sqlCardsFTSBackfill string = `
+    DELETE FROM cards_fts
+    WHERE EXISTS (SELECT 1 FROM cards_fts_stale)
+        OR (SELECT COUNT(*) FROM cards_fts) != (SELECT COUNT(*) FROM cards);
+    INSERT INTO cards_fts (id, title, text, flavor, traits)
+    SELECT id, title,
+        COALESCE(json_extract(json, '$.cardText'), ''),
+        COALESCE(json_extract(json, '$.flavorText'), ''),
+        COALESCE((
+            SELECT group_concat(value, ' ')
+            FROM json_each(cards.json, '$.traits')), '')
+    FROM cards
+    WHERE NOT EXISTS (SELECT 1 FROM cards_fts);
+    DELETE FROM cards_fts_stale;
+`
+
+// Local deck notes aren't dropped on version upgrades or resets, since
+// they can't be re-fetched.
+const sqlDeckNotesCreate string = `
+    CREATE TABLE IF NOT EXISTS deck_notes (
+    id varchar(36) NOT NULL PRIMARY KEY,
+    notes text NOT NULL
+);`
+
+// Tags are user-defined, so like notes they survive upgrades and
+// resets.
+const sqlTagsCreate string = `
+    CREATE TABLE IF NOT EXISTS tags (
+    name varchar(256) NOT NULL PRIMARY KEY
+);`
+
+const sqlDeckTagsCreate string = `
+    CREATE TABLE IF NOT EXISTS deck_tags (
+    tag varchar(256) NOT NULL,
+    deck_id varchar(36) NOT NULL,
+    PRIMARY KEY (tag, deck_id)
+);`
+
+// Sync times describe the fetched data, so they're dropped along with
+// it.
+const sqlSyncTimesCreate string = `
+    CREATE TABLE IF NOT EXISTS sync_times (
+    kind varchar(32) NOT NULL PRIMARY KEY,
+    time timestamp NOT NULL
+);`
+
 const sqlVersion string = `
     SELECT COALESCE(MAX(version), 0) FROM version;
 `
@@ -98,6 +294,14 @@ const sqlVersion string = `
 const sqlDropTables string = `
     DROP TABLE IF EXISTS decks;
     DROP TABLE IF EXISTS cards;
+    DROP TABLE IF EXISTS deck_houses;
+    DROP TABLE IF EXISTS deck_cards;
+    DROP TABLE IF EXISTS card_images;
+    DROP TABLE IF EXISTS sync_times;
+`
+
+const sqlDropFTSTable string = `
+    DROP TABLE IF EXISTS cards_fts;
 `
 
 const sqlWriteVersion string = `
@@ -105,7 +309,14 @@ const sqlWriteVersion string = `
 `
 
 func (s *SQLiteStorage) init(ctx context.Context) error {
-	_, err := s.db.ExecContext(ctx, sqlVersionCreate)
+	// Built without FTS5, card searches fall back to slower
+	// queries.
+	err := s.db.QueryRowContext(ctx, sqlFTSAvailable).Scan(&s.fts)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, sqlVersionCreate)
 	if err != nil {
 		return err
 	}
@@ -117,15 +328,15 @@ func (s *SQLiteStorage) init(ctx context.Context) error {
 		return err
 	}
 	switch {
-	case currVersion < sqlDataVersion:
-		// Drop all tables.
-		_, err := s.db.ExecContext(ctx, sqlDropTables)
+	case currVersion == 0:
+		// A new DB, so the tables are created below with the latest
+		// schema.
+		_, err := s.db.ExecContext(ctx, sqlWriteVersion, sqlDataVersion)
 		if err != nil {
 			return err
 		}
-		fallthrough
-	case currVersion == 0:
-		_, err := s.db.ExecContext(ctx, sqlWriteVersion, sqlDataVersion)
+	case currVersion < sqlDataVersion:
+		err := s.migrate(ctx, currVersion)
 		if err != nil {
 			return err
 		}
@@ -147,6 +358,72 @@ func (s *SQLiteStorage) init(ctx context.Context) error {
 		return err
 	}
 
+	_, err = s.db.ExecContext(ctx, sqlDeckHousesCreate)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, sqlDeckHousesBackfill)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, sqlDeckCardsCreate)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, sqlDeckCardsBackfill)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, sqlCardImagesCreate)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, sqlCardImagesBackfill)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, sqlCardsFTSStaleCreate)
+	if err != nil {
+		return err
+	}
+
+	if s.fts {
+		_, err = s.db.ExecContext(ctx, sqlCardsFTSCreate)
+		if err != nil {
+			return err
+		}
+		_, err = s.db.ExecContext(ctx, sqlCardsFTSBackfill)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = s.db.ExecContext(ctx, sqlDeckNotesCreate)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, sqlTagsCreate)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, sqlDeckTagsCreate)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, sqlSyncTimesCreate)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -166,13 +443,21 @@ func (s *SQLiteStorage) GetCardsCount(ctx context.Context) (
 }
 
 const sqlCardStore string = `
-    INSERT OR IGNORE INTO cards (id, title, house, expansion, image_url, version, json)
-    VALUES (?, ?, ?, ?, ?, ?, ?);
+    INSERT OR REPLACE INTO cards (
+        id, title, house, expansion, card_type, rarity, aerc, image_url,
+        version, json
+    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
 `
 
 // StoreCards implements the forgefs.Storage interface.
 func (s *SQLiteStorage) StoreCards(
 	ctx context.Context, cards []forgefs.Card) error {
+	if !s.fts && len(cards) > 0 {
+		_, err := s.db.ExecContext(ctx, sqlCardsFTSMarkStale)
+		if err != nil {
+			return err
+		}
+	}
 	for _, card := range cards {
 		j, err := json.Marshal(card)
 		if err != nil {
@@ -182,7 +467,8 @@ func (s *SQLiteStorage) StoreCards(
 		result, err := s.db.ExecContext(
 			ctx, sqlCardStore,
 			card.ID, card.CardTitle, card.House, card.ExpansionEnum,
-			card.FrontImage, card.ExtraCardInfo.Version, j)
+			card.CardType, card.Rarity, card.AERCScore, card.FrontImage,
+			card.ExtraCardInfo.Version, j)
 		if err != nil {
 			return err
 		}
@@ -195,10 +481,141 @@ func (s *SQLiteStorage) StoreCards(
 		if rowsAffected != 1 {
 			return errors.New("card not inserted")
 		}
+
+		if card.ExpansionEnum != "" && card.FrontImage != "" {
+			_, err = s.db.ExecContext(
+				ctx, sqlCardImageStore, card.CardTitle, card.ExpansionEnum,
+				card.FrontImage)
+			if err != nil {
+				return err
+			}
+		}
+
+		if s.fts {
+			// Replace any previously-indexed version of the card.
+			_, err = s.db.ExecContext(ctx, sqlCardFTSDelete, card.ID)
+			if err != nil {
+				return err
+			}
+			_, err = s.db.ExecContext(
+				ctx, sqlCardFTSStore, card.ID, card.CardTitle,
+				card.CardText, card.FlavorText,
+				strings.Join(card.Traits, " "))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if o := s.getObserver(); o != nil {
+		o.CardsUpdated(ctx, cards)
 	}
 	return nil
 }
 
+// searchTerms splits a search query into terms, dropping any
+// punctuation so that user input can't be mistaken for query syntax.
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\''
+	})
+}
+
+// Columns are weighted so that title matches rank highest, then
+// traits, text and flavor text.
+const sqlCardSearchFTS string = `
+    SELECT title FROM cards_fts
+    WHERE cards_fts MATCH ?
+    ORDER BY bm25(cards_fts, 0, 10.0, 1.0, 0.5, 2.0), title;
+`
+
+// Without a full-text index, cards must match each term somewhere,
+// and cards matching every term in their title rank above the rest.
+const sqlCardSearchFallbackPrefix string = `
+    SELECT title FROM cards
+    WHERE `
+
+const sqlCardSearchFallbackTerm string = `(
+    title LIKE ? OR
+    json_extract(json, '$.cardText') LIKE ? OR
+    json_extract(json, '$.flavorText') LIKE ? OR
+    json_extract(json, '$.traits') LIKE ?)`
+
+// SearchCards implements the forgefs.Storage interface.
+func (s *SQLiteStorage) SearchCards(ctx context.Context, query string) (
+	titles []string, err error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	var rows *sql.Rows
+	if s.fts {
+		quoted := make([]string, len(terms))
+		for i, term := range terms {
+			quoted[i] = `"` + term + `"`
+		}
+		rows, err = s.db.QueryContext(
+			ctx, sqlCardSearchFTS, strings.Join(quoted, " "))
+	} else {
+		conds := make([]string, len(terms))
+		titleConds := make([]string, len(terms))
+		var args, titleArgs []interface{}
+		for i, term := range terms {
+			like := "%" + term + "%"
+			conds[i] = sqlCardSearchFallbackTerm
+			args = append(args, like, like, like, like)
+			titleConds[i] = "title LIKE ?"
+			titleArgs = append(titleArgs, like)
+		}
+		rows, err = s.db.QueryContext(
+			ctx, sqlCardSearchFallbackPrefix+strings.Join(conds, " AND ")+
+				" ORDER BY ("+strings.Join(titleConds, " AND ")+") DESC, title",
+			append(args, titleArgs...)...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := rows.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var title string
+		err = rows.Scan(&title)
+		if err != nil {
+			return nil, err
+		}
+		// Reprints share a title, so only keep the best match.
+		if seen[title] {
+			continue
+		}
+		seen[title] = true
+		titles = append(titles, title)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return titles, nil
+}
+
+const sqlCardImageStore string = `
+    INSERT OR IGNORE INTO card_images (title, expansion, image_url)
+    VALUES (?, ?, ?);
+`
+
+const sqlCardFTSStore string = `
+    INSERT INTO cards_fts (id, title, text, flavor, traits)
+    VALUES (?, ?, ?, ?, ?);
+`
+
+const sqlCardFTSDelete string = `
+    DELETE FROM cards_fts WHERE id=?;
+`
+
 const sqlCardNames string = `
     SELECT id, title FROM cards;
 `
@@ -248,6 +665,40 @@ func (s *SQLiteStorage) GetCardImageURL(ctx context.Context, id string) (
 	return url, nil
 }
 
+const sqlCardImageURLs string = `
+    SELECT expansion, image_url FROM card_images
+    WHERE title=?;
+`
+
+// GetCardImageURLs implements the forgefs.Storage interface.
+func (s *SQLiteStorage) GetCardImageURLs(
+	ctx context.Context, title string) (urls map[string]string, err error) {
+	urls = make(map[string]string)
+	rows, err := s.db.QueryContext(ctx, sqlCardImageURLs, title)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := rows.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	for rows.Next() {
+		var expansion, url string
+		err = rows.Scan(&expansion, &url)
+		if err != nil {
+			return nil, err
+		}
+		urls[expansion] = url
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return urls, nil
+}
+
 const sqlCardJSON string = `
     SELECT json FROM cards
     WHERE id=?;
@@ -260,7 +711,7 @@ func (s *SQLiteStorage) GetCard(ctx context.Context, id string) (
 	var cardJSON string
 	err = row.Scan(&cardJSON)
 	if err != nil {
-		return nil, err
+		return nil, rowErr(err)
 	}
 	var c forgefs.Card
 	err = json.Unmarshal([]byte(cardJSON), &c)
@@ -270,86 +721,58 @@ func (s *SQLiteStorage) GetCard(ctx context.Context, id string) (
 	return &c, nil
 }
 
-const sqlDecksCount string = `
-    SELECT COUNT(*) FROM decks;
+const sqlCardSummary string = `
+    SELECT house, card_type, rarity, expansion, aerc FROM cards
+    WHERE id=?;
 `
 
-// GetDecksCount returns the number of stored decks.
-func (s *SQLiteStorage) GetDecksCount(ctx context.Context) (
-	count int, err error) {
-	row := s.db.QueryRowContext(ctx, sqlDecksCount)
-	err = row.Scan(&count)
+// GetCardSummary implements the forgefs.Storage interface.
+func (s *SQLiteStorage) GetCardSummary(ctx context.Context, id string) (
+	summary *forgefs.CardSummary, err error) {
+	row := s.db.QueryRowContext(ctx, sqlCardSummary, id)
+	var cs forgefs.CardSummary
+	err = row.Scan(&cs.House, &cs.Type, &cs.Rarity, &cs.Expansion, &cs.AERC)
 	if err != nil {
-		return 0, err
+		return nil, rowErr(err)
 	}
-	return count, nil
+	return &cs, nil
 }
 
-const sqlDeckStore string = `
-    INSERT OR REPLACE INTO decks (
-        id, name, expansion, sas, sas_version, aerc, a, e, r, c, f, d,
-        house1, house2, house3, date_added, owned_by_me, funny, wish_list, json
-    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+const sqlCardJSONByTitle string = `
+    SELECT json FROM cards
+    WHERE title=?
+    LIMIT 1;
 `
 
-// StoreDecks implements the forgefs.Storage interface.
-func (s *SQLiteStorage) StoreDecks(
-	ctx context.Context, decks []forgefs.Deck) error {
-	for _, deck := range decks {
-		j, err := json.Marshal(deck)
-		if err != nil {
-			return err
-		}
-
-		info := deck.DeckInfo
-		var house1, house2, house3 string
-		if len(info.Houses) == 3 {
-			house1 = info.Houses[0].House
-			house2 = info.Houses[1].House
-			house3 = info.Houses[2].House
-		}
-
-		var dateAdded time.Time
-		if info.DateAdded != "" {
-			dateAdded, err = time.Parse("2006-01-02", info.DateAdded)
-			if err != nil {
-				return err
-			}
-		}
-		result, err := s.db.ExecContext(
-			ctx, sqlDeckStore, info.KeyforgeID, info.Name, info.Expansion,
-			info.SasRating, deck.SASVersion, info.AercScore,
-			info.AmberControl, info.ExpectedAmber, info.ArtifactControl,
-			info.CreatureControl, info.Efficiency, info.Disruption,
-			house1, house2, house3, dateAdded, deck.OwnedByMe, deck.Funny,
-			deck.Wishlist,
-			j)
-		if err != nil {
-			return err
-		}
-
-		rowsAffected, err := result.RowsAffected()
-		if err != nil {
-			return err
-		}
-
-		if rowsAffected != 1 {
-			return errors.New("deck not inserted")
-		}
+// GetCardByTitle implements the forgefs.Storage interface.
+func (s *SQLiteStorage) GetCardByTitle(ctx context.Context, title string) (
+	card *forgefs.Card, err error) {
+	row := s.db.QueryRowContext(ctx, sqlCardJSONByTitle, title)
+	var cardJSON string
+	err = row.Scan(&cardJSON)
+	if err != nil {
+		return nil, rowErr(err)
 	}
-	return nil
+	var c forgefs.Card
+	err = json.Unmarshal([]byte(cardJSON), &c)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
 }
 
-const sqlMyDeckMD string = `
-    SELECT id, name, date_added FROM decks
-    WHERE owned_by_me = 1;
+const sqlCardNumbers string = `
+    SELECT cards.id,
+        COALESCE(json_extract(n.value, '$.expansion'), ''),
+        COALESCE(json_extract(n.value, '$.cardNumber'), '')
+    FROM cards, json_each(cards.json, '$.cardNumbers') AS n;
 `
 
-// GetMyDeckMetadata implements the forgefs.Storage interface.
-func (s *SQLiteStorage) GetMyDeckMetadata(ctx context.Context) (
-	mds map[string]forgefs.DeckMetadata, err error) {
-	mds = make(map[string]forgefs.DeckMetadata)
-	rows, err := s.db.QueryContext(ctx, sqlMyDeckMD)
+// GetCardNumbers implements the forgefs.Storage interface.
+func (s *SQLiteStorage) GetCardNumbers(ctx context.Context) (
+	numbers map[string][]forgefs.CardNumber, err error) {
+	numbers = make(map[string][]forgefs.CardNumber)
+	rows, err := s.db.QueryContext(ctx, sqlCardNumbers)
 	if err != nil {
 		return nil, err
 	}
@@ -360,28 +783,379 @@ func (s *SQLiteStorage) GetMyDeckMetadata(ctx context.Context) (
 		}
 	}()
 	for rows.Next() {
-		var id, name string
-		var dateAdded time.Time
-		err = rows.Scan(&id, &name, &dateAdded)
+		var id string
+		var number forgefs.CardNumber
+		err = rows.Scan(&id, &number.Expansion, &number.CardNumber)
 		if err != nil {
 			return nil, err
 		}
-		mds[id] = forgefs.DeckMetadata{
-			ID:        id,
-			Name:      name,
-			DateAdded: dateAdded,
-		}
+		numbers[id] = append(numbers[id], number)
 	}
 	if rows.Err() != nil {
 		return nil, rows.Err()
 	}
 
-	return mds, nil
+	return numbers, nil
 }
 
-func normalizeExpansion(s string) string {
-	switch strings.ToLower(s) {
-	case "cota":
+// Traits and synergies only live in the card JSON, as DoK's synergy
+// model for each card.
+const sqlTraits string = `
+    SELECT DISTINCT json_extract(t.value, '$.trait') AS trait
+    FROM cards, json_each(cards.json, '$.extraCardInfo.traits') AS t
+    WHERE trait IS NOT NULL AND trait != ''
+    UNION
+    SELECT DISTINCT json_extract(t.value, '$.trait') AS trait
+    FROM cards, json_each(cards.json, '$.extraCardInfo.synergies') AS t
+    WHERE trait IS NOT NULL AND trait != ''
+    ORDER BY trait;
+`
+
+// GetTraits implements the forgefs.Storage interface.
+func (s *SQLiteStorage) GetTraits(ctx context.Context) (
+	traits []string, err error) {
+	rows, err := s.db.QueryContext(ctx, sqlTraits)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := rows.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	for rows.Next() {
+		var trait string
+		err = rows.Scan(&trait)
+		if err != nil {
+			return nil, err
+		}
+		traits = append(traits, trait)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return traits, nil
+}
+
+const sqlCardsWithTraitPrefix string = `
+    SELECT DISTINCT title
+    FROM cards, json_each(cards.json, '$.extraCardInfo.`
+
+const sqlCardsWithTraitSuffix string = `') AS t
+    WHERE json_extract(t.value, '$.trait') = ?
+    ORDER BY title;
+`
+
+func (s *SQLiteStorage) getCardsWithTrait(
+	ctx context.Context, field, trait string) (titles []string, err error) {
+	rows, err := s.db.QueryContext(
+		ctx, sqlCardsWithTraitPrefix+field+sqlCardsWithTraitSuffix, trait)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := rows.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	for rows.Next() {
+		var title string
+		err = rows.Scan(&title)
+		if err != nil {
+			return nil, err
+		}
+		titles = append(titles, title)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return titles, nil
+}
+
+// GetCardsWithTrait implements the forgefs.Storage interface.
+func (s *SQLiteStorage) GetCardsWithTrait(
+	ctx context.Context, trait string) (
+	providers, synergies []string, err error) {
+	providers, err = s.getCardsWithTrait(ctx, "traits", trait)
+	if err != nil {
+		return nil, nil, err
+	}
+	synergies, err = s.getCardsWithTrait(ctx, "synergies", trait)
+	if err != nil {
+		return nil, nil, err
+	}
+	return providers, synergies, nil
+}
+
+const sqlDecksCount string = `
+    SELECT COUNT(*) FROM decks;
+`
+
+// GetDecksCount returns the number of stored decks.
+func (s *SQLiteStorage) GetDecksCount(ctx context.Context) (
+	count int, err error) {
+	row := s.db.QueryRowContext(ctx, sqlDecksCount)
+	err = row.Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+const sqlDeckStore string = `
+    INSERT OR REPLACE INTO decks (
+        id, name, expansion, sas, sas_version, aerc, a, e, r, c, f, d,
+        house1, house2, house3, date_added, owned_by_me, funny, wish_list, json
+    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+`
+
+// deckStmts holds the statements used to store decks, prepared once
+// per StoreDecks transaction.
+type deckStmts struct {
+	deck, deleteHouses, house, deleteCards, card *sql.Stmt
+}
+
+func prepareDeckStmts(ctx context.Context, tx *sql.Tx) (
+	stmts *deckStmts, err error) {
+	stmts = &deckStmts{}
+	for _, p := range []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&stmts.deck, sqlDeckStore},
+		{&stmts.deleteHouses, sqlDeckHousesDelete},
+		{&stmts.house, sqlDeckHouseStore},
+		{&stmts.deleteCards, sqlDeckCardsDelete},
+		{&stmts.card, sqlDeckCardStore},
+	} {
+		*p.stmt, err = tx.PrepareContext(ctx, p.query)
+		if err != nil {
+			stmts.close()
+			return nil, err
+		}
+	}
+	return stmts, nil
+}
+
+func (ds *deckStmts) close() {
+	for _, stmt := range []*sql.Stmt{
+		ds.deck, ds.deleteHouses, ds.house, ds.deleteCards, ds.card,
+	} {
+		if stmt != nil {
+			_ = stmt.Close()
+		}
+	}
+}
+
+// StoreDecks implements the forgefs.Storage interface.  All the decks
+// are stored in one transaction, so a deck's details and its houses
+// and cards are never out of sync.
+func (s *SQLiteStorage) StoreDecks(
+	ctx context.Context, decks []forgefs.Deck) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	stmts, err := prepareDeckStmts(ctx, tx)
+	if err != nil {
+		return err
+	}
+	defer stmts.close()
+
+	for _, deck := range decks {
+		err = storeDeck(ctx, stmts, deck)
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	if o := s.getObserver(); o != nil {
+		o.DecksUpdated(ctx, decks)
+	}
+	return nil
+}
+
+func storeDeck(ctx context.Context, stmts *deckStmts, deck forgefs.Deck) error {
+	j, err := json.Marshal(deck)
+	if err != nil {
+		return err
+	}
+
+	info := deck.DeckInfo
+	var house1, house2, house3 string
+	if len(info.Houses) == 3 {
+		house1 = info.Houses[0].House
+		house2 = info.Houses[1].House
+		house3 = info.Houses[2].House
+	}
+
+	var dateAdded time.Time
+	if info.DateAdded != "" {
+		dateAdded, err = time.Parse("2006-01-02", info.DateAdded)
+		if err != nil {
+			return err
+		}
+	}
+	result, err := stmts.deck.ExecContext(
+		ctx, info.KeyforgeID, info.Name, info.Expansion,
+		info.SasRating, deck.SASVersion, info.AercScore,
+		info.AmberControl, info.ExpectedAmber, info.ArtifactControl,
+		info.CreatureControl, info.Efficiency, info.Disruption,
+		house1, house2, house3, dateAdded, deck.OwnedByMe, deck.Funny,
+		deck.Wishlist,
+		j)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected != 1 {
+		return errors.New("deck not inserted")
+	}
+
+	return storeDeckHousesAndCards(ctx, stmts, deck)
+}
+
+const sqlDeckHousesDelete string = `
+    DELETE FROM deck_houses WHERE deck_id=?;
+`
+
+const sqlDeckHouseStore string = `
+    INSERT INTO deck_houses (deck_id, position, house) VALUES (?, ?, ?);
+`
+
+const sqlDeckCardsDelete string = `
+    DELETE FROM deck_cards WHERE deck_id=?;
+`
+
+const sqlDeckCardStore string = `
+    INSERT INTO deck_cards (
+        deck_id, position, house, card_title, rarity, maverick, legacy,
+        anomaly
+    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+`
+
+// storeDeckHousesAndCards replaces the stored houses and cards for
+// the given deck.
+func storeDeckHousesAndCards(
+	ctx context.Context, stmts *deckStmts, deck forgefs.Deck) error {
+	info := deck.DeckInfo
+	_, err := stmts.deleteHouses.ExecContext(ctx, info.KeyforgeID)
+	if err != nil {
+		return err
+	}
+	_, err = stmts.deleteCards.ExecContext(ctx, info.KeyforgeID)
+	if err != nil {
+		return err
+	}
+
+	position := 0
+	for i, house := range info.Houses {
+		_, err = stmts.house.ExecContext(ctx, info.KeyforgeID, i, house.House)
+		if err != nil {
+			return err
+		}
+		for _, c := range house.Cards {
+			_, err = stmts.card.ExecContext(
+				ctx, info.KeyforgeID, position, house.House, c.CardTitle,
+				c.Rarity, c.Maverick, c.Legacy, c.Anomaly)
+			if err != nil {
+				return err
+			}
+			position++
+		}
+	}
+	return nil
+}
+
+// rowErr converts a missing row into forgefs.ErrNotFound, so callers
+// don't depend on the SQL backend.
+func rowErr(err error) error {
+	if err == sql.ErrNoRows {
+		return forgefs.ErrNotFound
+	}
+	return err
+}
+
+// deckListColumn returns the decks column flagging membership in the
+// given list.
+func deckListColumn(list forgefs.DeckList) (string, error) {
+	switch list {
+	case forgefs.DeckListMine:
+		return "owned_by_me", nil
+	case forgefs.DeckListWishlist:
+		return "wish_list", nil
+	case forgefs.DeckListFunny:
+		return "funny", nil
+	default:
+		return "", fmt.Errorf("unrecognized deck list: %d", list)
+	}
+}
+
+const sqlDeckListMDPrefix string = `
+    SELECT id, name, date_added FROM decks
+    WHERE `
+
+// GetDeckMetadata implements the forgefs.Storage interface.
+func (s *SQLiteStorage) GetDeckMetadata(
+	ctx context.Context, list forgefs.DeckList) (
+	mds map[string]forgefs.DeckMetadata, err error) {
+	col, err := deckListColumn(list)
+	if err != nil {
+		return nil, err
+	}
+
+	mds = make(map[string]forgefs.DeckMetadata)
+	rows, err := s.db.QueryContext(ctx, sqlDeckListMDPrefix+col+" = 1")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := rows.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	for rows.Next() {
+		var id, name string
+		var dateAdded time.Time
+		err = rows.Scan(&id, &name, &dateAdded)
+		if err != nil {
+			return nil, err
+		}
+		mds[id] = forgefs.DeckMetadata{
+			ID:        id,
+			Name:      name,
+			DateAdded: dateAdded,
+		}
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return mds, nil
+}
+
+func normalizeExpansion(s string) string {
+	switch strings.ToLower(s) {
+	case "cota":
 		return "CALL_OF_THE_ARCHONS"
 	case "aoa":
 		return "AGE_OF_ASCENSION"
@@ -448,6 +1222,9 @@ func filterNodeToSQLConstraint(n *filter.Node) (string, error) {
 		case filter.House:
 			col = "house"
 			normalizeString = normalizeHouse
+		case filter.Tag:
+			col = "tag"
+			normalizeString = func(s string) string { return s }
 		default:
 			return "", fmt.Errorf("unrecognized var type: %T", n.Constraint.Var)
 		}
@@ -469,10 +1246,15 @@ func filterNodeToSQLConstraint(n *filter.Node) (string, error) {
 		}
 		if n.Constraint.Value.String != nil {
 			val := normalizeString(*n.Constraint.Value.String)
-			if col == "house" {
+			switch col {
+			case "house":
 				return fmt.Sprintf(
-					"(house1 = \"%s\" OR house2 = \"%s\" OR house3 = \"%s\")",
-					val, val, val), nil
+					"id IN (SELECT deck_id FROM deck_houses WHERE house = '%s')",
+					val), nil
+			case "tag":
+				return fmt.Sprintf(
+					"id IN (SELECT deck_id FROM deck_tags WHERE tag = '%s')",
+					val), nil
 			}
 			return fmt.Sprintf("%s %s \"%s\"", col, op, val), nil
 		}
@@ -511,22 +1293,22 @@ func filterNodeToSQLConstraint(n *filter.Node) (string, error) {
 	return fmt.Sprintf("(%s %s %s)", left, boolOp, right), nil
 }
 
-const sqlMyDeckNamesFilterPrefix string = `
-    SELECT id, name, date_added FROM decks
-    WHERE owned_by_me = 1 AND
-`
-
-// GetMyDeckMetadataWithFilter implements the forgefs.Storage interface.
-func (s *SQLiteStorage) GetMyDeckMetadataWithFilter(
-	ctx context.Context, filterRoot *filter.Node) (
+// GetDeckMetadataWithFilter implements the forgefs.Storage interface.
+func (s *SQLiteStorage) GetDeckMetadataWithFilter(
+	ctx context.Context, list forgefs.DeckList, filterRoot *filter.Node) (
 	mds map[string]forgefs.DeckMetadata, err error) {
+	col, err := deckListColumn(list)
+	if err != nil {
+		return nil, err
+	}
 	constraint, err := filterNodeToSQLConstraint(filterRoot)
 	if err != nil {
 		return nil, err
 	}
 
 	mds = make(map[string]forgefs.DeckMetadata)
-	rows, err := s.db.QueryContext(ctx, sqlMyDeckNamesFilterPrefix+constraint)
+	rows, err := s.db.QueryContext(
+		ctx, sqlDeckListMDPrefix+col+" = 1 AND "+constraint)
 	if err != nil {
 		return nil, err
 	}
@@ -568,7 +1350,7 @@ func (s *SQLiteStorage) GetDeck(ctx context.Context, id string) (
 	var deckJSON string
 	err = row.Scan(&deckJSON)
 	if err != nil {
-		return nil, err
+		return nil, rowErr(err)
 	}
 	var d forgefs.Deck
 	err = json.Unmarshal([]byte(deckJSON), &d)
@@ -578,6 +1360,493 @@ func (s *SQLiteStorage) GetDeck(ctx context.Context, id string) (
 	return &d, nil
 }
 
+const sqlDecksWithCard string = `
+    SELECT decks.id, decks.name, decks.date_added, COUNT(*)
+    FROM deck_cards JOIN decks ON decks.id = deck_cards.deck_id
+    WHERE deck_cards.card_title=? AND decks.owned_by_me = 1
+    GROUP BY decks.id;
+`
+
+// GetDecksWithCard implements the forgefs.Storage interface.
+func (s *SQLiteStorage) GetDecksWithCard(ctx context.Context, title string) (
+	decks []forgefs.DeckCardCount, err error) {
+	rows, err := s.db.QueryContext(ctx, sqlDecksWithCard, title)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := rows.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	for rows.Next() {
+		var dcc forgefs.DeckCardCount
+		err = rows.Scan(&dcc.ID, &dcc.Name, &dcc.DateAdded, &dcc.Count)
+		if err != nil {
+			return nil, err
+		}
+		decks = append(decks, dcc)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return decks, nil
+}
+
+const sqlUnfetchedDeckCount string = `
+    SELECT COUNT(*) FROM decks
+    WHERE owned_by_me = 1 AND NOT EXISTS (
+        SELECT 1 FROM deck_cards WHERE deck_cards.deck_id = decks.id);
+`
+
+// GetUnfetchedDeckCount implements the forgefs.Storage interface.
+func (s *SQLiteStorage) GetUnfetchedDeckCount(ctx context.Context) (
+	count int, err error) {
+	row := s.db.QueryRowContext(ctx, sqlUnfetchedDeckCount)
+	err = row.Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+const (
+	// statsTopDecks is how many of the best decks are included in
+	// the collection stats.
+	statsTopDecks = 10
+	// sasHistogramBucketSize is the range of SAS ratings covered by
+	// each bucket of the collection's SAS histogram.
+	sasHistogramBucketSize = 5
+)
+
+const sqlStatValues string = `
+    COALESCE(ROUND(AVG(sas), 2), 0), COALESCE(ROUND(AVG(aerc), 2), 0),
+    COALESCE(ROUND(AVG(a), 2), 0), COALESCE(ROUND(AVG(e), 2), 0),
+    COALESCE(ROUND(AVG(r), 2), 0), COALESCE(ROUND(AVG(c), 2), 0),
+    COALESCE(ROUND(AVG(f), 2), 0), COALESCE(ROUND(AVG(d), 2), 0)`
+
+const sqlCollectionSummary string = `
+    SELECT COUNT(*), ` + sqlStatValues + `
+    FROM decks
+    WHERE owned_by_me = 1;
+`
+
+const sqlCollectionTopDecks string = `
+    SELECT id, name, sas FROM decks
+    WHERE owned_by_me = 1
+    ORDER BY sas DESC, name
+    LIMIT ?;
+`
+
+// In SQLite, the bare columns of a query using MAX() come from the
+// row with the maximum value, which gives the top deck of each group.
+const sqlCollectionByHouse string = `
+    SELECT deck_houses.house, COUNT(*), ` + sqlStatValues + `,
+        id, name, MAX(sas)
+    FROM deck_houses JOIN decks ON decks.id = deck_houses.deck_id
+    WHERE owned_by_me = 1 AND deck_houses.house != ''
+    GROUP BY deck_houses.house
+    ORDER BY deck_houses.house;
+`
+
+const sqlCollectionByExpansion string = `
+    SELECT expansion, COUNT(*), ` + sqlStatValues + `, id, name, MAX(sas)
+    FROM decks
+    WHERE owned_by_me = 1
+    GROUP BY expansion
+    ORDER BY expansion;
+`
+
+const sqlCollectionSASHistogram string = `
+    SELECT (sas / ?) * ?, COUNT(*) FROM decks
+    WHERE owned_by_me = 1
+    GROUP BY 1
+    ORDER BY 1;
+`
+
+func scanStatValues(avgs *forgefs.StatValues) []interface{} {
+	return []interface{}{
+		&avgs.SAS, &avgs.AERC, &avgs.A, &avgs.E, &avgs.R, &avgs.C,
+		&avgs.F, &avgs.D,
+	}
+}
+
+func (s *SQLiteStorage) getGroupStats(
+	ctx context.Context, query string) (groups []forgefs.GroupStats, err error) {
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := rows.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	for rows.Next() {
+		var gs forgefs.GroupStats
+		dest := []interface{}{&gs.Name, &gs.Decks}
+		dest = append(dest, scanStatValues(&gs.Averages)...)
+		dest = append(dest, &gs.TopDeck.ID, &gs.TopDeck.Name, &gs.TopDeck.SAS)
+		err = rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, gs)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return groups, nil
+}
+
+func (s *SQLiteStorage) getTopDecks(ctx context.Context) (
+	decks []forgefs.DeckScore, err error) {
+	rows, err := s.db.QueryContext(ctx, sqlCollectionTopDecks, statsTopDecks)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := rows.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	for rows.Next() {
+		var ds forgefs.DeckScore
+		err = rows.Scan(&ds.ID, &ds.Name, &ds.SAS)
+		if err != nil {
+			return nil, err
+		}
+		decks = append(decks, ds)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return decks, nil
+}
+
+func newSASBucket(min, count int) forgefs.SASBucket {
+	return forgefs.SASBucket{
+		Min:   min,
+		Max:   min + sasHistogramBucketSize - 1,
+		Decks: count,
+	}
+}
+
+// getSASHistogram returns the number of decks in each SAS bucket,
+// from the lowest to the highest rated deck, including empty buckets
+// in between.
+func (s *SQLiteStorage) getSASHistogram(ctx context.Context) (
+	buckets []forgefs.SASBucket, err error) {
+	rows, err := s.db.QueryContext(
+		ctx, sqlCollectionSASHistogram, sasHistogramBucketSize,
+		sasHistogramBucketSize)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := rows.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	for rows.Next() {
+		var min, count int
+		err = rows.Scan(&min, &count)
+		if err != nil {
+			return nil, err
+		}
+		if len(buckets) > 0 {
+			// Fill in any empty buckets since the previous one.
+			next := buckets[len(buckets)-1].Min + sasHistogramBucketSize
+			for ; next < min; next += sasHistogramBucketSize {
+				buckets = append(buckets, newSASBucket(next, 0))
+			}
+		}
+		buckets = append(buckets, newSASBucket(min, count))
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return buckets, nil
+}
+
+const sqlCollectionStatValues string = `
+    SELECT sas, aerc, a, e, r, c, f, d FROM decks
+    WHERE owned_by_me = 1;
+`
+
+// median returns the median of the given values, sorting them in the
+// process.
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 1 {
+		return values[mid]
+	}
+	return (values[mid-1] + values[mid]) / 2
+}
+
+// GetCollectionMedians implements the forgefs.Storage interface.
+func (s *SQLiteStorage) GetCollectionMedians(ctx context.Context) (
+	medians *forgefs.StatValues, err error) {
+	rows, err := s.db.QueryContext(ctx, sqlCollectionStatValues)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := rows.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	var columns [8][]float64
+	for rows.Next() {
+		var sv forgefs.StatValues
+		err = rows.Scan(scanStatValues(&sv)...)
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range []float64{
+			sv.SAS, sv.AERC, sv.A, sv.E, sv.R, sv.C, sv.F, sv.D,
+		} {
+			columns[i] = append(columns[i], v)
+		}
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return &forgefs.StatValues{
+		SAS:  median(columns[0]),
+		AERC: median(columns[1]),
+		A:    median(columns[2]),
+		E:    median(columns[3]),
+		R:    median(columns[4]),
+		C:    median(columns[5]),
+		F:    median(columns[6]),
+		D:    median(columns[7]),
+	}, nil
+}
+
+// GetCollectionStats implements the forgefs.Storage interface.
+func (s *SQLiteStorage) GetCollectionStats(ctx context.Context) (
+	stats *forgefs.CollectionStats, err error) {
+	var cs forgefs.CollectionStats
+	row := s.db.QueryRowContext(ctx, sqlCollectionSummary)
+	err = row.Scan(append(
+		[]interface{}{&cs.Decks}, scanStatValues(&cs.Averages)...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	cs.UnfetchedDecks, err = s.GetUnfetchedDeckCount(ctx)
+	if err != nil {
+		return nil, err
+	}
+	medians, err := s.GetCollectionMedians(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cs.Medians = *medians
+	cs.TopDecks, err = s.getTopDecks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cs.ByHouse, err = s.getGroupStats(ctx, sqlCollectionByHouse)
+	if err != nil {
+		return nil, err
+	}
+	cs.ByExpansion, err = s.getGroupStats(ctx, sqlCollectionByExpansion)
+	if err != nil {
+		return nil, err
+	}
+	cs.SASHistogram, err = s.getSASHistogram(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &cs, nil
+}
+
+const sqlDeckSummary string = `
+    SELECT expansion, sas, aerc, a, e, r, c, f, d, COALESCE((
+        SELECT group_concat(house, ',') FROM (
+            SELECT house FROM deck_houses
+            WHERE deck_id = decks.id AND house != ''
+            ORDER BY position)), '')
+    FROM decks
+    WHERE id=?;
+`
+
+// GetDeckSummary implements the forgefs.Storage interface.
+func (s *SQLiteStorage) GetDeckSummary(ctx context.Context, id string) (
+	summary *forgefs.DeckSummary, err error) {
+	row := s.db.QueryRowContext(ctx, sqlDeckSummary, id)
+	var ds forgefs.DeckSummary
+	var houses string
+	err = row.Scan(
+		&ds.Expansion, &ds.SAS, &ds.AERC, &ds.A, &ds.E, &ds.R, &ds.C,
+		&ds.F, &ds.D, &houses)
+	if err != nil {
+		return nil, rowErr(err)
+	}
+	if houses != "" {
+		ds.Houses = strings.Split(houses, ",")
+	}
+	return &ds, nil
+}
+
+const sqlDeckNotes string = `
+    SELECT COALESCE(deck_notes.notes, json_extract(decks.json, '$.notes'), '')
+    FROM decks LEFT JOIN deck_notes ON deck_notes.id = decks.id
+    WHERE decks.id=?;
+`
+
+// GetDeckNotes implements the forgefs.Storage interface.
+func (s *SQLiteStorage) GetDeckNotes(ctx context.Context, id string) (
+	notes string, err error) {
+	row := s.db.QueryRowContext(ctx, sqlDeckNotes, id)
+	err = row.Scan(&notes)
+	if err != nil {
+		return "", rowErr(err)
+	}
+	return notes, nil
+}
+
+const sqlDeckNotesStore string = `
+    INSERT OR REPLACE INTO deck_notes (id, notes) VALUES (?, ?);
+`
+
+// StoreDeckNotes implements the forgefs.Storage interface.
+func (s *SQLiteStorage) StoreDeckNotes(
+	ctx context.Context, id, notes string) error {
+	_, err := s.db.ExecContext(ctx, sqlDeckNotesStore, id, notes)
+	return err
+}
+
+const sqlTags string = `
+    SELECT name FROM tags;
+`
+
+// GetTags implements the forgefs.Storage interface.
+func (s *SQLiteStorage) GetTags(ctx context.Context) (
+	tags []string, err error) {
+	rows, err := s.db.QueryContext(ctx, sqlTags)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := rows.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	for rows.Next() {
+		var tag string
+		err = rows.Scan(&tag)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return tags, nil
+}
+
+const sqlTagCreate string = `
+    INSERT OR IGNORE INTO tags (name) VALUES (?);
+`
+
+// CreateTag implements the forgefs.Storage interface.
+func (s *SQLiteStorage) CreateTag(ctx context.Context, tag string) error {
+	_, err := s.db.ExecContext(ctx, sqlTagCreate, tag)
+	return err
+}
+
+const sqlTagDelete string = `
+    DELETE FROM deck_tags WHERE tag=?;
+    DELETE FROM tags WHERE name=?;
+`
+
+// DeleteTag implements the forgefs.Storage interface.
+func (s *SQLiteStorage) DeleteTag(ctx context.Context, tag string) error {
+	_, err := s.db.ExecContext(ctx, sqlTagDelete, tag, tag)
+	return err
+}
+
+const sqlTagDeck string = `
+    INSERT OR IGNORE INTO deck_tags (tag, deck_id) VALUES (?, ?);
+`
+
+// TagDeck implements the forgefs.Storage interface.
+func (s *SQLiteStorage) TagDeck(ctx context.Context, tag, id string) error {
+	_, err := s.db.ExecContext(ctx, sqlTagDeck, tag, id)
+	return err
+}
+
+const sqlUntagDeck string = `
+    DELETE FROM deck_tags WHERE tag=? AND deck_id=?;
+`
+
+// UntagDeck implements the forgefs.Storage interface.
+func (s *SQLiteStorage) UntagDeck(ctx context.Context, tag, id string) error {
+	_, err := s.db.ExecContext(ctx, sqlUntagDeck, tag, id)
+	return err
+}
+
+const sqlTaggedDeckMD string = `
+    SELECT decks.id, decks.name, decks.date_added
+    FROM decks JOIN deck_tags ON deck_tags.deck_id = decks.id
+    WHERE deck_tags.tag=?;
+`
+
+// GetTaggedDeckMetadata implements the forgefs.Storage interface.
+func (s *SQLiteStorage) GetTaggedDeckMetadata(
+	ctx context.Context, tag string) (
+	mds map[string]forgefs.DeckMetadata, err error) {
+	mds = make(map[string]forgefs.DeckMetadata)
+	rows, err := s.db.QueryContext(ctx, sqlTaggedDeckMD, tag)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := rows.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	for rows.Next() {
+		var id, name string
+		var dateAdded time.Time
+		err = rows.Scan(&id, &name, &dateAdded)
+		if err != nil {
+			return nil, err
+		}
+		mds[id] = forgefs.DeckMetadata{
+			ID:        id,
+			Name:      name,
+			DateAdded: dateAdded,
+		}
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return mds, nil
+}
+
 const sqlSASVersion string = `
     SELECT id, sas_version FROM decks
     WHERE sas_version != 0
@@ -599,6 +1868,50 @@ func (s *SQLiteStorage) GetSampleDeckWithVersion(ctx context.Context) (
 	}
 }
 
+const sqlSetSyncTime string = `
+    INSERT OR REPLACE INTO sync_times (kind, time) VALUES (?, ?);
+`
+
+// SetSyncTime implements the forgefs.Storage interface.
+func (s *SQLiteStorage) SetSyncTime(
+	ctx context.Context, kind string, t time.Time) error {
+	_, err := s.db.ExecContext(ctx, sqlSetSyncTime, kind, t)
+	return err
+}
+
+const sqlSyncTimes string = `
+    SELECT kind, time FROM sync_times;
+`
+
+// GetSyncTimes implements the forgefs.Storage interface.
+func (s *SQLiteStorage) GetSyncTimes(ctx context.Context) (
+	times map[string]time.Time, err error) {
+	rows, err := s.db.QueryContext(ctx, sqlSyncTimes)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := rows.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	times = make(map[string]time.Time)
+	for rows.Next() {
+		var kind string
+		var t time.Time
+		err = rows.Scan(&kind, &t)
+		if err != nil {
+			return nil, err
+		}
+		times[kind] = t
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return times, nil
+}
+
 const sqlDropVersionTable string = `
     DROP TABLE IF EXISTS version;
 `
@@ -614,5 +1927,11 @@ func (s *SQLiteStorage) Reset(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	if s.fts {
+		_, err = s.db.ExecContext(ctx, sqlDropFTSTable)
+		if err != nil {
+			return err
+		}
+	}
 	return s.init(ctx)
 }
@@ -1,12 +1,24 @@
 package storage
 
 import (
+	"context"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/strib/forgefs"
 	"github.com/strib/forgefs/filter"
 )
 
+func newTestSQLiteStorage(t *testing.T) *SQLiteStorage {
+	s, err := NewSQLiteStorage(
+		context.Background(), filepath.Join(t.TempDir(), "test.sqlite"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = s.Shutdown() })
+	return s
+}
+
 func TestFilterNodeToSQLConstraint(t *testing.T) {
 	checkFilter := func(toParse, expectedSQL string) {
 		n, err := filter.Parse(toParse)
@@ -21,7 +33,7 @@ func TestFilterNodeToSQLConstraint(t *testing.T) {
 	checkFilter("f=10^d=2", "(f = 10 OR d = 2)")
 	checkFilter(
 		"house=lOgOs",
-		"(house1 = \"Logos\" OR house2 = \"Logos\" OR house3 = \"Logos\")")
+		"id IN (SELECT deck_id FROM deck_houses WHERE house = 'Logos')")
 	checkFilter("expansion=CotA", "expansion = \"CALL_OF_THE_ARCHONS\"")
 	checkFilter("a=10:", "a >= 10")
 	checkFilter("c=:10", "c <= 10")
@@ -31,3 +43,759 @@ func TestFilterNodeToSQLConstraint(t *testing.T) {
 		"sas=80:85+aerc=50:^a=5",
 		"((sas >= 80 AND sas <= 85) AND (aerc >= 50 OR a = 5))")
 }
+
+func TestGetCardNumbers(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLiteStorage(t)
+
+	err := s.StoreCards(ctx, []forgefs.Card{
+		{
+			ID:        "1",
+			CardTitle: "card1",
+			CardNumbers: []forgefs.CardNumber{
+				{Expansion: "MASS_MUTATION", CardNumber: "12"},
+				{Expansion: "DARK_TIDINGS", CardNumber: "3"},
+			},
+		},
+		{
+			ID:        "2",
+			CardTitle: "card2",
+		},
+	})
+	require.NoError(t, err)
+
+	numbers, err := s.GetCardNumbers(ctx)
+	require.NoError(t, err)
+	require.Len(t, numbers, 1)
+	require.ElementsMatch(t, []forgefs.CardNumber{
+		{Expansion: "MASS_MUTATION", CardNumber: "12"},
+		{Expansion: "DARK_TIDINGS", CardNumber: "3"},
+	}, numbers["1"])
+}
+
+func TestCardImageURLs(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLiteStorage(t)
+
+	err := s.StoreCards(ctx, []forgefs.Card{
+		{
+			ID:            "1",
+			CardTitle:     "card1",
+			ExpansionEnum: "MASS_MUTATION",
+			FrontImage:    "https://example.com/mm/card1.png",
+		},
+		// A reprint with new art.
+		{
+			ID:            "2",
+			CardTitle:     "card1",
+			ExpansionEnum: "DARK_TIDINGS",
+			FrontImage:    "https://example.com/dt/card1.png",
+		},
+		{
+			ID:        "3",
+			CardTitle: "card2",
+		},
+	})
+	require.NoError(t, err)
+
+	urls, err := s.GetCardImageURLs(ctx, "card1")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"MASS_MUTATION": "https://example.com/mm/card1.png",
+		"DARK_TIDINGS":  "https://example.com/dt/card1.png",
+	}, urls)
+
+	urls, err = s.GetCardImageURLs(ctx, "card2")
+	require.NoError(t, err)
+	require.Empty(t, urls)
+
+	// The table is backfilled from cards stored before it existed.
+	_, err = s.db.ExecContext(ctx, "DROP TABLE card_images;")
+	require.NoError(t, err)
+	err = s.init(ctx)
+	require.NoError(t, err)
+	urls, err = s.GetCardImageURLs(ctx, "card1")
+	require.NoError(t, err)
+	require.Len(t, urls, 2)
+}
+
+func TestGetSummaries(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLiteStorage(t)
+
+	err := s.StoreCards(ctx, []forgefs.Card{{
+		ID:            "1",
+		CardTitle:     "card1",
+		House:         "Logos",
+		CardType:      "Creature",
+		Rarity:        "Rare",
+		ExpansionEnum: "MASS_MUTATION",
+		AERCScore:     2.5,
+	}})
+	require.NoError(t, err)
+	cs, err := s.GetCardSummary(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, forgefs.CardSummary{
+		House:     "Logos",
+		Type:      "Creature",
+		Rarity:    "Rare",
+		Expansion: "MASS_MUTATION",
+		AERC:      2.5,
+	}, *cs)
+
+	err = s.StoreDecks(ctx, []forgefs.Deck{{
+		DeckInfo: forgefs.DeckInfo{
+			KeyforgeID:   "2",
+			Name:         "deck",
+			Expansion:    "MASS_MUTATION",
+			SasRating:    70,
+			AercScore:    60,
+			AmberControl: 9.5,
+			Houses: []forgefs.HouseInDeck{
+				{House: "Logos"}, {House: "Mars"}, {House: "Dis"},
+			},
+		},
+	}})
+	require.NoError(t, err)
+	ds, err := s.GetDeckSummary(ctx, "2")
+	require.NoError(t, err)
+	require.Equal(t, forgefs.DeckSummary{
+		Expansion: "MASS_MUTATION",
+		SAS:       70,
+		AERC:      60,
+		A:         9.5,
+		Houses:    []string{"Logos", "Mars", "Dis"},
+	}, *ds)
+
+	// Missing cards and decks aren't found.
+	_, err = s.GetCardSummary(ctx, "3")
+	require.ErrorIs(t, err, forgefs.ErrNotFound)
+	_, err = s.GetCardByTitle(ctx, "nope")
+	require.ErrorIs(t, err, forgefs.ErrNotFound)
+	_, err = s.GetDeckSummary(ctx, "3")
+	require.ErrorIs(t, err, forgefs.ErrNotFound)
+	_, err = s.GetDeck(ctx, "3")
+	require.ErrorIs(t, err, forgefs.ErrNotFound)
+}
+
+func TestDeckNotes(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLiteStorage(t)
+
+	deck := forgefs.Deck{
+		DeckInfo: forgefs.DeckInfo{KeyforgeID: "1", Name: "deck"},
+		Notes:    "from dok",
+	}
+	err := s.StoreDecks(ctx, []forgefs.Deck{deck})
+	require.NoError(t, err)
+
+	notes, err := s.GetDeckNotes(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, "from dok", notes)
+
+	err = s.StoreDeckNotes(ctx, "1", "mine")
+	require.NoError(t, err)
+	notes, err = s.GetDeckNotes(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, "mine", notes)
+
+	// Local notes survive deck updates and resets.
+	err = s.StoreDecks(ctx, []forgefs.Deck{deck})
+	require.NoError(t, err)
+	err = s.Reset(ctx)
+	require.NoError(t, err)
+	err = s.StoreDecks(ctx, []forgefs.Deck{deck})
+	require.NoError(t, err)
+	notes, err = s.GetDeckNotes(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, "mine", notes)
+}
+
+func TestTags(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLiteStorage(t)
+
+	decks := []forgefs.Deck{
+		{
+			DeckInfo:  forgefs.DeckInfo{KeyforgeID: "1", Name: "deck1"},
+			OwnedByMe: true,
+		},
+		{
+			DeckInfo:  forgefs.DeckInfo{KeyforgeID: "2", Name: "deck2"},
+			OwnedByMe: true,
+		},
+	}
+	err := s.StoreDecks(ctx, decks)
+	require.NoError(t, err)
+
+	err = s.CreateTag(ctx, "to-sell")
+	require.NoError(t, err)
+	err = s.CreateTag(ctx, "league")
+	require.NoError(t, err)
+	err = s.TagDeck(ctx, "to-sell", "1")
+	require.NoError(t, err)
+	err = s.TagDeck(ctx, "league", "2")
+	require.NoError(t, err)
+
+	tags, err := s.GetTags(ctx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"to-sell", "league"}, tags)
+
+	mds, err := s.GetTaggedDeckMetadata(ctx, "to-sell")
+	require.NoError(t, err)
+	require.Len(t, mds, 1)
+	require.Equal(t, "deck1", mds["1"].Name)
+
+	filterRoot, err := filter.Parse("tag=to-sell")
+	require.NoError(t, err)
+	mds, err = s.GetDeckMetadataWithFilter(ctx, forgefs.DeckListMine, filterRoot)
+	require.NoError(t, err)
+	require.Len(t, mds, 1)
+	require.Contains(t, mds, "1")
+
+	// Tags survive resets.
+	err = s.Reset(ctx)
+	require.NoError(t, err)
+	err = s.StoreDecks(ctx, decks)
+	require.NoError(t, err)
+	mds, err = s.GetTaggedDeckMetadata(ctx, "league")
+	require.NoError(t, err)
+	require.Contains(t, mds, "2")
+
+	err = s.UntagDeck(ctx, "league", "2")
+	require.NoError(t, err)
+	mds, err = s.GetTaggedDeckMetadata(ctx, "league")
+	require.NoError(t, err)
+	require.Len(t, mds, 0)
+
+	err = s.DeleteTag(ctx, "to-sell")
+	require.NoError(t, err)
+	tags, err = s.GetTags(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"league"}, tags)
+	mds, err = s.GetTaggedDeckMetadata(ctx, "to-sell")
+	require.NoError(t, err)
+	require.Len(t, mds, 0)
+}
+
+func TestDeckLists(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLiteStorage(t)
+
+	decks := []forgefs.Deck{
+		{
+			DeckInfo:  forgefs.DeckInfo{KeyforgeID: "1", Name: "deck1"},
+			OwnedByMe: true,
+		},
+		{
+			DeckInfo: forgefs.DeckInfo{KeyforgeID: "2", Name: "deck2"},
+			Wishlist: true,
+		},
+		{
+			DeckInfo: forgefs.DeckInfo{
+				KeyforgeID: "3", Name: "deck3", SasRating: 80},
+			Wishlist: true,
+			Funny:    true,
+		},
+	}
+	err := s.StoreDecks(ctx, decks)
+	require.NoError(t, err)
+
+	checkIDs := func(
+		mds map[string]forgefs.DeckMetadata, expectedIDs ...string) {
+		ids := make([]string, 0, len(mds))
+		for id := range mds {
+			ids = append(ids, id)
+		}
+		require.ElementsMatch(t, expectedIDs, ids)
+	}
+
+	mds, err := s.GetDeckMetadata(ctx, forgefs.DeckListMine)
+	require.NoError(t, err)
+	checkIDs(mds, "1")
+	mds, err = s.GetDeckMetadata(ctx, forgefs.DeckListWishlist)
+	require.NoError(t, err)
+	checkIDs(mds, "2", "3")
+	mds, err = s.GetDeckMetadata(ctx, forgefs.DeckListFunny)
+	require.NoError(t, err)
+	checkIDs(mds, "3")
+
+	filterRoot, err := filter.Parse("sas=70:")
+	require.NoError(t, err)
+	mds, err = s.GetDeckMetadataWithFilter(
+		ctx, forgefs.DeckListWishlist, filterRoot)
+	require.NoError(t, err)
+	checkIDs(mds, "3")
+}
+
+func TestSearchCards(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLiteStorage(t)
+
+	cards := []forgefs.Card{
+		{
+			ID:        "1",
+			CardTitle: "Ammonia Clouds",
+			CardText:  "Deal 3 damage to each creature.",
+		},
+		{
+			ID:         "2",
+			CardTitle:  "Anger",
+			CardText:   "Ready and fight with a friendly creature.",
+			FlavorText: "Clouds of rage.",
+		},
+		{
+			ID:        "3",
+			CardTitle: "Bumpsy",
+			CardText:  "Play: Your opponent loses 1 amber.",
+			Traits:    []string{"Giant"},
+		},
+		// A reprint.
+		{
+			ID:        "4",
+			CardTitle: "Anger",
+			CardText:  "Ready and fight with a friendly creature.",
+		},
+	}
+	err := s.StoreCards(ctx, cards)
+	require.NoError(t, err)
+
+	titles, err := s.SearchCards(ctx, "clouds")
+	require.NoError(t, err)
+	require.Equal(t, []string{"Ammonia Clouds", "Anger"}, titles)
+
+	titles, err = s.SearchCards(ctx, "friendly creature")
+	require.NoError(t, err)
+	require.Equal(t, []string{"Anger"}, titles)
+
+	titles, err = s.SearchCards(ctx, "giant")
+	require.NoError(t, err)
+	require.Equal(t, []string{"Bumpsy"}, titles)
+
+	titles, err = s.SearchCards(ctx, `"amber" -`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Bumpsy"}, titles)
+
+	titles, err = s.SearchCards(ctx, "nothing")
+	require.NoError(t, err)
+	require.Len(t, titles, 0)
+
+	// Storing a card again replaces it.
+	cards[2].CardText = "Play: Your opponent loses 2 amber."
+	err = s.StoreCards(ctx, cards[2:3])
+	require.NoError(t, err)
+	titles, err = s.SearchCards(ctx, "giant")
+	require.NoError(t, err)
+	require.Equal(t, []string{"Bumpsy"}, titles)
+	card, err := s.GetCard(ctx, "3")
+	require.NoError(t, err)
+	require.Equal(t, cards[2].CardText, card.CardText)
+
+	// The full-text index is only used when SQLite has FTS5.
+	require.Equal(t, testFTS, s.fts)
+	if !s.fts {
+		return
+	}
+
+	// Cards stored by a build without FTS5 get indexed on the next
+	// start with FTS5.
+	s.fts = false
+	err = s.StoreCards(ctx, []forgefs.Card{
+		{ID: "5", CardTitle: "Ganger Chieftain", CardText: "Play: Ready."},
+	})
+	require.NoError(t, err)
+	err = s.init(ctx)
+	require.NoError(t, err)
+	titles, err = s.SearchCards(ctx, "chieftain")
+	require.NoError(t, err)
+	require.Equal(t, []string{"Ganger Chieftain"}, titles)
+
+	// Even if they only replace cards that were already indexed.
+	s.fts = false
+	cards[2].CardText = "Play: Steal 1 amber."
+	err = s.StoreCards(ctx, cards[2:3])
+	require.NoError(t, err)
+	err = s.init(ctx)
+	require.NoError(t, err)
+	titles, err = s.SearchCards(ctx, "steal")
+	require.NoError(t, err)
+	require.Equal(t, []string{"Bumpsy"}, titles)
+	titles, err = s.SearchCards(ctx, "loses")
+	require.NoError(t, err)
+	require.Len(t, titles, 0)
+}
+
+func TestTraits(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLiteStorage(t)
+
+	cards := []forgefs.Card{
+		{
+			ID:        "1",
+			CardTitle: "Ammonia Clouds",
+			ExtraCardInfo: forgefs.ExtraCardInfo{
+				Traits: []forgefs.Trait{{Trait: "DealsDamage"}},
+			},
+		},
+		{
+			ID:        "2",
+			CardTitle: "Anger",
+			ExtraCardInfo: forgefs.ExtraCardInfo{
+				Synergies: []forgefs.Trait{
+					{Trait: "DealsDamage", House: "Friendly"},
+					{Trait: "Ready"},
+				},
+			},
+		},
+		// A reprint.
+		{
+			ID:        "3",
+			CardTitle: "Anger",
+			ExtraCardInfo: forgefs.ExtraCardInfo{
+				Synergies: []forgefs.Trait{{Trait: "DealsDamage"}},
+			},
+		},
+		{
+			ID:        "4",
+			CardTitle: "Bumpsy",
+		},
+	}
+	err := s.StoreCards(ctx, cards)
+	require.NoError(t, err)
+
+	traits, err := s.GetTraits(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"DealsDamage", "Ready"}, traits)
+
+	providers, synergies, err := s.GetCardsWithTrait(ctx, "DealsDamage")
+	require.NoError(t, err)
+	require.Equal(t, []string{"Ammonia Clouds"}, providers)
+	require.Equal(t, []string{"Anger"}, synergies)
+
+	providers, synergies, err = s.GetCardsWithTrait(ctx, "Flying")
+	require.NoError(t, err)
+	require.Empty(t, providers)
+	require.Empty(t, synergies)
+}
+
+func TestDecksWithCard(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLiteStorage(t)
+
+	decks := []forgefs.Deck{
+		{
+			DeckInfo: forgefs.DeckInfo{
+				KeyforgeID: "1",
+				Name:       "deck1",
+				Houses: []forgefs.HouseInDeck{
+					{House: "Logos", Cards: []forgefs.CardInDeck{
+						{CardTitle: "Anger"}, {CardTitle: "Anger"},
+					}},
+					{House: "Mars", Cards: []forgefs.CardInDeck{
+						{CardTitle: "Ammonia Clouds"},
+					}},
+				},
+			},
+			OwnedByMe: true,
+		},
+		{
+			DeckInfo: forgefs.DeckInfo{
+				KeyforgeID: "2",
+				Name:       "deck2",
+				Houses: []forgefs.HouseInDeck{
+					{House: "Logos", Cards: []forgefs.CardInDeck{
+						{CardTitle: "Anger"},
+					}},
+				},
+			},
+			Wishlist: true,
+		},
+		{
+			DeckInfo:  forgefs.DeckInfo{KeyforgeID: "3", Name: "deck3"},
+			OwnedByMe: true,
+		},
+	}
+	err := s.StoreDecks(ctx, decks)
+	require.NoError(t, err)
+
+	dccs, err := s.GetDecksWithCard(ctx, "Anger")
+	require.NoError(t, err)
+	require.Len(t, dccs, 1)
+	require.Equal(t, "1", dccs[0].ID)
+	require.Equal(t, 2, dccs[0].Count)
+
+	count, err := s.GetUnfetchedDeckCount(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	// Fetching the card list of the third deck replaces its cards.
+	decks[2].DeckInfo.Houses = []forgefs.HouseInDeck{
+		{House: "Dis", Cards: []forgefs.CardInDeck{{CardTitle: "Anger"}}},
+	}
+	err = s.StoreDecks(ctx, decks[2:])
+	require.NoError(t, err)
+	dccs, err = s.GetDecksWithCard(ctx, "Anger")
+	require.NoError(t, err)
+	require.Len(t, dccs, 2)
+	count, err = s.GetUnfetchedDeckCount(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+
+	// The table is backfilled from decks stored before it existed.
+	_, err = s.db.ExecContext(ctx, "DROP TABLE deck_cards;")
+	require.NoError(t, err)
+	err = s.init(ctx)
+	require.NoError(t, err)
+	dccs, err = s.GetDecksWithCard(ctx, "Ammonia Clouds")
+	require.NoError(t, err)
+	require.Len(t, dccs, 1)
+	require.Equal(t, 1, dccs[0].Count)
+	dccs, err = s.GetDecksWithCard(ctx, "Anger")
+	require.NoError(t, err)
+	require.Len(t, dccs, 2)
+}
+
+func TestDeckHousesAndCards(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLiteStorage(t)
+
+	decks := []forgefs.Deck{
+		{
+			DeckInfo: forgefs.DeckInfo{
+				KeyforgeID: "1",
+				Name:       "deck1",
+				Houses: []forgefs.HouseInDeck{
+					{House: "Logos", Cards: []forgefs.CardInDeck{
+						{CardTitle: "Anger", Rarity: "Common"},
+						{CardTitle: "Anger", Rarity: "Common", Maverick: true},
+					}},
+					{House: "Mars", Cards: []forgefs.CardInDeck{
+						{CardTitle: "Ammonia Clouds", Rarity: "Rare",
+							Legacy: true},
+					}},
+				},
+			},
+			OwnedByMe: true,
+		},
+		{
+			DeckInfo: forgefs.DeckInfo{
+				KeyforgeID: "2",
+				Name:       "deck2",
+				Houses: []forgefs.HouseInDeck{
+					{House: "Dis", Cards: []forgefs.CardInDeck{
+						{CardTitle: "Orb of Wonder", Anomaly: true},
+					}},
+				},
+			},
+			OwnedByMe: true,
+		},
+	}
+	err := s.StoreDecks(ctx, decks)
+	require.NoError(t, err)
+
+	type deckCard struct {
+		position                  int
+		house, title, rarity      string
+		maverick, legacy, anomaly bool
+	}
+	getCards := func(id string) (cards []deckCard) {
+		rows, err := s.db.QueryContext(ctx, `
+            SELECT position, house, card_title, rarity, maverick, legacy,
+                anomaly
+            FROM deck_cards WHERE deck_id=? ORDER BY position;`, id)
+		require.NoError(t, err)
+		defer rows.Close()
+		for rows.Next() {
+			var dc deckCard
+			err = rows.Scan(
+				&dc.position, &dc.house, &dc.title, &dc.rarity,
+				&dc.maverick, &dc.legacy, &dc.anomaly)
+			require.NoError(t, err)
+			cards = append(cards, dc)
+		}
+		require.NoError(t, rows.Err())
+		return cards
+	}
+	deck1Cards := []deckCard{
+		{0, "Logos", "Anger", "Common", false, false, false},
+		{1, "Logos", "Anger", "Common", true, false, false},
+		{2, "Mars", "Ammonia Clouds", "Rare", false, true, false},
+	}
+	require.Equal(t, deck1Cards, getCards("1"))
+	require.Equal(t, []deckCard{
+		{0, "Dis", "Orb of Wonder", "", false, false, true},
+	}, getCards("2"))
+
+	// Houses are stored even for decks without exactly three.
+	ds, err := s.GetDeckSummary(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"Logos", "Mars"}, ds.Houses)
+	filterRoot, err := filter.Parse("house=mars")
+	require.NoError(t, err)
+	mds, err := s.GetDeckMetadataWithFilter(
+		ctx, forgefs.DeckListMine, filterRoot)
+	require.NoError(t, err)
+	require.Len(t, mds, 1)
+	require.Contains(t, mds, "1")
+
+	// Both tables are backfilled from decks stored before they
+	// existed.
+	_, err = s.db.ExecContext(
+		ctx, "DROP TABLE deck_cards; DROP TABLE deck_houses;")
+	require.NoError(t, err)
+	err = s.init(ctx)
+	require.NoError(t, err)
+	require.Equal(t, deck1Cards, getCards("1"))
+	ds, err = s.GetDeckSummary(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"Logos", "Mars"}, ds.Houses)
+
+	// A failure partway through storing decks stores none of them.
+	decks[0].DeckInfo.Houses = nil
+	decks[1].DeckInfo.DateAdded = "not a date"
+	err = s.StoreDecks(ctx, decks)
+	require.Error(t, err)
+	require.Equal(t, deck1Cards, getCards("1"))
+	deck, err := s.GetDeck(ctx, "1")
+	require.NoError(t, err)
+	require.Len(t, deck.DeckInfo.Houses, 2)
+}
+
+type testObserver struct {
+	cards []forgefs.Card
+	decks []forgefs.Deck
+}
+
+func (to *testObserver) CardsUpdated(_ context.Context, cards []forgefs.Card) {
+	to.cards = append(to.cards, cards...)
+}
+
+func (to *testObserver) DecksUpdated(_ context.Context, decks []forgefs.Deck) {
+	to.decks = append(to.decks, decks...)
+}
+
+func TestObserver(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLiteStorage(t)
+
+	to := &testObserver{}
+	s.SetObserver(to)
+	cards := []forgefs.Card{{ID: "1", CardTitle: "Anger"}}
+	err := s.StoreCards(ctx, cards)
+	require.NoError(t, err)
+	require.Equal(t, cards, to.cards)
+	decks := []forgefs.Deck{
+		{DeckInfo: forgefs.DeckInfo{KeyforgeID: "2", Name: "deck1"}},
+	}
+	err = s.StoreDecks(ctx, decks)
+	require.NoError(t, err)
+	require.Equal(t, decks, to.decks)
+
+	// No more notifications once the observer is removed.
+	s.SetObserver(nil)
+	err = s.StoreCards(ctx, []forgefs.Card{{ID: "3", CardTitle: "Bumpsy"}})
+	require.NoError(t, err)
+	require.Len(t, to.cards, 1)
+}
+
+func TestCollectionStats(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLiteStorage(t)
+
+	makeDeck := func(
+		id, name, expansion string, sas int, a float64,
+		houses ...string) forgefs.Deck {
+		info := forgefs.DeckInfo{
+			KeyforgeID:   id,
+			Name:         name,
+			Expansion:    expansion,
+			SasRating:    sas,
+			AmberControl: a,
+		}
+		for _, h := range houses {
+			info.Houses = append(info.Houses, forgefs.HouseInDeck{House: h})
+		}
+		return forgefs.Deck{DeckInfo: info, OwnedByMe: true}
+	}
+	decks := []forgefs.Deck{
+		makeDeck("1", "deck1", "MASS_MUTATION", 72, 10,
+			"Dis", "Logos", "Mars"),
+		makeDeck("2", "deck2", "MASS_MUTATION", 58, 5,
+			"Dis", "Sanctum", "Shadows"),
+		makeDeck("3", "deck3", "DARK_TIDINGS", 61, 3),
+	}
+	wish := makeDeck("4", "deck4", "DARK_TIDINGS", 99, 1)
+	wish.OwnedByMe = false
+	wish.Wishlist = true
+	decks = append(decks, wish)
+	err := s.StoreDecks(ctx, decks)
+	require.NoError(t, err)
+
+	stats, err := s.GetCollectionStats(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 3, stats.Decks)
+	require.Equal(t, 3, stats.UnfetchedDecks)
+	require.Equal(t, 63.67, stats.Averages.SAS)
+	require.Equal(t, 6.0, stats.Averages.A)
+	require.Equal(t, 61.0, stats.Medians.SAS)
+	require.Equal(t, 5.0, stats.Medians.A)
+	medians, err := s.GetCollectionMedians(ctx)
+	require.NoError(t, err)
+	require.Equal(t, stats.Medians, *medians)
+	require.Equal(t, []forgefs.DeckScore{
+		{ID: "1", Name: "deck1", SAS: 72},
+		{ID: "3", Name: "deck3", SAS: 61},
+		{ID: "2", Name: "deck2", SAS: 58},
+	}, stats.TopDecks)
+
+	require.Len(t, stats.ByHouse, 5)
+	dis := stats.ByHouse[0]
+	require.Equal(t, "Dis", dis.Name)
+	require.Equal(t, 2, dis.Decks)
+	require.Equal(t, 65.0, dis.Averages.SAS)
+	require.Equal(t, "deck1", dis.TopDeck.Name)
+
+	require.Len(t, stats.ByExpansion, 2)
+	require.Equal(t, "DARK_TIDINGS", stats.ByExpansion[0].Name)
+	require.Equal(t, 1, stats.ByExpansion[0].Decks)
+	require.Equal(t, "MASS_MUTATION", stats.ByExpansion[1].Name)
+	require.Equal(t, forgefs.DeckScore{ID: "1", Name: "deck1", SAS: 72},
+		stats.ByExpansion[1].TopDeck)
+
+	require.Equal(t, []forgefs.SASBucket{
+		{Min: 55, Max: 59, Decks: 1},
+		{Min: 60, Max: 64, Decks: 1},
+		{Min: 65, Max: 69, Decks: 0},
+		{Min: 70, Max: 74, Decks: 1},
+	}, stats.SASHistogram)
+}
+
+func TestSyncTimes(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLiteStorage(t)
+
+	times, err := s.GetSyncTimes(ctx)
+	require.NoError(t, err)
+	require.Empty(t, times)
+
+	t1 := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	err = s.SetSyncTime(ctx, forgefs.SyncCards, t1)
+	require.NoError(t, err)
+	err = s.SetSyncTime(ctx, forgefs.SyncDecks, t1)
+	require.NoError(t, err)
+	err = s.SetSyncTime(ctx, forgefs.SyncDecks, t2)
+	require.NoError(t, err)
+	times, err = s.GetSyncTimes(ctx)
+	require.NoError(t, err)
+	require.Len(t, times, 2)
+	require.True(t, t1.Equal(times[forgefs.SyncCards]))
+	require.True(t, t2.Equal(times[forgefs.SyncDecks]))
+
+	// Resetting drops the fetched data, and with it the sync times.
+	err = s.Reset(ctx)
+	require.NoError(t, err)
+	times, err = s.GetSyncTimes(ctx)
+	require.NoError(t, err)
+	require.Empty(t, times)
+}
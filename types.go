@@ -87,7 +87,7 @@ type Card struct {
 	Big              bool                     `json:"big,omitempty"`
 	CardNumber       string                   `json:"cardNumber,omitempty"`
 	CardNumbers      []CardNumber             `json:"cardNumbers,omitempty"`
-	CardText         string                   `json:"cardTest,omitempty"`
+	CardText         string                   `json:"cardText,omitempty"`
 	CardTitle        string                   `json:"cardTitle,omitempty"`
 	CardType         string                   `json:"cardType,omitempty"`
 	Created          string                   `json:"created,omitempty"`
@@ -173,6 +173,19 @@ type Deck struct {
 	SASVersion int      `json:"sasVersion,omitempty"`
 }
 
+// DeckList identifies one of the user's lists of decks on
+// decksofkeyforge.
+type DeckList int
+
+const (
+	// DeckListMine lists the decks owned by the user.
+	DeckListMine DeckList = iota
+	// DeckListWishlist lists the decks on the user's wishlist.
+	DeckListWishlist
+	// DeckListFunny lists the decks the user has marked as funny.
+	DeckListFunny
+)
+
 // DeckMetadata exposes enough data about a deck to construct
 // fliesystem metadata for it.
 type DeckMetadata struct {
@@ -180,3 +193,114 @@ type DeckMetadata struct {
 	Name      string
 	DateAdded time.Time
 }
+
+// DeckCardCount is a deck, along with how many copies of some card it
+// contains.
+type DeckCardCount struct {
+	DeckMetadata
+	Count int
+}
+
+// DeckSummary exposes the indexed stats of a deck, which are available
+// without loading or fetching the full deck.
+type DeckSummary struct {
+	Expansion string
+	SAS       int
+	AERC      int
+	A         float64
+	E         float64
+	R         float64
+	C         float64
+	F         float64
+	D         float64
+	Houses    []string
+}
+
+// CardSummary exposes the indexed attributes of a card, which are
+// available without loading the full card.
+type CardSummary struct {
+	House     string
+	Type      string
+	Rarity    string
+	Expansion string
+	AERC      float64
+}
+
+// StatValues holds one value for each of the main deck stats, such as
+// their averages over a group of decks.
+type StatValues struct {
+	SAS  float64 `json:"sas"`
+	AERC float64 `json:"aerc"`
+	A    float64 `json:"a"`
+	E    float64 `json:"e"`
+	R    float64 `json:"r"`
+	C    float64 `json:"c"`
+	F    float64 `json:"f"`
+	D    float64 `json:"d"`
+}
+
+// DeckScore identifies a deck, along with its SAS rating.
+type DeckScore struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	SAS  int    `json:"sas"`
+}
+
+// GroupStats summarizes the user's decks that share a house or an
+// expansion.
+type GroupStats struct {
+	Name     string     `json:"name"`
+	Decks    int        `json:"decks"`
+	Averages StatValues `json:"averages"`
+	TopDeck  DeckScore  `json:"topDeck"`
+}
+
+// SASBucket counts the user's decks with a SAS rating between `Min`
+// and `Max`, inclusive.
+type SASBucket struct {
+	Min   int `json:"min"`
+	Max   int `json:"max"`
+	Decks int `json:"decks"`
+}
+
+// CollectionStats summarizes all the decks owned by the user.
+type CollectionStats struct {
+	Decks          int          `json:"decks"`
+	UnfetchedDecks int          `json:"unfetchedDecks"`
+	Averages       StatValues   `json:"averages"`
+	Medians        StatValues   `json:"medians"`
+	TopDecks       []DeckScore  `json:"topDecks"`
+	ByHouse        []GroupStats `json:"byHouse"`
+	ByExpansion    []GroupStats `json:"byExpansion"`
+	SASHistogram   []SASBucket  `json:"sasHistogram"`
+}
+
+// Kinds of full syncs with the remote servers, whose times are
+// recorded in storage.
+const (
+	SyncCards = "cards"
+	SyncDecks = "decks"
+)
+
+// ClientStats describes the recent activity of a network client.
+type ClientStats struct {
+	Name string `json:"name"`
+	// Queued is the number of requests waiting on the rate limiter.
+	Queued int `json:"queued"`
+	// InFlight is the number of requests waiting on the server.
+	InFlight int   `json:"inFlight"`
+	Requests int64 `json:"requests"`
+	Errors   int64 `json:"errors"`
+	// LimiterTokens is the number of requests that can be made
+	// without waiting, or nil if the client isn't rate-limited.  It
+	// goes negative when requests are queued.
+	LimiterTokens *float64  `json:"limiterTokens,omitempty"`
+	LastRequest   time.Time `json:"lastRequest"`
+}
+
+// ErrorRecord is an error seen while serving the file system.
+type ErrorRecord struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	Error  string    `json:"error"`
+}
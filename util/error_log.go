@@ -0,0 +1,42 @@
+package util
+
+import (
+	"sync"
+	"time"
+
+	"github.com/strib/forgefs"
+)
+
+// ErrorLogSize is the number of errors an ErrorLog keeps.
+const ErrorLogSize = 20
+
+// ErrorLog keeps the most recent errors seen by some part of
+// forgefs, so they can be reported to the user.  The zero value is
+// ready to use.
+type ErrorLog struct {
+	mu      sync.Mutex
+	records []forgefs.ErrorRecord
+}
+
+// Add records an error from the given source, dropping the oldest
+// one if the log is full.
+func (el *ErrorLog) Add(source string, err error) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	if len(el.records) == ErrorLogSize {
+		copy(el.records, el.records[1:])
+		el.records = el.records[:ErrorLogSize-1]
+	}
+	el.records = append(el.records, forgefs.ErrorRecord{
+		Time:   time.Now(),
+		Source: source,
+		Error:  err.Error(),
+	})
+}
+
+// Recent returns a copy of the logged errors, oldest first.
+func (el *ErrorLog) Recent() []forgefs.ErrorRecord {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	return append([]forgefs.ErrorRecord(nil), el.records...)
+}